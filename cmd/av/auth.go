@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/auth"
+	"github.com/aviator-co/av/internal/gh"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
+	"golang.org/x/term"
+)
+
+var authFlags struct {
+	Hostname string
+}
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "manage authentication with GitHub",
+	Long: strings.TrimSpace(`
+Manage authentication with GitHub.
+
+av looks for a GitHub token in the following places (in order):
+  1. The github.token key of the av config, which can also be set with the
+     AV_GITHUB_TOKEN or GITHUB_TOKEN environment variables (which take
+     precedence over the config files)
+  2. The av credential store (written by av auth login)
+  3. The gh CLI configuration (if you've run gh auth login)
+  4. The git credential helpers configured for the GitHub host
+
+Tokens that you've configured for av always take precedence over the tokens
+that av finds in other tools.
+`),
+}
+
+var authLoginFlags struct {
+	WithToken bool
+}
+var authLoginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "store a GitHub token for use with av",
+	Long: strings.TrimSpace(`
+Store a GitHub token in the av credential store.
+
+The token is validated with GitHub before it is stored. Tokens need the "repo"
+scope in order to manage pull requests.
+
+Examples:
+  Enter a token interactively:
+    $ av auth login
+
+  Read a token from standard input:
+    $ av auth login --with-token < token.txt
+`),
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		host := authHost()
+
+		var token string
+		if !authLoginFlags.WithToken && term.IsTerminal(int(os.Stdin.Fd())) {
+			_, _ = fmt.Fprint(os.Stderr, "Paste a GitHub token for ", colors.UserInput(host), ": ")
+			tokenBytes, err := term.ReadPassword(int(os.Stdin.Fd()))
+			_, _ = fmt.Fprint(os.Stderr, "\n")
+			if err != nil {
+				return errors.Wrap(err, "failed to read token")
+			}
+			token = string(tokenBytes)
+		} else {
+			tokenBytes, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return errors.Wrap(err, "failed to read token from stdin")
+			}
+			token = string(tokenBytes)
+		}
+		token = strings.TrimSpace(token)
+		if token == "" {
+			return errors.New("no token provided")
+		}
+
+		if _, err := authPrintViewer(cmd.Context(), token); err != nil {
+			return err
+		}
+		if err := auth.WriteStore(host, token); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprint(os.Stderr,
+			"Stored token for ", colors.UserInput(host), " in the av credential store\n",
+		)
+		return nil
+	},
+}
+
+var authStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "show the GitHub token that av is using",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		host := authHost()
+		repo, _ := getRepo()
+		token, err := auth.Resolve(repo, host)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprint(os.Stderr,
+			"Using token for ", colors.UserInput(host), " from ", colors.UserInput(token.Source), "\n",
+		)
+		if _, err := authPrintViewer(cmd.Context(), token.Value); err != nil {
+			return err
+		}
+		return nil
+	},
+}
+
+var authLogoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "remove the GitHub token from the av credential store",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		host := authHost()
+		deleted, err := auth.DeleteStore(host)
+		if err != nil {
+			return err
+		}
+		if deleted {
+			_, _ = fmt.Fprint(os.Stderr,
+				"Removed token for ", colors.UserInput(host), " from the av credential store\n",
+			)
+		} else {
+			_, _ = fmt.Fprint(os.Stderr,
+				"No token for ", colors.UserInput(host), " in the av credential store\n",
+			)
+		}
+
+		// Let the user know if av will still find a token somewhere else.
+		repo, _ := getRepo()
+		if token, err := auth.Resolve(repo, host); err == nil {
+			_, _ = fmt.Fprint(os.Stderr,
+				colors.Troubleshooting("  - note: av will still use the token from the "),
+				colors.UserInput(token.Source),
+				"\n",
+			)
+		}
+		return nil
+	},
+}
+
+func authHost() string {
+	if authFlags.Hostname != "" {
+		return authFlags.Hostname
+	}
+	// If we're not inside a repository, repo is nil and the host is
+	// determined from the av config.
+	repo, _ := getRepo()
+	return auth.Host(repo)
+}
+
+// authPrintViewer validates the token with GitHub and prints information about
+// the authenticated user.
+func authPrintViewer(ctx context.Context, token string) (*gh.Viewer, error) {
+	client, err := gh.NewClient(token)
+	if err != nil {
+		return nil, err
+	}
+	viewer, err := client.Viewer(ctx)
+	if err != nil {
+		return nil, errors.WrapIf(err, "failed to validate token with GitHub")
+	}
+	_, _ = fmt.Fprint(os.Stderr, "  - logged in as ", colors.UserInput(viewer.Login), "\n")
+	if len(viewer.Scopes) == 0 {
+		_, _ = fmt.Fprint(os.Stderr,
+			"  - token scopes: ", colors.UserInput("<none reported>"),
+			colors.Troubleshooting(" (this is expected for fine-grained tokens)"), "\n",
+		)
+	} else {
+		_, _ = fmt.Fprint(os.Stderr,
+			"  - token scopes: ", colors.UserInput(strings.Join(viewer.Scopes, ", ")), "\n",
+		)
+		if !slices.Contains(viewer.Scopes, "repo") {
+			_, _ = fmt.Fprint(os.Stderr,
+				"  - ", colors.Failure("WARNING: "),
+				"the token does not have the ", colors.UserInput("repo"),
+				" scope (av needs it to manage pull requests)\n",
+			)
+		}
+	}
+	return viewer, nil
+}
+
+func init() {
+	authCmd.PersistentFlags().StringVar(
+		&authFlags.Hostname, "hostname", "",
+		"the GitHub host to authenticate with (defaults to the host of the repository's remote)",
+	)
+	authLoginCmd.Flags().BoolVar(
+		&authLoginFlags.WithToken, "with-token", false,
+		"read the token from standard input",
+	)
+	authCmd.AddCommand(
+		authLoginCmd,
+		authLogoutCmd,
+		authStatusCmd,
+	)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aviator-co/av/internal/config"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/shurcooL/githubv4"
+	"github.com/spf13/cobra"
+)
+
+// The functions in this file provide dynamic shell completions (see
+// `av completion --help`). Completions run on every press of the tab key, so
+// they only read local state (mostly the branch metadata in
+// refs/av/branch-metadata) and never talk to GitHub.
+
+// isCompletionCmd returns true if the command is run by the shell to get
+// completions (in which case av shouldn't print anything but the
+// completions).
+func isCompletionCmd(cmd *cobra.Command) bool {
+	return cmd.Name() == cobra.ShellCompRequestCmd || cmd.Name() == cobra.ShellCompNoDescRequestCmd
+}
+
+// completionBranches reads the branch metadata for completions.
+func completionBranches() (*git.Repo, map[string]meta.Branch, bool) {
+	repo, err := getRepo()
+	if err != nil {
+		return nil, nil, false
+	}
+	branches, err := meta.ReadAllBranches(repo)
+	if err != nil {
+		return nil, nil, false
+	}
+	return repo, branches, true
+}
+
+// completeBranches completes the names of the branches that are tracked by av
+// (including the trunk branches that stacks are based on).
+func completeBranches(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	_, branches, ok := completionBranches()
+	if !ok {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	names := make(map[string]string)
+	for name, branch := range branches {
+		description := "parent: " + branch.Parent.Name
+		if branch.PullRequest != nil {
+			description += ", #" + strconv.FormatInt(branch.PullRequest.Number, 10)
+		}
+		names[name] = description
+		if branch.Parent.Trunk {
+			names[branch.Parent.Name] = "trunk"
+		}
+	}
+	var completions []string
+	for name, description := range names {
+		if strings.HasPrefix(name, toComplete) {
+			completions = append(completions, name+"\t"+description)
+		}
+	}
+	sort.Strings(completions)
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeStackOffset returns a completion function for the offset argument of
+// av stack next and av stack prev, where stack returns the branches that the
+// offset counts along (starting at 1).
+func completeStackOffset(
+	stack func(branches map[string]meta.Branch, current string) ([]string, error),
+) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		_, branches, ok := completionBranches()
+		if !ok {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		current, err := cachedRepo.CurrentBranchName()
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		names, err := stack(branches, current)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		completions := make([]string, 0, len(names))
+		for i, name := range names {
+			completions = append(completions, strconv.Itoa(i+1)+"\t"+name)
+		}
+		return completions, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completePullRequests completes the numbers of the open pull requests that
+// are associated with branches tracked by av.
+func completePullRequests(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	_, branches, ok := completionBranches()
+	if !ok {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var completions []string
+	for name, branch := range branches {
+		pull := branch.PullRequest
+		if pull == nil || pull.Number == 0 {
+			continue
+		}
+		// The state is empty if av hasn't fetched it yet.
+		if pull.State != "" && pull.State != githubv4.PullRequestStateOpen {
+			continue
+		}
+		number := strconv.FormatInt(pull.Number, 10)
+		if strings.HasPrefix(number, strings.TrimPrefix(toComplete, "#")) {
+			completions = append(completions, number+"\t"+name)
+		}
+	}
+	sort.Strings(completions)
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeRemotes completes the names of the Git remotes.
+func completeRemotes(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	repo, err := getRepo()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	out, err := repo.Git("remote")
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return strings.Fields(out), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeConfigKeys completes the config keys for av config get/set/unset.
+func completeConfigKeys(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var completions []string
+	for _, key := range config.Keys() {
+		keys := []config.Key{key}
+		if key.IsMap() {
+			keys = key.Entries()
+		}
+		for _, key := range keys {
+			if strings.HasPrefix(strings.ToLower(key.Name), strings.ToLower(toComplete)) {
+				completions = append(completions, key.Name)
+			}
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completePreviousBranches returns the branches that av stack prev <n> counts
+// along (the parent first).
+func completePreviousBranches(branches map[string]meta.Branch, current string) ([]string, error) {
+	previous, err := meta.PreviousBranches(branches, current)
+	for i, j := 0, len(previous)-1; i < j; i, j = i+1, j-1 {
+		previous[i], previous[j] = previous[j], previous[i]
+	}
+	return previous, err
+}
+
+// completeMergeMethods completes the --method flag of av pr land and av pr
+// merge.
+var completeMergeMethods = cobra.FixedCompletions(
+	[]string{"merge", "squash", "rebase"},
+	cobra.ShellCompDirectiveNoFileComp,
+)
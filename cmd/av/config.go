@@ -0,0 +1,426 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/config"
+	"github.com/aviator-co/av/internal/editor"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/spf13/cobra"
+)
+
+var configFlags struct {
+	Global  bool
+	Project bool
+	Repo    bool
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "inspect and edit the av configuration",
+	Long: strings.TrimSpace(`
+Inspect and edit the av configuration.
+
+av reads its configuration from three files (in order of precedence, lowest
+first):
+  1. The global config file, which is the first config file found in
+     $XDG_CONFIG_HOME/av, ~/.config/av, ~/.av, or $AV_HOME
+  2. The project config file, which is committed at the root of the
+     repository as .av.yaml (or .aviator/av.yaml) and is shared with everyone
+     working in the repository
+  3. The repository config file in .git/av, which is not versioned
+
+Since the project config comes with the repository, it can only set the
+pullRequest.*, branch.nameTemplate, and policy.* keys. Other keys (such as
+hooks, credentials, base URLs, or the remote) are ignored with a warning.
+
+The project config can pin settings for everyone working in the repository
+with the policy.pinned key. av warns whenever a pinned setting is overridden
+by the repository config or the environment. For example:
+  pullRequest:
+    rebaseWithDraft: true
+    labels: [stacked]
+  policy:
+    pinned: [pullRequest.rebaseWithDraft, pullRequest.labels]
+
+Every key can also be set with an AV_ environment variable that is named
+after the key (e.g., AV_PULLREQUEST_DRAFT=true for pullRequest.draft or
+AV_GITHUB_BASEURL for gitHub.baseUrl). List values are comma-separated. Hooks
+can only be configured in config files.
+
+In order of precedence (highest first), settings come from:
+  1. Command line flags (e.g., --remote or av pr create --draft)
+  2. Environment variables
+  3. The repository config file
+  4. The project config file
+  5. The global config file
+
+Config files can be written in any format that is supported by viper (e.g.,
+config.yaml, config.json, or config.toml). Keys are case-insensitive and
+nested keys are separated by dots (e.g., pullRequest.draft).
+
+The --global, --project, and --repo flags select the config file to read
+from or write to. Without them, list and get show the effective configuration and set,
+unset, and edit modify the repository config (or the global config outside
+of a repository).
+
+Examples:
+  Show the effective configuration and where each value comes from:
+    $ av config list
+
+  Create pull requests as drafts in every repository:
+    $ av config set --global pullRequest.draft true
+
+  Run a command before branches are pushed:
+    $ av config set hooks.pre-push "make lint"
+`),
+}
+
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "show the configuration values",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		scope, scoped, err := configScope()
+		if err != nil {
+			return err
+		}
+		if scoped {
+			return configListFile(scope)
+		}
+
+		for _, key := range config.Keys() {
+			keys := []config.Key{key}
+			if key.IsMap() {
+				keys = key.Entries()
+			}
+			for _, key := range keys {
+				source := config.Source(key)
+				if source == "" {
+					source = "default"
+				}
+				fmt.Print(key.Name, "=", configDisplayValue(key, key.Value()), "\t", colors.Faint(source), "\n")
+			}
+		}
+		return nil
+	},
+}
+
+func configListFile(scope config.Scope) error {
+	file, err := config.FileForScope(scope)
+	if err != nil {
+		return err
+	}
+	if !file.Exists() {
+		_, _ = fmt.Fprint(os.Stderr,
+			"No ", string(scope), " config file (it would be created at ", colors.UserInput(file.Path), ")\n",
+		)
+		return nil
+	}
+	_, _ = fmt.Fprint(os.Stderr, colors.Faint("# "+file.Path), "\n")
+	names := file.Keys()
+	sort.Strings(names)
+	for _, name := range names {
+		key, err := config.LookupKey(name)
+		if err != nil {
+			key = config.Key{Name: name}
+		}
+		value, _ := file.Get(key)
+		fmt.Print(key.Name, "=", configDisplayValue(key, value), "\n")
+	}
+	configWarnUnknownKeys(file)
+	return nil
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "print the value of a configuration key",
+	Long: strings.TrimSpace(`
+Print the value of a configuration key.
+
+Lists are printed one element per line. The command exits with code 1 if the
+key is not set.
+`),
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key, err := config.LookupKey(args[0])
+		if err != nil {
+			return err
+		}
+		scope, scoped, err := configScope()
+		if err != nil {
+			return err
+		}
+		value := key.Value()
+		if scoped {
+			file, err := config.FileForScope(scope)
+			if err != nil {
+				return err
+			}
+			value, _ = file.Get(key)
+		}
+		if value == nil {
+			return errExitSilently{1}
+		}
+
+		v := reflect.ValueOf(value)
+		if v.Kind() == reflect.Slice {
+			for i := 0; i < v.Len(); i++ {
+				fmt.Println(v.Index(i).Interface())
+			}
+			return nil
+		}
+		fmt.Println(config.FormatValue(value))
+		return nil
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>...",
+	Short: "set a configuration value",
+	Long: strings.TrimSpace(`
+Set a configuration value.
+
+The config file is created (as config.yaml) if it doesn't exist yet and is
+otherwise written in its existing format (JSON, YAML, or TOML). Note that
+comments in the file are not preserved. List values (such as hook commands)
+take one argument per element.
+`),
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key, err := config.LookupKey(args[0])
+		if err != nil {
+			return err
+		}
+		value, err := key.Parse(args[1:])
+		if err != nil {
+			return err
+		}
+		file, err := configWriteFile()
+		if err != nil {
+			return err
+		}
+		if file.Scope == config.ScopeProject && !key.ProjectAllowed() {
+			return errors.Errorf(
+				"%s can't be set in the project config: set it in the repository or global config instead",
+				key.Name,
+			)
+		}
+		if err := file.Set(key, value); err != nil {
+			return err
+		}
+
+		display := config.FormatValue(value)
+		if key.Secret() {
+			display = "<redacted>"
+		}
+		_, _ = fmt.Fprint(os.Stderr,
+			"Set ", colors.UserInput(key.Name), " to ", colors.UserInput(display),
+			" in ", colors.UserInput(file.Path), "\n",
+		)
+		configWarnOverridden(file, key)
+		return nil
+	},
+}
+
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset <key>",
+	Short: "remove a configuration value",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key, err := config.LookupKey(args[0])
+		if err != nil {
+			return err
+		}
+		file, err := configWriteFile()
+		if err != nil {
+			return err
+		}
+		removed, err := file.Unset(key)
+		if err != nil {
+			return err
+		}
+		if !removed {
+			_, _ = fmt.Fprint(os.Stderr,
+				colors.UserInput(key.Name), " is not set in ", colors.UserInput(file.Path), "\n",
+			)
+			return nil
+		}
+		_, _ = fmt.Fprint(os.Stderr,
+			"Removed ", colors.UserInput(key.Name), " from ", colors.UserInput(file.Path), "\n",
+		)
+		configWarnOverridden(file, key)
+		return nil
+	},
+}
+
+var configEditCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "open the config file in an editor",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, err := configWriteFile()
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(file.Path), 0755); err != nil {
+			return errors.WrapIf(err, "failed to create config directory")
+		}
+
+		// Like git, run the editor with the shell so that the editor command
+		// may include arguments (e.g., "code --wait").
+		editCmd := exec.CommandContext(cmd.Context(), "sh", "-c", configEditor()+` "$@"`, "sh", file.Path)
+		editCmd.Stdin = os.Stdin
+		editCmd.Stdout = os.Stdout
+		editCmd.Stderr = os.Stderr
+		if err := editCmd.Run(); err != nil {
+			return errors.WrapIf(err, "editor exited with an error")
+		}
+		if !file.Exists() {
+			return nil
+		}
+		if err := file.Reload(); err != nil {
+			return err
+		}
+		configWarnUnknownKeys(file)
+		return nil
+	},
+}
+
+// configScope returns the scope that was selected with --global, --project,
+// or --repo (if any).
+func configScope() (config.Scope, bool, error) {
+	var scopes []config.Scope
+	if configFlags.Global {
+		scopes = append(scopes, config.ScopeGlobal)
+	}
+	if configFlags.Project {
+		scopes = append(scopes, config.ScopeProject)
+	}
+	if configFlags.Repo {
+		scopes = append(scopes, config.ScopeRepo)
+	}
+	switch len(scopes) {
+	case 0:
+		return "", false, nil
+	case 1:
+		return scopes[0], true, nil
+	default:
+		return "", false, errors.New("--global, --project, and --repo are mutually exclusive")
+	}
+}
+
+// configWriteFile returns the config file that set, unset, and edit modify.
+func configWriteFile() (*config.File, error) {
+	scope, scoped, err := configScope()
+	if err != nil {
+		return nil, err
+	}
+	if !scoped {
+		scope = config.ScopeGlobal
+		if _, err := getRepo(); err == nil {
+			scope = config.ScopeRepo
+		}
+	}
+	return config.FileForScope(scope)
+}
+
+func configDisplayValue(key config.Key, value interface{}) string {
+	display := config.FormatValue(value)
+	if key.Secret() && display != "" {
+		return "<redacted>"
+	}
+	return display
+}
+
+// configWarnOverridden warns the user if the effective value of the key
+// doesn't come from the file (because the environment or a file with higher
+// precedence sets it) or if the key is pinned by the project config.
+func configWarnOverridden(file *config.File, key config.Key) {
+	if source, ok := config.OverriddenBy(file, key); ok {
+		_, _ = fmt.Fprint(os.Stderr,
+			"  - ", colors.Warning("WARNING: "), colors.UserInput(key.Name),
+			" is overridden by ", colors.UserInput(source), "\n",
+		)
+	}
+	if pinnedBy, ok := config.PinnedBy(key); ok && file.Scope != config.ScopeProject {
+		_, _ = fmt.Fprint(os.Stderr,
+			"  - ", colors.Warning("WARNING: "), colors.UserInput(key.Name),
+			" is pinned by ", colors.UserInput(pinnedBy),
+			colors.Troubleshooting(" (the project policy asks everyone to use the same value)"), "\n",
+		)
+	}
+}
+
+func configWarnUnknownKeys(file *config.File) {
+	for _, name := range file.UnknownKeys() {
+		_, _ = fmt.Fprint(os.Stderr,
+			"  - ", colors.Warning("WARNING: "), "unknown config key ", colors.UserInput(name),
+			" in ", colors.UserInput(file.Path), "\n",
+		)
+	}
+	configWarnIgnoredKeys(file)
+}
+
+// configWarnIgnoredKeys warns the user about keys that are set in the file
+// but can't be set in its scope (e.g., hooks in the project config).
+func configWarnIgnoredKeys(file *config.File) {
+	for _, name := range file.IgnoredKeys() {
+		_, _ = fmt.Fprint(os.Stderr,
+			"  - ", colors.Warning("WARNING: "), "ignoring config key ", colors.UserInput(name),
+			" in ", colors.UserInput(file.Path),
+			colors.Troubleshooting(" (it can't be set in the "+string(file.Scope)+" config)"), "\n",
+		)
+	}
+}
+
+func configEditor() string {
+	if repo, err := getRepo(); err == nil {
+		return editor.DefaultCommand(repo)
+	}
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return "vi"
+}
+
+func init() {
+	configCmd.PersistentFlags().BoolVar(
+		&configFlags.Global, "global", false,
+		"use the global config file",
+	)
+	configCmd.PersistentFlags().BoolVar(
+		&configFlags.Project, "project", false,
+		"use the project config file that is committed to the repository",
+	)
+	// Note: this shadows the --repo flag of the root command (which is still
+	// available as -C).
+	configCmd.PersistentFlags().BoolVar(
+		&configFlags.Repo, "repo", false,
+		"use the config file of the repository",
+	)
+	configCmd.PersistentFlags().StringVarP(
+		&rootFlags.Directory, "directory", "C", "",
+		"directory to use for git repository",
+	)
+	_ = configCmd.PersistentFlags().MarkHidden("directory")
+	for _, cmd := range []*cobra.Command{configGetCmd, configSetCmd, configUnsetCmd} {
+		cmd.ValidArgsFunction = completeConfigKeys
+	}
+	configCmd.AddCommand(
+		configEditCmd,
+		configGetCmd,
+		configListCmd,
+		configSetCmd,
+		configUnsetCmd,
+	)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aviator-co/av/internal/actions"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var doctorFlags struct {
+	Fix     bool
+	NoFetch bool
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "check the stack metadata for problems",
+	Long: strings.TrimSpace(`
+Check the stack metadata of every branch for inconsistencies.
+
+This checks for metadata that can't be parsed, branches that are
+(transitively) their own parent, parent and child branches that don't agree
+with each other, metadata for Git branches that were deleted, branches that
+were rebased outside of av, and pull requests that are associated with the
+wrong branch.
+
+If the --fix flag is given, problems that can be repaired safely are fixed
+automatically. Other problems are reported along with an explanation of how to
+fix them manually.
+`),
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, err := getRepo()
+		if err != nil {
+			return err
+		}
+		branches, err := meta.ReadAllBranches(repo)
+		if err != nil {
+			return err
+		}
+
+		problems := meta.Validate(repo, branches)
+		if !doctorFlags.NoFetch {
+			client, err := getClient()
+			if err != nil {
+				return err
+			}
+			pullProblems, err := actions.ValidatePullRequests(cmd.Context(), client, branches)
+			if err != nil {
+				return err
+			}
+			problems = append(problems, pullProblems...)
+		}
+
+		if len(problems) == 0 {
+			_, _ = fmt.Fprint(os.Stderr, colors.Success("No problems found"), "\n")
+			return nil
+		}
+
+		unfixed := 0
+		for _, problem := range problems {
+			_, _ = fmt.Fprint(os.Stderr,
+				"  - ", colors.UserInput(problem.Branch), ": ", problem.Message, "\n",
+			)
+			if problem.Fix == nil {
+				unfixed++
+				continue
+			}
+			if !doctorFlags.Fix {
+				unfixed++
+				_, _ = fmt.Fprint(os.Stderr,
+					"    ", colors.Faint("(can be fixed automatically with "),
+					colors.CliCmd("av doctor --fix"), colors.Faint(")"), "\n",
+				)
+				continue
+			}
+			if err := problem.Fix(repo); err != nil {
+				unfixed++
+				_, _ = fmt.Fprint(os.Stderr,
+					"    ", colors.Failure("failed to fix: "), err.Error(), "\n",
+				)
+				continue
+			}
+			_, _ = fmt.Fprint(os.Stderr, "    ", colors.Success("fixed"), "\n")
+		}
+
+		if unfixed > 0 {
+			_, _ = fmt.Fprint(os.Stderr,
+				"\n", colors.Failure(fmt.Sprintf("Found %d problem(s) that need attention", unfixed)), "\n",
+			)
+			return errExitSilently{1}
+		}
+		return nil
+	},
+}
+
+func init() {
+	doctorCmd.Flags().BoolVar(
+		&doctorFlags.Fix, "fix", false,
+		"automatically repair the problems that can be fixed safely",
+	)
+	doctorCmd.Flags().BoolVar(
+		&doctorFlags.NoFetch, "no-fetch", false,
+		"don't check the pull requests on GitHub",
+	)
+}
+
+// warnOrphanedBranches prints a warning if there is metadata for branches that
+// were renamed or deleted outside of av (e.g., with git branch -m). This is
+// only called by the commands that walk the stack (since it has to read all of
+// the branch metadata).
+func warnOrphanedBranches(repo *git.Repo) {
+	branches, err := meta.ReadAllBranches(repo)
+	if err != nil {
+		logrus.WithError(err).Debug("failed to read branch metadata")
+		return
+	}
+	orphans, err := meta.OrphanedBranchNames(repo, branches)
+	if err != nil {
+		logrus.WithError(err).Debug("failed to determine orphaned branches")
+		return
+	}
+	if len(orphans) == 0 {
+		return
+	}
+	_, _ = fmt.Fprint(os.Stderr,
+		colors.Warning("WARNING:"), " av has metadata for branches that don't exist anymore ",
+		"(they were probably renamed or deleted outside of av): ",
+		colors.UserInput(strings.Join(orphans, ", ")), "\n",
+		"  - run ", colors.CliCmd("av doctor --fix"), " to update the metadata\n",
+	)
+}
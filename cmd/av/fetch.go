@@ -4,107 +4,83 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 
 	"emperror.dev/errors"
-	"github.com/aviator-co/av/internal/config"
-	"github.com/aviator-co/av/internal/gh"
+	"github.com/aviator-co/av/internal/actions"
+	"github.com/aviator-co/av/internal/git"
 	"github.com/aviator-co/av/internal/meta"
 	"github.com/aviator-co/av/internal/utils/colors"
 	"github.com/fatih/color"
-	"github.com/shurcooL/githubv4"
-	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"golang.org/x/exp/maps"
 )
 
+var fetchFlags struct {
+	Rebuild bool
+}
+
 var fetchCmd = &cobra.Command{
 	Use:   "fetch",
 	Short: "fetch latest state from GitHub",
+	Long: strings.TrimSpace(`
+Fetch the latest pull request information from GitHub.
+
+This updates the state of the pull request for every branch that av knows about
+(including pull requests that have been closed or merged) and reports which
+stacks need to be synced because a parent branch was merged.
+
+If the --rebuild flag is given, av reconstructs all of its stack metadata from
+your open pull requests on GitHub (using the metadata that av embeds in each
+pull request body), creating local branches as necessary. This is useful after
+re-cloning a repository or switching to a different machine.
+`),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		repo, info, err := getRepoInfo()
 		if err != nil {
 			return err
 		}
+		if fetchFlags.Rebuild {
+			return fetchRebuild(cmd.Context(), repo, info)
+		}
 		branches, err := meta.ReadAllBranches(repo)
 		if err != nil {
 			return errors.Wrap(err, "failed to read av branch metadata")
 		}
 
-		client, err := getClient(config.Av.GitHub.Token)
+		client, err := getClient()
 		if err != nil {
 			return err
 		}
 
-		ctx := context.Background()
-		var cursor string
+		ctx := cmd.Context()
+		names := maps.Keys(branches)
+		sort.Strings(names)
+		_, _ = fmt.Fprint(
+			os.Stderr,
+			"Fetching pull request information for ", colors.UserInput(len(names)),
+			" branches from GitHub...",
+			"\n",
+		)
 		updatedCount := 0
-		for {
-			prsPage, err := client.RepoPullRequests(ctx, gh.RepoPullRequestOpts{
-				Owner:  info.Owner,
-				Repo:   info.Name,
-				After:  cursor,
-				States: []githubv4.PullRequestState{githubv4.PullRequestStateOpen},
-			})
+		for _, name := range names {
+			res, err := actions.UpdatePullRequestState(ctx, repo, client, info, name)
 			if err != nil {
-				return errors.Wrap(err, "failed to fetch pull requests from GitHub")
+				return errors.WrapIff(err, "failed to fetch pull request information for branch %q", name)
 			}
-			if cursor == "" {
-				// only do this once at the start
-				_, _ = fmt.Fprint(
-					os.Stderr,
-					"Fetching ", colors.UserInput(prsPage.TotalCount),
-					" open pull requests from GitHub...",
-					"\n",
-				)
-			}
-
-			for _, pr := range prsPage.PullRequests {
-				// TODO: maybe warn if local branch is not up-to-date with remote?
-				branchMeta, ok := branches[pr.HeadBranchName()]
-				if !ok {
-					logrus.WithField("branch", pr.HeadBranchName()).Debug("skipping PR for unknown local branch")
-					continue
-				}
-				logrus.WithField("branch", pr.HeadBranchName()).Debug("found PR for known local branch")
-				if branchMeta.PullRequest == nil {
-					_, _ = fmt.Fprint(
-						os.Stderr,
-						"  - Found pull request ", colors.UserInput(pr.Number),
-						" for branch ", colors.UserInput(pr.HeadBranchName()),
-						"\n",
-					)
-				} else if branchMeta.PullRequest.Number != pr.Number {
-					// This shouldn't usually ever happen, not sure what the
-					// best thing to do here, but this handling allows you to
-					// close a PR then open a new one and then run `av fetch`
+			if res.Changed {
+				updatedCount++
+				if res.Branch.MergeCommit != "" {
 					_, _ = fmt.Fprint(
 						os.Stderr,
-						"  - ", color.RedString("WARNING: "),
-						"found new pull request ", colors.UserInput("#", pr.Number, " ", pr.Title),
-						" for branch ", colors.UserInput(pr.HeadBranchName()),
-						", overwriting... ",
-						" (old pull request: ", colors.UserInput("#", branchMeta.PullRequest.Number), ")",
+						"      - pull request ", colors.UserInput("#", res.Branch.PullRequest.Number),
+						" was merged in commit ", colors.UserInput(git.ShortSha(res.Branch.MergeCommit)),
 						"\n",
 					)
-				} else {
-					// nothing to do, we already have the PR stored in metadata
-					continue
-				}
-				updatedCount++
-				branchMeta.PullRequest = &meta.PullRequest{
-					ID:        pr.ID,
-					Number:    pr.Number,
-					Permalink: pr.Permalink,
 				}
-				if err := meta.WriteBranch(repo, branchMeta); err != nil {
-					return errors.Wrap(err, "failed to write branch metadata")
-				}
-			}
-
-			if prsPage.HasNextPage {
-				cursor = prsPage.EndCursor
-			} else {
-				break
 			}
+			branches[name] = res.Branch
 		}
 
 		_, _ = fmt.Fprint(
@@ -112,6 +88,84 @@ var fetchCmd = &cobra.Command{
 			"Updated ", color.GreenString("%d", updatedCount), " pull requests",
 			"\n",
 		)
+
+		needsSync := fetchBranchesNeedingSync(branches)
+		if len(needsSync) > 0 {
+			_, _ = fmt.Fprint(os.Stderr, "\nThe following stacks need to be synced because a parent branch was merged:\n")
+			for _, branch := range needsSync {
+				_, _ = fmt.Fprint(
+					os.Stderr,
+					"  - ", colors.UserInput(branch.Name),
+					" (parent ", colors.UserInput(branch.Parent.Name),
+					" was merged in commit ", colors.UserInput(git.ShortSha(branches[branch.Parent.Name].MergeCommit)), ")",
+					"\n",
+				)
+			}
+			_, _ = fmt.Fprint(os.Stderr,
+				colors.Troubleshooting("      - HINT: run "), colors.CliCmd("av stack sync"),
+				colors.Troubleshooting(" on each of these branches to rebase them onto the trunk\n"),
+			)
+		}
 		return nil
 	},
 }
+
+// fetchBranchesNeedingSync returns the (unmerged) branches whose parent branch
+// has been merged, sorted by name.
+func fetchBranchesNeedingSync(branches map[string]meta.Branch) []meta.Branch {
+	var res []meta.Branch
+	for _, branch := range branches {
+		if branch.MergeCommit != "" || branch.Parent.Trunk {
+			continue
+		}
+		parent, ok := branches[branch.Parent.Name]
+		if !ok || parent.MergeCommit == "" {
+			continue
+		}
+		res = append(res, branch)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+func fetchRebuild(ctx context.Context, repo *git.Repo, repoMeta meta.Repository) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+	res, err := actions.RebuildMetadata(ctx, repo, client, repoMeta)
+	if err != nil {
+		return err
+	}
+
+	for _, conflict := range res.Conflicts {
+		_, _ = fmt.Fprint(os.Stderr,
+			"  - ", color.RedString("WARNING: "),
+			"pull request ", colors.UserInput("#", conflict.Pull.Number, " ", conflict.Pull.Title),
+			" targets ", colors.UserInput(conflict.Pull.BaseBranchName()),
+			" but its av metadata says it is stacked on ", colors.UserInput(conflict.MetadataParent),
+			"\n",
+		)
+	}
+	if len(res.Conflicts) > 0 {
+		_, _ = fmt.Fprint(os.Stderr,
+			colors.Troubleshooting("      - HINT: run "), colors.CliCmd("av stack sync"),
+			colors.Troubleshooting(" to update the base branch of the pull requests above to match the av metadata\n"),
+		)
+	}
+
+	_, _ = fmt.Fprint(os.Stderr,
+		"Rebuilt metadata for ", color.GreenString("%d", len(res.Imported)), " pull requests",
+		"\n",
+	)
+	return nil
+}
+
+func init() {
+	fetchCmd.Flags().BoolVar(
+		&fetchFlags.Rebuild, "rebuild", false,
+		"reconstruct all av metadata from your open pull requests on GitHub",
+	)
+}
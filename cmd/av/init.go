@@ -1,20 +1,44 @@
 package main
 
 import (
-	"context"
 	"fmt"
+	"os"
+	"strings"
 
 	"emperror.dev/errors"
-	"github.com/aviator-co/av/internal/config"
 	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/utils/colors"
 	"github.com/spf13/cobra"
 )
 
 var initFlags struct {
-	Force bool
+	Force      bool
+	PushRemote string
 }
 var initCmd = &cobra.Command{
-	Use: "init",
+	Use:   "init",
+	Short: "initialize the repository for use with av",
+	Long: strings.TrimSpace(`
+Initialize the repository for use with av.
+
+If you can't push to the repository directly, use the --push-remote flag to
+specify the Git remote of your fork. Branches are then pushed to the fork and
+pull requests are opened against the repository of the default remote. Note
+that stacked pull requests aren't supported in this mode since the base branch
+of a pull request must exist in the repository the pull request is opened
+against.
+
+The Git remote that av pushes to and fetches from is origin (or the first
+listed remote) unless a different one is given with the --remote flag or the
+remote config option. The chosen remote is remembered for future commands.
+
+Examples:
+  Use the remote named "upstream":
+    $ av init --remote upstream
+
+  Push branches to the fork at the remote named "fork":
+    $ av init --push-remote fork
+`),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		repo, err := getRepo()
 		if err != nil {
@@ -28,30 +52,53 @@ var initCmd = &cobra.Command{
 			}
 		}
 
-		if config.Av.GitHub.Token == "" {
-			return errors.New("github token must be set")
-		}
-		client, err := getClient(config.Av.GitHub.Token)
+		client, err := getClient()
 		if err != nil {
 			return err
 		}
 
-		// for now we only work with default remote config
+		// This is the remote given by --remote (or the config) if any.
 		remote, err := repo.DefaultRemote()
 		if err != nil {
 			return err
 		}
 
-		ghRepo, err := client.GetRepositoryBySlug(context.Background(), remote.RepoSlug)
+		ghRepo, err := client.GetRepositoryBySlug(cmd.Context(), remote.RepoSlug)
 		if err != nil {
 			return err
 		}
 
-		if err := meta.WriteRepository(repo, meta.Repository{
-			ID:    ghRepo.ID,
-			Owner: ghRepo.Owner.Login,
-			Name:  ghRepo.Name,
-		}); err != nil {
+		repoMeta := meta.Repository{
+			ID:     ghRepo.ID,
+			Owner:  ghRepo.Owner.Login,
+			Name:   ghRepo.Name,
+			Remote: remote.Label,
+		}
+		if initFlags.PushRemote != "" && initFlags.PushRemote != remote.Label {
+			pushRemote, err := repo.Remote(initFlags.PushRemote)
+			if err != nil {
+				return err
+			}
+			fork, err := client.GetRepositoryBySlug(cmd.Context(), pushRemote.RepoSlug)
+			if err != nil {
+				return err
+			}
+			if fork.ID != ghRepo.ID {
+				repoMeta.Fork = &meta.Fork{
+					Remote: pushRemote.Label,
+					ID:     fork.ID,
+					Owner:  fork.Owner.Login,
+					Name:   fork.Name,
+				}
+				_, _ = fmt.Fprint(os.Stderr,
+					"Branches will be pushed to ", colors.UserInput(fork.Owner.Login, "/", fork.Name),
+					" and pull requests opened against ", colors.UserInput(ghRepo.Owner.Login, "/", ghRepo.Name),
+					"\n",
+				)
+			}
+		}
+
+		if err := meta.WriteRepository(repo, repoMeta); err != nil {
 			return errors.WrapIff(err, "failed to write repository metadata")
 		}
 
@@ -62,4 +109,9 @@ var initCmd = &cobra.Command{
 
 func init() {
 	initCmd.Flags().BoolVar(&initFlags.Force, "force", false, "force initialization even if metadata already exists")
+	initCmd.Flags().StringVar(
+		&initFlags.PushRemote, "push-remote", "",
+		"the Git remote of the fork to push branches to (if you can't push to the repository directly)",
+	)
+	_ = initCmd.RegisterFlagCompletionFunc("push-remote", completeRemotes)
 }
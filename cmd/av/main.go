@@ -1,17 +1,24 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/auth"
 	"github.com/aviator-co/av/internal/config"
 	"github.com/aviator-co/av/internal/gh"
 	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/utils/colors"
 	"github.com/fatih/color"
 	"github.com/kr/text"
 	"github.com/sirupsen/logrus"
@@ -22,6 +29,7 @@ import (
 var rootFlags struct {
 	Debug     bool
 	Directory string
+	Remote    string
 }
 
 var rootCmd = &cobra.Command{
@@ -32,11 +40,6 @@ var rootCmd = &cobra.Command{
 	SilenceErrors: true,
 	SilenceUsage:  true,
 
-	// Don't show "completion" command in help menu
-	CompletionOptions: cobra.CompletionOptions{
-		HiddenDefaultCmd: true,
-	},
-
 	// Run setup before invoking any child commands.
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		if rootFlags.Debug {
@@ -44,6 +47,7 @@ var rootCmd = &cobra.Command{
 			logrus.WithField("av_version", config.Version).Debug("enabled debug logging")
 		}
 
+		var projectDir string
 		var configDirs []string
 		repo, err := getRepo()
 		// If we weren't able to load the Git repo, that probably just means the
@@ -52,18 +56,19 @@ var rootCmd = &cobra.Command{
 		if err != nil {
 			logrus.WithError(err).Debug("unable to load Git repo (probably not inside a repo)")
 		} else {
-			gitDir, err := repo.Git("rev-parse", "--git-dir")
-			if err != nil {
-				logrus.WithError(err).Warning("failed to determine git root directory")
-			} else {
-				configDirs = append(configDirs, gitDir)
-			}
-			logrus.WithField("git_dir", gitDir).Debug("loaded Git repo")
+			// The repo-local config is shared between all worktrees. It's
+			// usually in .git/av, but av used to read it from .git directly.
+			configDirs = append(configDirs, filepath.Join(repo.CommonDir(), "av"), repo.CommonDir())
+			projectDir = repo.Dir()
+			logrus.WithFields(logrus.Fields{
+				"git_dir":    repo.GitDir(),
+				"common_dir": repo.CommonDir(),
+			}).Debug("loaded Git repo")
 		}
 
 		// Note: this only returns an error if config exists and it can't be
 		// read/parsed. It doesn't return an error if no config file exists.
-		didLoadConfig, err := config.Load(configDirs)
+		didLoadConfig, err := config.Load(projectDir, configDirs)
 		if err != nil {
 			return errors.Wrap(err, "failed to load configuration")
 		}
@@ -72,6 +77,26 @@ var rootCmd = &cobra.Command{
 		} else {
 			logrus.Debug("no configuration found")
 		}
+		if isCompletionCmd(cmd) {
+			// Anything that's printed would end up in the terminal while the
+			// user is typing.
+			return nil
+		}
+		for _, file := range config.Files() {
+			configWarnIgnoredKeys(file)
+		}
+		for _, violation := range config.PolicyViolations() {
+			_, _ = fmt.Fprint(os.Stderr,
+				colors.Warning("WARNING: "), colors.UserInput(violation.Key.Name),
+				" is pinned to ", colors.UserInput(config.FormatValue(violation.Pinned)),
+				" by ", colors.UserInput(violation.PinnedBy),
+				" but is overridden by ", colors.UserInput(violation.Source), "\n",
+			)
+		}
+
+		if repo != nil {
+			configureRemote(repo)
+		}
 
 		return nil
 	},
@@ -86,9 +111,18 @@ func init() {
 		&rootFlags.Directory, "repo", "C", "",
 		"directory to use for git repository",
 	)
+	rootCmd.PersistentFlags().StringVar(
+		&rootFlags.Remote, "remote", "",
+		"the Git remote to push to and fetch from (default: the remote chosen at av init or origin)",
+	)
+	_ = rootCmd.RegisterFlagCompletionFunc("remote", completeRemotes)
 	rootCmd.AddCommand(
+		authCmd,
+		configCmd,
+		doctorCmd,
 		fetchCmd,
 		initCmd,
+		migrateCmd,
 		prCmd,
 		stackCmd,
 		versionCmd,
@@ -108,17 +142,57 @@ func (e errExitSilently) Error() string {
 	return "<exit silently>"
 }
 
+// exitInterrupted is the exit code used when av is interrupted (by
+// convention, 128 + SIGINT).
+const exitInterrupted = 130
+
+// handleInterrupts cancels the context of the running command when av receives
+// SIGINT or SIGTERM. This gives the command the chance to write its state (or
+// roll back its changes) before exiting. A second signal exits immediately.
+func handleInterrupts(cancel context.CancelFunc) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		_, _ = fmt.Fprint(os.Stderr,
+			"\n", colors.Warning("Interrupted, cleaning up..."),
+			colors.Faint(" (press Ctrl-C again to exit immediately)"), "\n",
+		)
+		cancel()
+		<-signals
+		os.Exit(exitInterrupted)
+	}()
+}
+
 func main() {
 	// Note: this doesn't include whatever time is spent in initializing the
 	// runtime and various packages (e.g., package init functions).
 	startTime := time.Now()
-	err := rootCmd.Execute()
+	ctx, cancel := context.WithCancel(rootCtx)
+	defer cancel()
+	rootCtx = ctx
+	handleInterrupts(cancel)
+	err := rootCmd.ExecuteContext(ctx)
 	logrus.WithField("duration", time.Since(startTime)).Debug("command exited")
+	if cachedRepo != nil {
+		for _, stats := range cachedRepo.Stats() {
+			logrus.WithFields(logrus.Fields{
+				"count":    stats.Count,
+				"duration": stats.Duration,
+			}).Debugf("git %s", stats.Command)
+		}
+		_ = cachedRepo.Close()
+	}
 	checkCliVersion()
 	var exitSilently errExitSilently
 	if errors.As(err, &exitSilently) {
 		os.Exit(exitSilently.exitCode)
 	}
+	if err != nil && ctx.Err() != nil {
+		// The command didn't handle the interrupt itself.
+		_, _ = fmt.Fprint(os.Stderr, colors.Failure("av was interrupted"), "\n")
+		os.Exit(exitInterrupted)
+	}
 	if err != nil {
 		// In debug mode, show more detailed information about the error
 		// (including the stack trace if using pkg/errors).
@@ -158,6 +232,10 @@ func checkCliVersion() {
 	}
 }
 
+// rootCtx is the context of the running command. It's cancelled when av is
+// interrupted (see handleInterrupts).
+var rootCtx = context.Background()
+
 var cachedRepo *git.Repo
 
 func getRepo() (*git.Repo, error) {
@@ -170,7 +248,7 @@ func getRepo() (*git.Repo, error) {
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to determine repo toplevel (are you running inside a Git repo?)")
 		}
-		cachedRepo, err = git.OpenRepo(strings.TrimSpace(string(toplevel)))
+		cachedRepo, err = git.OpenRepo(rootCtx, strings.TrimSpace(string(toplevel)))
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to open git repo")
 		}
@@ -178,13 +256,46 @@ func getRepo() (*git.Repo, error) {
 	return cachedRepo, nil
 }
 
+// configureRemote sets the remote that av uses for the repository. In order of
+// precedence, this is the remote given by the --remote flag, the remote in the
+// config, or the remote that was chosen with av init.
+func configureRemote(repo *git.Repo) {
+	remote := rootFlags.Remote
+	if remote == "" {
+		remote = config.Av.Remote
+	}
+	if remote == "" {
+		if repoMeta, err := meta.ReadRepository(repo); err == nil {
+			remote = repoMeta.Remote
+		}
+	}
+	if remote != "" {
+		logrus.WithField("remote", remote).Debug("using configured Git remote")
+		repo.SetDefaultRemote(remote)
+	}
+}
+
 var once sync.Once
 var lazyGithubClient *gh.Client
+var lazyGithubClientErr error
 
-func getClient(token string) (*gh.Client, error) {
-	var err error
+// getClient returns the GitHub client for the current repository. The GitHub
+// token is discovered the first time this is called (see auth.Resolve).
+func getClient() (*gh.Client, error) {
 	once.Do(func() {
-		lazyGithubClient, err = gh.NewClient(token)
+		repo, err := getRepo()
+		if err != nil {
+			// Not inside a repository, which is fine for commands like
+			// `av auth status`.
+			repo = nil
+		}
+		token, err := auth.Resolve(repo, auth.Host(repo))
+		if err != nil {
+			lazyGithubClientErr = err
+			return
+		}
+		logrus.WithField("source", token.Source).Debug("using GitHub token")
+		lazyGithubClient, lazyGithubClientErr = gh.NewClient(token.Value)
 	})
-	return lazyGithubClient, err
+	return lazyGithubClient, lazyGithubClientErr
 }
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/spf13/cobra"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "upgrade the stack metadata to the latest format",
+	Long: strings.TrimSpace(`
+Rewrite the metadata of every branch (and of the repository) in the latest
+format.
+
+Metadata in older formats is upgraded automatically whenever it is read, so
+this is never strictly required, but it makes sure that the metadata is
+readable without relying on any compatibility behavior.
+`),
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, err := getRepo()
+		if err != nil {
+			return err
+		}
+		res, err := meta.Migrate(repo)
+		if err != nil {
+			return err
+		}
+
+		if res.Repository {
+			_, _ = fmt.Fprint(os.Stderr, "  - upgraded repository metadata\n")
+		}
+		for _, name := range res.Migrated {
+			_, _ = fmt.Fprint(os.Stderr, "  - upgraded metadata for branch ", colors.UserInput(name), "\n")
+		}
+		for _, name := range res.Newer {
+			_, _ = fmt.Fprint(os.Stderr,
+				"  - ", colors.Warning("WARNING:"), " the metadata for branch ", colors.UserInput(name),
+				" was written by a newer version of av (please upgrade av)\n",
+			)
+		}
+		for _, name := range res.Skipped {
+			_, _ = fmt.Fprint(os.Stderr,
+				"  - ", colors.Warning("WARNING:"), " skipped branch ", colors.UserInput(name),
+				" (the parent head couldn't be determined, run ", colors.CliCmd("av doctor"), " for details)\n",
+			)
+		}
+		_, _ = fmt.Fprint(os.Stderr,
+			"Upgraded the metadata of ", colors.UserInput(len(res.Migrated)), " branches to version ",
+			colors.UserInput(meta.BranchSchemaVersion), "\n",
+		)
+		return nil
+	},
+}
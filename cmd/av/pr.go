@@ -1,7 +1,6 @@
 package main
 
 import (
-	"context"
 	"io"
 	"os"
 	"strings"
@@ -49,7 +48,7 @@ Examples:
 		if err != nil {
 			return errors.WrapIf(err, "failed to determine current branch")
 		}
-		client, err := getClient(config.Av.GitHub.Token)
+		client, err := getClient()
 		if err != nil {
 			return err
 		}
@@ -61,11 +60,11 @@ Examples:
 			if err != nil {
 				return errors.Wrap(err, "failed to read body from stdin")
 			}
-			prCreateFlags.Body = string(bodyBytes)
+			body = string(bodyBytes)
 		}
 
 		if _, err := actions.CreatePullRequest(
-			context.Background(), repo, client,
+			cmd.Context(), repo, client,
 			actions.CreatePullRequestOpts{
 				BranchName: branchName,
 				Title:      prCreateFlags.Title,
@@ -86,7 +85,13 @@ Examples:
 }
 
 func init() {
-	prCmd.AddCommand(prCreateCmd)
+	prCmd.AddCommand(
+		prCheckoutCmd,
+		prCreateCmd,
+		prEditCmd,
+		prLandCmd,
+		prMergeCmd,
+	)
 
 	// av pr create
 	prCreateCmd.Flags().StringVar(
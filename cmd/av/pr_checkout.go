@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/actions"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/spf13/cobra"
+)
+
+var prCheckoutFlags struct {
+	Descendants bool
+}
+var prCheckoutCmd = &cobra.Command{
+	Use:   "checkout <number|url>",
+	Short: "check out the stack for a pull request",
+	Long: strings.TrimSpace(`
+Check out the branch for a pull request along with every branch in the stack
+that it depends on.
+
+This creates local branches for the pull request and every pull request it is
+stacked on top of (following the metadata embedded by av in each pull request
+body down to the trunk) and records the stack structure so that commands like
+av stack tree and av stack sync work immediately.
+
+If the --descendants flag is given, pull requests that are stacked on top of
+the given pull request are checked out as well.
+
+Examples:
+  Check out pull request #123:
+    $ av pr checkout 123
+
+  Check out a pull request by URL (including the pull requests stacked on it):
+    $ av pr checkout --descendants https://github.com/my-org/my-repo/pull/123
+`),
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, repoMeta, err := getRepoInfo()
+		if err != nil {
+			return err
+		}
+		number, err := parsePullRequestArg(repoMeta, args[0])
+		if err != nil {
+			return err
+		}
+		client, err := getClient()
+		if err != nil {
+			return err
+		}
+		_, err = actions.CheckoutPullRequest(cmd.Context(), repo, client, repoMeta, actions.CheckoutPullRequestOpts{
+			Number:      number,
+			Descendants: prCheckoutFlags.Descendants,
+		})
+		return err
+	},
+}
+
+var pullRequestPathRegex = regexp.MustCompile(`^/([^/]+)/([^/]+)/pull/(\d+)`)
+
+// parsePullRequestArg parses a pull request number from a command line argument
+// that is either a number (optionally prefixed with #) or a pull request URL.
+func parsePullRequestArg(repoMeta meta.Repository, arg string) (int64, error) {
+	if number, err := strconv.ParseInt(strings.TrimPrefix(arg, "#"), 10, 64); err == nil {
+		return number, nil
+	}
+
+	u, err := url.Parse(arg)
+	if err != nil {
+		return 0, errors.Errorf("invalid pull request %q (expected a number or URL)", arg)
+	}
+	matches := pullRequestPathRegex.FindStringSubmatch(u.Path)
+	if matches == nil {
+		return 0, errors.Errorf("invalid pull request URL %q", arg)
+	}
+	if !strings.EqualFold(matches[1], repoMeta.Owner) || !strings.EqualFold(matches[2], repoMeta.Name) {
+		return 0, errors.Errorf(
+			"pull request %q does not belong to this repository (%s/%s)",
+			arg, repoMeta.Owner, repoMeta.Name,
+		)
+	}
+	return strconv.ParseInt(matches[3], 10, 64)
+}
+
+func init() {
+	prCheckoutCmd.Flags().BoolVar(
+		&prCheckoutFlags.Descendants, "descendants", false,
+		"also check out the pull requests that are stacked on top of the pull request",
+	)
+	prCheckoutCmd.ValidArgsFunction = completePullRequests
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/actions"
+	"github.com/spf13/cobra"
+)
+
+var prEditFlags struct {
+	Title string
+	Body  string
+}
+var prEditCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "edit the pull request for the current branch",
+	Long: strings.TrimSpace(`
+Edit the title and body of the pull request for the current branch.
+
+Unless the --title or --body flags are given, this opens a text editor with the
+current title and body of the pull request. The metadata that av embeds in the
+pull request body is preserved.
+
+Examples:
+  Edit the pull request in a text editor:
+    $ av pr edit
+
+  Remove the body of the pull request:
+    $ av pr edit --body ""
+
+  Replace the body of the pull request from standard input:
+    $ av pr edit --body - <<EOF
+    > Implement my very fancy feature.
+    > EOF
+`),
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, err := getRepo()
+		if err != nil {
+			return err
+		}
+		branchName, err := repo.CurrentBranchName()
+		if err != nil {
+			return errors.WrapIf(err, "failed to determine current branch")
+		}
+		client, err := getClient()
+		if err != nil {
+			return err
+		}
+
+		opts := actions.EditPullRequestOpts{BranchName: branchName}
+		if cmd.Flags().Changed("title") {
+			opts.Title = &prEditFlags.Title
+		}
+		// Use Changed (rather than checking for an empty string) so that
+		// --body "" clears the body.
+		if cmd.Flags().Changed("body") {
+			body := prEditFlags.Body
+			// Special case: read body from stdin
+			if body == "-" {
+				bodyBytes, err := io.ReadAll(os.Stdin)
+				if err != nil {
+					return errors.Wrap(err, "failed to read body from stdin")
+				}
+				body = string(bodyBytes)
+			}
+			opts.Body = &body
+		}
+
+		_, err = actions.EditPullRequest(cmd.Context(), repo, client, opts)
+		return err
+	},
+}
+
+func init() {
+	prEditCmd.Flags().StringVarP(
+		&prEditFlags.Title, "title", "t", "",
+		"new title of the pull request",
+	)
+	prEditCmd.Flags().StringVarP(
+		&prEditFlags.Body, "body", "b", "",
+		"new body of the pull request (a value of - will read from stdin)",
+	)
+}
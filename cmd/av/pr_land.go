@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/actions"
+	"github.com/aviator-co/av/internal/config"
+	"github.com/aviator-co/av/internal/gh"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var prLandFlags struct {
+	Method string
+}
+var prLandCmd = &cobra.Command{
+	Use:   "land",
+	Short: "safely merge the pull request at the bottom of a stack",
+	Long: strings.TrimSpace(`
+Merge the pull request for the current branch and wait for it to land. av
+stops waiting (with an error) if auto-merge is disabled, if the pull request is
+blocked or has conflicts, or if it isn't merged within two hours.
+
+Before the pull request is merged, the pull requests of the branches that are
+stacked directly on top of the current branch are re-targeted onto the trunk.
+Otherwise, GitHub closes those pull requests if it automatically deletes the
+merged branch. If the pull request isn't merged (because merging fails, the
+pull request is closed, or the command is interrupted), auto-merge is disabled
+and the stacked pull requests are moved back onto the current branch.
+
+After the pull request is merged, run av stack sync to rebase the rest of the
+stack onto the merge commit.
+`),
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		repo, repoMeta, err := getRepoInfo()
+		if err != nil {
+			return err
+		}
+		warnOrphanedBranches(repo)
+		client, err := getClient()
+		if err != nil {
+			return err
+		}
+
+		methodName := prLandFlags.Method
+		if methodName == "" {
+			methodName = config.Av.PullRequest.MergeMethod
+		}
+		method, err := parseMergeMethod(methodName)
+		if err != nil {
+			return err
+		}
+
+		currentBranch, err := repo.CurrentBranchName()
+		if err != nil {
+			return err
+		}
+		branch, _ := meta.ReadBranch(repo, currentBranch)
+		if !branch.Parent.Trunk {
+			return errors.Errorf(
+				"branch %q is not at the bottom of its stack (land %q first)",
+				currentBranch, branch.Parent.Name,
+			)
+		}
+
+		// The original base branches of the child pull requests (by branch
+		// name), which are restored if the pull request isn't merged.
+		var childBases map[string]string
+		if len(branch.Children) > 0 {
+			_, _ = fmt.Fprint(os.Stderr,
+				"Re-targeting stacked pull requests onto ", colors.UserInput(branch.Parent.Name), ":\n",
+			)
+			childBases, err = retargetLandChildren(ctx, repo, client, repoMeta, branch)
+			if err != nil {
+				restoreLandChildren(repo, client, repoMeta, branch, childBases)
+				return err
+			}
+		}
+
+		if _, err := actions.MergePullRequest(ctx, repo, client, nil, repoMeta, actions.MergePullRequestOpts{
+			BranchName: currentBranch,
+			Method:     method,
+			Wait:       true,
+		}); err != nil {
+			restoreLandChildren(repo, client, repoMeta, branch, childBases)
+			return err
+		}
+
+		if len(branch.Children) > 0 {
+			_, _ = fmt.Fprint(os.Stderr,
+				colors.Troubleshooting("  - HINT: run "), colors.CliCmd("av stack sync"),
+				colors.Troubleshooting(" to rebase the rest of the stack onto the merge commit\n"),
+			)
+		}
+		return nil
+	},
+}
+
+// retargetLandChildren re-targets the pull requests of the children of the
+// branch onto the trunk. It returns the previous base branch of every pull
+// request that it (possibly) changed.
+func retargetLandChildren(
+	ctx context.Context, repo *git.Repo, client *gh.Client,
+	repoMeta meta.Repository, branch meta.Branch,
+) (map[string]string, error) {
+	bases := make(map[string]string)
+	for _, childName := range branch.Children {
+		child, _ := meta.ReadBranch(repo, childName)
+		if child.PullRequest == nil || child.PullRequest.ID == "" || child.MergeCommit != "" {
+			continue
+		}
+		pull, err := client.PullRequest(ctx, child.PullRequest.ID)
+		if err != nil {
+			return bases, errors.WrapIff(err, "failed to fetch pull request info for %q", childName)
+		}
+		if pull.State == githubv4.PullRequestStateOpen && pull.BaseBranchName() != branch.Parent.Name {
+			bases[childName] = pull.BaseBranchName()
+		}
+		if _, _, err := actions.RetargetPullRequest(ctx, repo, client, repoMeta, child, pull, branch.Parent.Name); err != nil {
+			return bases, err
+		}
+	}
+	return bases, nil
+}
+
+// restoreLandChildren moves the child pull requests back onto their original
+// base branches after the pull request of the branch failed to merge (or the
+// user interrupted the command). Otherwise, the child pull requests would
+// include the changes of the branch. Auto-merge is disabled first since the
+// children would be closed if the branch was merged (and deleted) afterwards.
+func restoreLandChildren(
+	repo *git.Repo, client *gh.Client, repoMeta meta.Repository,
+	branch meta.Branch, bases map[string]string,
+) {
+	if len(bases) == 0 {
+		return
+	}
+	// The command context might already be cancelled.
+	ctx := context.Background()
+	repo = repo.WithContext(ctx)
+
+	branch, _ = meta.ReadBranch(repo, branch.Name)
+	if branch.PullRequest != nil && branch.PullRequest.ID != "" {
+		pull, err := client.PullRequest(ctx, branch.PullRequest.ID)
+		if err != nil {
+			logrus.WithError(err).Warn("failed to fetch pull request info")
+			return
+		}
+		if pull.State == githubv4.PullRequestStateMerged {
+			return
+		}
+		if pull.AutoMergeRequest != nil {
+			if _, err := client.DisablePullRequestAutoMerge(ctx, githubv4.DisablePullRequestAutoMergeInput{
+				PullRequestID: pull.ID,
+			}); err != nil {
+				_, _ = fmt.Fprint(os.Stderr,
+					"  - ", colors.Failure("failed to disable auto-merge"), " for pull request ",
+					colors.UserInput(pull.Permalink), ": ", err, "\n",
+				)
+				return
+			}
+			_, _ = fmt.Fprint(os.Stderr,
+				"  - disabled auto-merge for pull request ", colors.UserInput(pull.Permalink), "\n",
+			)
+		}
+	}
+
+	_, _ = fmt.Fprint(os.Stderr, "Restoring the base branches of stacked pull requests:\n")
+	for _, childName := range branch.Children {
+		base, ok := bases[childName]
+		if !ok {
+			continue
+		}
+		child, _ := meta.ReadBranch(repo, childName)
+		if _, _, err := actions.RetargetPullRequest(ctx, repo, client, repoMeta, child, nil, base); err != nil {
+			_, _ = fmt.Fprint(os.Stderr,
+				"  - ", colors.Failure("failed to restore base branch"), " of ",
+				colors.UserInput(childName), ": ", err, "\n",
+			)
+		}
+	}
+}
+
+func init() {
+	prLandCmd.Flags().StringVar(
+		&prLandFlags.Method, "method", "",
+		"the merge method to use (merge, squash, or rebase)",
+	)
+	_ = prLandCmd.RegisterFlagCompletionFunc("method", completeMergeMethods)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/actions"
+	"github.com/aviator-co/av/internal/aviator"
+	"github.com/aviator-co/av/internal/config"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/shurcooL/githubv4"
+	"github.com/spf13/cobra"
+)
+
+var prMergeFlags struct {
+	Stack  bool
+	Queue  bool
+	Method string
+	Wait   bool
+}
+var prMergeCmd = &cobra.Command{
+	Use:   "merge",
+	Short: "merge the pull request for the current branch",
+	Long: strings.TrimSpace(`
+Merge the pull request for the current branch.
+
+By default, this enables GitHub auto-merge for the pull request (or merges it
+immediately if it can already be merged). If the --queue flag is given, the
+pull request is queued in the Aviator MergeQueue instead.
+
+If the --stack flag is given, every pull request in the current stack is merged
+from the bottom up. After each pull request is merged, the next branch in the
+stack is synced onto the merge commit (and its pull request re-targeted onto
+the trunk branch) before it is merged in turn.
+If syncing a branch results in a conflict, resolve it and finish the sync with
+av stack sync --continue, then run av pr merge --stack again to merge the
+rest of the stack (pull requests that were already merged are skipped).
+
+Examples:
+  Merge the pull request for the current branch using a squash merge:
+    $ av pr merge --method squash
+
+  Queue every pull request in the current stack with the Aviator MergeQueue:
+    $ av pr merge --stack --queue
+`),
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		repo, repoMeta, err := getRepoInfo()
+		if err != nil {
+			return err
+		}
+		warnOrphanedBranches(repo)
+		client, err := getClient()
+		if err != nil {
+			return err
+		}
+		var aviatorClient *aviator.Client
+		if prMergeFlags.Queue {
+			aviatorClient, err = aviator.NewClient(config.Av.Aviator.BaseUrl, config.Av.Aviator.APIToken)
+			if err != nil {
+				return err
+			}
+		}
+
+		methodName := prMergeFlags.Method
+		if methodName == "" {
+			methodName = config.Av.PullRequest.MergeMethod
+		}
+		method, err := parseMergeMethod(methodName)
+		if err != nil {
+			return err
+		}
+
+		currentBranch, err := repo.CurrentBranchName()
+		if err != nil {
+			return err
+		}
+
+		if !prMergeFlags.Stack {
+			_, err := actions.MergePullRequest(ctx, repo, client, aviatorClient, repoMeta, actions.MergePullRequestOpts{
+				BranchName: currentBranch,
+				Method:     method,
+				Queue:      prMergeFlags.Queue,
+				Wait:       prMergeFlags.Wait,
+			})
+			return err
+		}
+
+		// Merging a stack might require us to rebase branches, so we need a
+		// clean working tree.
+		diff, err := repo.Diff(&git.DiffOpts{Quiet: true})
+		if err != nil {
+			return err
+		}
+		if !diff.Empty {
+			return errors.New("refusing to merge stack: there are unstaged changes in the working tree (use `git add` to stage changes)")
+		}
+
+		branches, err := meta.ReadAllBranches(repo)
+		if err != nil {
+			return err
+		}
+		root, ok := meta.FindStackRoot(branches, currentBranch)
+		if !ok {
+			return errors.Errorf("branch %q is not part of a stack", currentBranch)
+		}
+		subsequentBranches, err := meta.SubsequentBranches(branches, root.Name)
+		if err != nil {
+			return err
+		}
+		branchesToMerge := append([]string{root.Name}, subsequentBranches...)
+
+		for i, branchName := range branchesToMerge {
+			if i > 0 {
+				// Add spacing in the output between each branch
+				_, _ = fmt.Fprint(os.Stderr, "\n\n")
+			}
+			branch, _ := meta.ReadBranch(repo, branchName)
+			if branch.MergeCommit != "" {
+				_, _ = fmt.Fprint(os.Stderr,
+					"Skipping branch ", colors.UserInput(branchName),
+					" (already merged in commit ", colors.UserInput(git.ShortSha(branch.MergeCommit)), ")\n",
+				)
+				continue
+			}
+
+			// The parent of this branch was merged in a previous iteration, so
+			// we have to sync this branch onto the merge commit (which also
+			// updates the pull request to target the trunk) before we can
+			// merge it.
+			if !branch.Parent.Trunk {
+				res, err := actions.SyncBranch(ctx, repo, client, repoMeta, actions.SyncBranchOpts{
+					Branch: branchName,
+				})
+				if err != nil {
+					return err
+				}
+				if res.Status == git.RebaseConflict {
+					state := stackSyncState{
+						OriginalBranch: currentBranch,
+						CurrentBranch:  branchName,
+						Branches:       branchesToMerge[i:],
+						Continuation:   res.Continuation,
+						MergeStack:     true,
+					}
+					if err := writeStackSyncState(repo, &state); err != nil {
+						return errors.Wrap(err, "failed to write stack sync state")
+					}
+					_, _ = fmt.Fprint(os.Stderr,
+						"  - after the sync is complete, run ", colors.CliCmd("av pr merge --stack"),
+						" again to merge the rest of the stack\n",
+					)
+					return errExitSilently{1}
+				}
+			}
+
+			if _, err := actions.MergePullRequest(ctx, repo, client, aviatorClient, repoMeta, actions.MergePullRequestOpts{
+				BranchName: branchName,
+				Method:     method,
+				Queue:      prMergeFlags.Queue,
+				// We have to wait for the merge here since the next branch in
+				// the stack can't be merged until this one lands.
+				Wait: true,
+			}); err != nil {
+				return err
+			}
+		}
+
+		// Syncing might have checked out other branches
+		if _, err := repo.CheckoutBranch(&git.CheckoutBranch{Name: currentBranch}); err != nil {
+			return err
+		}
+		return nil
+	},
+}
+
+func parseMergeMethod(name string) (githubv4.PullRequestMergeMethod, error) {
+	switch strings.ToLower(name) {
+	case "":
+		return "", nil
+	case "merge":
+		return githubv4.PullRequestMergeMethodMerge, nil
+	case "squash":
+		return githubv4.PullRequestMergeMethodSquash, nil
+	case "rebase":
+		return githubv4.PullRequestMergeMethodRebase, nil
+	default:
+		return "", errors.Errorf("invalid merge method %q (expected one of merge, squash, or rebase)", name)
+	}
+}
+
+func init() {
+	prMergeCmd.Flags().BoolVar(
+		&prMergeFlags.Stack, "stack", false,
+		"merge every pull request in the current stack (from the bottom up)",
+	)
+	prMergeCmd.Flags().BoolVar(
+		&prMergeFlags.Queue, "queue", false,
+		"queue the pull request(s) in the Aviator MergeQueue instead of using GitHub auto-merge",
+	)
+	prMergeCmd.Flags().StringVar(
+		&prMergeFlags.Method, "method", "",
+		"the merge method to use (merge, squash, or rebase)",
+	)
+	_ = prMergeCmd.RegisterFlagCompletionFunc("method", completeMergeMethods)
+	prMergeCmd.Flags().BoolVar(
+		&prMergeFlags.Wait, "wait", false,
+		"wait for the pull request to be merged\n(always enabled with --stack)",
+	)
+}
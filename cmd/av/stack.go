@@ -14,9 +14,12 @@ func init() {
 		stackBranchCmd,
 		stackNextCmd,
 		stackPrevCmd,
+		stackPullMetaCmd,
+		stackPushMetaCmd,
 		stackReparentCmd,
 		stackSyncCmd,
 		stackSubmitCmd,
+		stackSwitchCmd,
 		stackTreeCmd,
 	)
 }
@@ -1,11 +1,22 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
 	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/config"
 	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/hooks"
 	"github.com/aviator-co/av/internal/meta"
 	"github.com/aviator-co/av/internal/utils/cleanup"
-	"github.com/aviator-co/av/internal/utils/sliceutils"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/aviator-co/av/internal/utils/stringutils"
+	"github.com/aviator-co/av/internal/utils/templateutils"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -18,23 +29,43 @@ var stackBranchFlags struct {
 	// avoid that language here since we're not changing the branch's position
 	// within the stack).
 	Rename bool
+	// If set, commit the staged changes with this message on the new branch.
+	// The branch name is generated from the message if it's not given.
+	Message string
 }
 var stackBranchCmd = &cobra.Command{
-	Use:   "branch [flags] <branch-name>",
+	Use:   "branch [flags] [<branch-name>]",
 	Short: "create a new stacked branch",
 	Long: `Create a new branch that is stacked on the current branch.
 
-If the --rename/-m flag is given, the current branch is renamed to the name
-given as the first argument to the command. Branches should only be renamed
-with this command (not with git branch -m ...) because av needs to update
-internal tracking metadata that defines the order of branches within a stack.`,
+If the --message/-m flag is given, the staged changes are committed on the new
+branch with the given commit message. The branch name may be omitted in that
+case, and it's generated from the commit message using the
+branch.nameTemplate config (a Go template, see av config). For example, with
+the template "{{.User}}/{{.Slug}}", av stack branch -m "Fix the login page"
+creates the branch jane/fix-the-login-page. If a branch with the generated name
+already exists, a numeric suffix is added.
+
+If the --rename flag is given, the current branch is renamed to the name given
+as the first argument to the command. Note that -m used to be the shorthand for
+--rename (like git branch -m) and is now the shorthand for --message, so use
+av stack branch --rename <new-name> to rename a branch. Branches should only be
+renamed with this command (not with git branch -m ...) because av needs to
+update internal tracking metadata that defines the order of branches within a
+stack.`,
 	SilenceUsage: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if len(args) != 1 {
+		if len(args) > 1 || (len(args) == 0 && stackBranchFlags.Message == "") {
 			_ = cmd.Usage()
-			return errors.New("exactly one branch name is required")
+			return errors.New("exactly one branch name is required (unless --message is given)")
+		}
+		if stackBranchFlags.Rename && stackBranchFlags.Message != "" {
+			return errors.New("--rename and --message are mutually exclusive")
+		}
+		var branchName string
+		if len(args) == 1 {
+			branchName = args[0]
 		}
-		branchName := args[0]
 
 		repo, err := getRepo()
 		if err != nil {
@@ -45,6 +76,28 @@ internal tracking metadata that defines the order of branches within a stack.`,
 			return stackBranchMove(repo, branchName)
 		}
 
+		if stackBranchFlags.Message != "" {
+			// Check this before creating the branch: committing is the whole
+			// point of --message.
+			res, err := repo.Run(&git.RunOpts{Args: []string{"diff", "--cached", "--quiet"}})
+			if err != nil {
+				return err
+			}
+			if res.ExitCode == 0 {
+				if len(args) == 0 && !strings.ContainsAny(stackBranchFlags.Message, " \t\n") {
+					// -m used to be the shorthand for --rename (like git branch
+					// -m), so this is most likely an attempt to rename the branch.
+					_, _ = fmt.Fprint(os.Stderr,
+						colors.Failure("No staged changes to commit."), "\n",
+						"  - -m is short for --message; to rename the current branch, use ",
+						colors.CliCmd("av stack branch --rename ", stackBranchFlags.Message), "\n",
+					)
+					return errExitSilently{1}
+				}
+				return errors.New("no staged changes to commit (use git add to stage changes)")
+			}
+		}
+
 		// Determine important contextual information from Git
 		defaultBranch, err := repo.DefaultBranch()
 		if err != nil {
@@ -62,6 +115,9 @@ internal tracking metadata that defines the order of branches within a stack.`,
 				return errors.WrapIf(err, "failed to checkout parent branch")
 			}
 			cu.Add(func() {
+				// This might run because av was interrupted, in which case the
+				// repo's context is already cancelled.
+				repo := repo.WithContext(context.Background())
 				if _, err := repo.CheckoutBranch(&git.CheckoutBranch{Name: origBranch}); err != nil {
 					logrus.WithError(err).Warn("cleanup error: failed to return to original branch")
 				}
@@ -84,6 +140,21 @@ internal tracking metadata that defines the order of branches within a stack.`,
 			return errors.WrapIf(err, "failed to read parent branch state")
 		}
 
+		if branchName == "" {
+			branchName, err = stackBranchGenerateName(repo, parentBranchName, stackBranchFlags.Message)
+			if err != nil {
+				return err
+			}
+		}
+
+		branchMeta := meta.Branch{
+			Name:   branchName,
+			Parent: parentState,
+		}
+		if err := hooks.Run(cmd.Context(), repo, hooks.PreBranch, branchMeta); err != nil {
+			return err
+		}
+
 		// Create a new branch off of the parent
 		logrus.WithFields(logrus.Fields{
 			"parent":     parentBranchName,
@@ -96,91 +167,167 @@ internal tracking metadata that defines the order of branches within a stack.`,
 			return errors.WrapIff(err, "checkout error")
 		}
 
-		branchMeta := meta.Branch{
-			Name:   branchName,
-			Parent: parentState,
-		}
+		tx := meta.NewTx(repo)
 		logrus.WithField("meta", branchMeta).Debug("writing branch metadata")
-		if err := meta.WriteBranch(repo, branchMeta); err != nil {
-			return errors.WrapIff(err, "failed to write av internal metadata for branch %q", branchName)
-		}
+		tx.WriteBranch(branchMeta)
 
 		// If this isn't a new stack root, update the parent metadata to include
 		// the new branch as a child.
 		if !isBranchFromTrunk {
-			parentMeta, _ := meta.ReadBranch(repo, parentBranchName)
+			parentMeta, _ := tx.ReadBranch(parentBranchName)
 			parentMeta.Children = append(parentMeta.Children, branchName)
 			logrus.WithField("meta", parentMeta).Debug("writing parent branch metadata")
-			if err := meta.WriteBranch(repo, parentMeta); err != nil {
-				return errors.WrapIf(err, "failed to write parent branch metadata")
-			}
+			tx.WriteBranch(parentMeta)
+		}
+		if err := tx.Commit(); err != nil {
+			return errors.WrapIff(err, "failed to write av internal metadata for branch %q", branchName)
 		}
 
 		cu.Cancel()
+		if stackBranchFlags.Message != "" {
+			_, _ = fmt.Fprint(os.Stderr, "  - created branch ", colors.UserInput(branchName), "\n")
+			if _, err := repo.Run(&git.RunOpts{
+				Args:      []string{"commit", "--message", stackBranchFlags.Message},
+				ExitError: true,
+			}); err != nil {
+				return errors.WrapIff(err, "created branch %q but failed to commit the staged changes", branchName)
+			}
+			_, _ = fmt.Fprint(os.Stderr, "  - committed the staged changes\n")
+		}
+		hooks.RunPost(cmd.Context(), repo, hooks.PostBranch, branchMeta)
 		return nil
 	},
 }
 
 func init() {
 	stackBranchCmd.Flags().StringVar(&stackBranchFlags.Parent, "parent", "", "the parent branch to base the new branch off of")
-	// NOTE: We use -m as the shorthand here to match `git branch -m ...`.
-	// See the comment on stackBranchFlags.Rename.
-	stackBranchCmd.Flags().BoolVarP(&stackBranchFlags.Rename, "rename", "m", false, "rename the current branch")
+	stackBranchCmd.Flags().BoolVar(&stackBranchFlags.Rename, "rename", false, "rename the current branch")
+	// NOTE: We use -m as the shorthand here to match `git commit -m ...`.
+	stackBranchCmd.Flags().StringVarP(
+		&stackBranchFlags.Message, "message", "m", "",
+		"commit the staged changes with this message (and generate the branch name from it if it's not given)",
+	)
+	stackBranchCmd.ValidArgsFunction = cobra.NoFileCompletions
+	_ = stackBranchCmd.RegisterFlagCompletionFunc("parent", completeBranches)
 }
 
-func stackBranchMove(repo *git.Repo, newBranch string) error {
-	oldBranch, err := repo.CurrentBranchName()
+// stackBranchNameData is the data that is available to the branch name
+// template (see config.Branch.NameTemplate).
+type stackBranchNameData struct {
+	// The local part of the Git user email (e.g., "jane" for
+	// jane@example.com).
+	User  string
+	Email string
+	Date  time.Time
+	// The commit message and its slugified subject.
+	Message string
+	Slug    string
+	Parent  string
+}
+
+// maxBranchSlugLength is the maximum length of the slug in generated branch
+// names (commit subjects can be quite long).
+const maxBranchSlugLength = 50
+
+// stackBranchGenerateName generates the name of a new branch from the commit
+// message using the branch name template. If a branch with that name already
+// exists, a numeric suffix is added.
+func stackBranchGenerateName(repo *git.Repo, parent string, message string) (string, error) {
+	tmpl, err := template.New("branch.nameTemplate").
+		Funcs(template.FuncMap{
+			"slugify": func(s string) string { return stringutils.Slugify(s, 0) },
+		}).
+		Parse(config.Av.Branch.NameTemplate)
 	if err != nil {
-		return err
+		return "", errors.WrapIf(err, "invalid branch.nameTemplate config")
 	}
-
-	if oldBranch == newBranch {
-		return errors.Errorf("cannot rename branch to itself")
+	// Git exits with a non-zero code if user.email isn't set, which is fine.
+	email, _ := repo.Git("config", "user.email")
+	user, _, _ := strings.Cut(email, "@")
+	subject, _ := stringutils.ParseSubjectBody(message)
+	data := stackBranchNameData{
+		User:    strings.ToLower(user),
+		Email:   email,
+		Date:    time.Now(),
+		Message: message,
+		Slug:    stringutils.Slugify(subject, maxBranchSlugLength),
+		Parent:  parent,
 	}
-
-	currentMeta, _ := meta.ReadBranch(repo, oldBranch)
-	currentMeta.Name = newBranch
-	if err := meta.DeleteBranch(repo, oldBranch); err != nil {
-		return err
+	if data.Slug == "" {
+		return "", errors.Errorf("cannot generate a branch name from the commit message %q", message)
 	}
-	if err := meta.WriteBranch(repo, currentMeta); err != nil {
-		return err
+	name, err := templateutils.String(tmpl, data)
+	if err != nil {
+		return "", errors.WrapIf(err, "failed to execute branch.nameTemplate config")
+	}
+	name = strings.TrimSpace(name)
+	if _, err := repo.Git("check-ref-format", "--branch", name); err != nil {
+		return "", errors.Errorf("branch.nameTemplate generated an invalid branch name %q", name)
 	}
 
-	// Update the parent's reference to the child (unless the parent is a trunk
-	// which doesn't maintain references to children).
-	if !currentMeta.Parent.Trunk {
-		parentMeta, _ := meta.ReadBranch(repo, currentMeta.Parent.Name)
-		sliceutils.Replace(parentMeta.Children, oldBranch, newBranch)
-		if err := meta.WriteBranch(repo, parentMeta); err != nil {
-			return err
+	unique := name
+	for i := 2; ; i++ {
+		taken, err := stackBranchNameTaken(repo, unique)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			break
 		}
+		unique = fmt.Sprintf("%s-%d", name, i)
 	}
+	logrus.WithFields(logrus.Fields{"template": config.Av.Branch.NameTemplate, "name": unique}).
+		Debug("generated branch name")
+	return unique, nil
+}
 
-	// Update all child branches to refer to the correct (renamed) parent.
-	for _, child := range currentMeta.Children {
-		childMeta, _ := meta.ReadBranch(repo, child)
-		childMeta.Parent.Name = newBranch
-		if err := meta.WriteBranch(repo, childMeta); err != nil {
-			return err
+// stackBranchNameTaken returns true if a branch with the name exists or if
+// there's (possibly stale) av metadata for a branch with the name, which would
+// otherwise be picked up by the new branch.
+func stackBranchNameTaken(repo *git.Repo, name string) (bool, error) {
+	for _, ref := range []string{"refs/heads/" + name, "refs/av/branch-metadata/" + name} {
+		res, err := repo.Run(&git.RunOpts{Args: []string{"show-ref", "--verify", "--quiet", ref}})
+		if err != nil {
+			return false, err
+		}
+		if res.ExitCode == 0 {
+			return true, nil
 		}
 	}
+	return false, nil
+}
+
+func stackBranchMove(repo *git.Repo, newBranch string) error {
+	oldBranch, err := repo.CurrentBranchName()
+	if err != nil {
+		return err
+	}
 
-	// Finally, actually rename the branch in Git
-	// TODO:
-	// 		It would be really nice to have some kind of atomicity and/or
-	//		transactionality with the branch metadatas. Maybe instead of just
-	// 		storing each metadata entry as a blob ref, we could store a single
-	// 		tree ref that points to each of the branch blobs (since it's
-	//	 	possible to update the tree refs atomically w/ Git's CAS).
-	// 		It's possible that we run the operations above but then this fails
-	//		and we're in a weird state.
+	if oldBranch == newBranch {
+		return errors.Errorf("cannot rename branch to itself")
+	}
+
+	tx := meta.NewTx(repo)
+	tx.RenameBranch(oldBranch, newBranch)
+
+	// Rename the branch in Git first since that's the most likely thing to
+	// fail (e.g., if the new branch name already exists).
 	if _, err := repo.Run(&git.RunOpts{
 		Args:      []string{"branch", "-m", newBranch},
 		ExitError: true,
 	}); err != nil {
 		return errors.WrapIff(err, "failed to rename Git branch")
 	}
+	if err := tx.Commit(); err != nil {
+		repo := repo.WithContext(context.Background())
+		if _, renameErr := repo.Run(&git.RunOpts{
+			Args:      []string{"branch", "-m", newBranch, oldBranch},
+			ExitError: true,
+		}); renameErr != nil {
+			logrus.WithError(renameErr).Warn("failed to restore original branch name")
+		}
+		return err
+	}
 
 	return nil
 }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aviator-co/av/internal/config"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/spf13/cobra"
+)
+
+var stackPushMetaCmd = &cobra.Command{
+	Use:   "push-meta",
+	Short: "share the stack metadata through the remote",
+	Long: strings.TrimSpace(`
+Push the metadata of all stacked branches to the remote repository.
+
+The metadata is stored under refs/av/users/<namespace> on the remote (where the
+namespace defaults to the local part of the Git user email) so that it can be
+pulled on another machine with av stack pull-meta. The Git config is updated so
+that a normal git fetch also fetches the shared metadata.
+
+The remote metadata is pulled and merged first (like av stack pull-meta does),
+so pushing from a machine that only has part of the stack doesn't overwrite or
+delete the metadata that was pushed from another machine.
+`),
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, repoMeta, err := getRepoInfo()
+		if err != nil {
+			return err
+		}
+		return pushStackMeta(repo, repoMeta)
+	},
+}
+
+var stackPullMetaFlags struct {
+	User string
+}
+
+var stackPullMetaCmd = &cobra.Command{
+	Use:   "pull-meta",
+	Short: "fetch the shared stack metadata from the remote",
+	Long: strings.TrimSpace(`
+Fetch the metadata of stacked branches that was shared with av stack push-meta
+and merge it into the local metadata.
+
+Local branches are created for any branches that only exist on the remote. If
+the local and remote metadata of a branch disagree, the version that matches
+the history of the local branch is kept.
+`),
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, repoMeta, err := getRepoInfo()
+		if err != nil {
+			return err
+		}
+		return pullStackMeta(repo, repoMeta, stackPullMetaFlags.User)
+	},
+}
+
+func init() {
+	stackPullMetaCmd.Flags().StringVar(
+		&stackPullMetaFlags.User, "user", "",
+		"pull the metadata shared by another user (the namespace that they pushed to)",
+	)
+}
+
+// stackMetaRemote returns the remote that the branch metadata is shared
+// through. This is the remote that branches are pushed to.
+func stackMetaRemote(repo *git.Repo, repoMeta meta.Repository) (string, error) {
+	if repoMeta.Fork != nil && repoMeta.Fork.Remote != "" {
+		return repoMeta.Fork.Remote, nil
+	}
+	remote, err := repo.DefaultRemote()
+	if err != nil {
+		return "", err
+	}
+	return remote.Label, nil
+}
+
+func stackMetaNamespace(repo *git.Repo) (string, error) {
+	if config.Av.Metadata.Namespace != "" {
+		return config.Av.Metadata.Namespace, nil
+	}
+	return meta.DefaultNamespace(repo)
+}
+
+func pushStackMeta(repo *git.Repo, repoMeta meta.Repository) error {
+	remote, err := stackMetaRemote(repo, repoMeta)
+	if err != nil {
+		return err
+	}
+	namespace, err := stackMetaNamespace(repo)
+	if err != nil {
+		return err
+	}
+	res, err := meta.PushBranches(repo, remote, namespace)
+	if err != nil {
+		return err
+	}
+	printPulledStackMeta(remote, namespace, res)
+	_, _ = fmt.Fprint(os.Stderr,
+		"Pushed stack metadata to ", colors.UserInput(remote),
+		" (namespace ", colors.UserInput(namespace), ")\n",
+	)
+	return nil
+}
+
+func pullStackMeta(repo *git.Repo, repoMeta meta.Repository, namespace string) error {
+	remote, err := stackMetaRemote(repo, repoMeta)
+	if err != nil {
+		return err
+	}
+	if namespace == "" {
+		namespace, err = stackMetaNamespace(repo)
+		if err != nil {
+			return err
+		}
+	}
+	res, err := meta.PullBranches(repo, remote, namespace)
+	if err != nil {
+		return err
+	}
+	printPulledStackMeta(remote, namespace, res)
+	return nil
+}
+
+func printPulledStackMeta(remote string, namespace string, res *meta.PullBranchesResult) {
+	_, _ = fmt.Fprint(os.Stderr,
+		"Pulled stack metadata from ", colors.UserInput(remote),
+		" (namespace ", colors.UserInput(namespace), ")\n",
+	)
+	for _, name := range res.Updated {
+		_, _ = fmt.Fprint(os.Stderr, "  - updated metadata for ", colors.UserInput(name), "\n")
+	}
+	for _, name := range res.Conflicts {
+		_, _ = fmt.Fprint(os.Stderr,
+			"  - ", colors.Warning("resolved conflict"), " between local and remote metadata for ",
+			colors.UserInput(name), "\n",
+		)
+	}
+	for _, name := range res.Skipped {
+		_, _ = fmt.Fprint(os.Stderr,
+			"  - skipped ", colors.UserInput(name), " (the branch doesn't exist locally or on the remote)\n",
+		)
+	}
+	for _, name := range res.Invalid {
+		_, _ = fmt.Fprint(os.Stderr,
+			"  - skipped ", colors.UserInput(name), " (the remote metadata couldn't be read)\n",
+		)
+	}
+}
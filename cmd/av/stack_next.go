@@ -4,12 +4,15 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"emperror.dev/errors"
 	"github.com/aviator-co/av/internal/git"
 	"github.com/aviator-co/av/internal/meta"
 	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/aviator-co/av/internal/utils/picker"
 	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
 )
 
 var stackNextFlags struct {
@@ -20,12 +23,20 @@ var stackNextFlags struct {
 var stackNextCmd = &cobra.Command{
 	Use:   "next [<n>|--last]",
 	Short: "checkout the next branch in the stack",
+	Long: strings.TrimSpace(`
+Checkout the next branch in the stack.
+
+If a branch has several children, av asks which one to continue with. Without
+a terminal to ask in, av stack next fails instead (it used to silently follow
+the first child), so use av stack switch to switch to a branch in scripts.
+`),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Get the subsequent branches so we can checkout the nth one
+		// Walk down from the current branch so we can checkout the nth one
 		repo, _, err := getRepoInfo()
 		if err != nil {
 			return err
 		}
+		warnOrphanedBranches(repo)
 		branches, err := meta.ReadAllBranches(repo)
 		if err != nil {
 			return err
@@ -34,39 +45,58 @@ var stackNextCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		subsequentBranches, err := meta.SubsequentBranches(branches, currentBranch)
-		if err != nil {
-			return err
+		if _, ok := branches[currentBranch]; !ok {
+			return errors.Errorf("branch metadata not found for %q", currentBranch)
 		}
 
-		var branchToCheckout string
-		if stackNextFlags.Last {
-			if len(subsequentBranches) == 0 {
-				return errors.New("already on last branch in stack\n")
+		var n int = 1
+		if len(args) == 1 {
+			var err error
+			n, err = strconv.Atoi(args[0])
+			if err != nil {
+				return errors.New("invalid number (unable to parse)")
 			}
-			branchToCheckout = subsequentBranches[len(subsequentBranches)-1]
-		} else {
-			if len(subsequentBranches) == 0 {
+		} else if len(args) > 1 {
+			_ = cmd.Usage()
+			return errors.New("too many arguments")
+		}
+		if n <= 0 {
+			return errors.New("invalid number (must be >= 1)")
+		}
+
+		// Walk down the stack one branch at a time. If a branch has several
+		// children, the user has to choose which one to follow.
+		branchToCheckout := currentBranch
+		visited := []string{currentBranch}
+		for i := 0; stackNextFlags.Last || i < n; i++ {
+			children := branches[branchToCheckout].Children
+			if len(children) == 0 {
+				if i > 0 && stackNextFlags.Last {
+					break
+				}
+				if i > 0 {
+					return fmt.Errorf("invalid number (there are only %d subsequent branches in the stack)", i)
+				}
+				if stackNextFlags.Last {
+					return errors.New("already on last branch in stack\n")
+				}
 				return errors.New("there is no next branch")
 			}
-			var n int = 1
-			if len(args) == 1 {
+			next := children[0]
+			if len(children) > 1 {
 				var err error
-				n, err = strconv.Atoi(args[0])
+				next, err = stackNextChooseChild(branches, branchToCheckout, currentBranch)
 				if err != nil {
-					return errors.New("invalid number (unable to parse)")
+					return err
 				}
-			} else if len(args) > 1 {
-				_ = cmd.Usage()
-				return errors.New("too many arguments")
-			}
-			if n <= 0 {
-				return errors.New("invalid number (must be >= 1)")
 			}
-			if n > len(subsequentBranches) {
-				return fmt.Errorf("invalid number (there are only %d subsequent branches in the stack)", len(subsequentBranches))
+			if slices.Contains(visited, next) {
+				return errors.Errorf(
+					"invariant error: branch %q is its own descendant (run `av doctor` to find and fix the problem)", next,
+				)
 			}
-			branchToCheckout = subsequentBranches[n-1]
+			visited = append(visited, next)
+			branchToCheckout = next
 		}
 
 		if _, err := repo.CheckoutBranch(&git.CheckoutBranch{
@@ -81,9 +111,51 @@ var stackNextCmd = &cobra.Command{
 	},
 }
 
+// stackNextChooseChild asks the user which child of the branch av stack next
+// should continue with.
+func stackNextChooseChild(branches map[string]meta.Branch, branch string, currentBranch string) (string, error) {
+	children := branches[branch].Children
+	if !picker.Available() {
+		return "", errors.Errorf(
+			"branch %s has several children (%s): use av stack switch to choose one",
+			branch, strings.Join(children, ", "),
+		)
+	}
+	items := make([]picker.Item, 0, len(children))
+	for _, child := range children {
+		items = append(items, stackSwitchItem(branches, child, 0, currentBranch))
+	}
+	child, err := picker.Run(picker.Options{
+		Prompt: fmt.Sprintf("Branch %s has several children, choose one:", branch),
+		Items:  items,
+	})
+	if errors.Is(err, picker.ErrCancelled) {
+		return "", errExitSilently{exitInterrupted}
+	}
+	return child, err
+}
+
+// stackNextBranches returns the branches that av stack next <n> counts along
+// without having to choose between the children of a branch.
+func stackNextBranches(branches map[string]meta.Branch, current string) ([]string, error) {
+	var next []string
+	for {
+		branch, ok := branches[current]
+		if !ok {
+			return nil, errors.Errorf("branch metadata not found for %q", current)
+		}
+		if len(branch.Children) != 1 || slices.Contains(next, branch.Children[0]) {
+			return next, nil
+		}
+		current = branch.Children[0]
+		next = append(next, current)
+	}
+}
+
 func init() {
 	stackNextCmd.Flags().BoolVar(
 		&stackNextFlags.Last, "last", false,
 		"go to the last branch in the current stack",
 	)
+	stackNextCmd.ValidArgsFunction = completeStackOffset(stackNextBranches)
 }
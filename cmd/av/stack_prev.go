@@ -26,6 +26,7 @@ var stackPrevCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		warnOrphanedBranches(repo)
 		branches, err := meta.ReadAllBranches(repo)
 		if err != nil {
 			return err
@@ -87,4 +88,5 @@ func init() {
 		&stackPrevFlags.First, "first", false,
 		"go to the first branch in the current stack",
 	)
+	stackPrevCmd.ValidArgsFunction = completeStackOffset(completePreviousBranches)
 }
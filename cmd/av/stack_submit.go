@@ -1,8 +1,6 @@
 package main
 
 import (
-	"context"
-
 	"emperror.dev/errors"
 	"github.com/aviator-co/av/internal/actions"
 	"github.com/aviator-co/av/internal/config"
@@ -22,10 +20,11 @@ var stackSubmitCmd = &cobra.Command{
 		}
 
 		// Get the all branches in the stack
-		repo, _, err := getRepoInfo()
+		repo, repoMeta, err := getRepoInfo()
 		if err != nil {
 			return err
 		}
+		warnOrphanedBranches(repo)
 		branches, err := meta.ReadAllBranches(repo)
 		if err != nil {
 			return err
@@ -48,8 +47,8 @@ var stackSubmitCmd = &cobra.Command{
 		branchesToSubmit = append(branchesToSubmit, subsequentBranches...)
 
 		// ensure pull requests for each branch in the stack
-		ctx := context.Background()
-		client, err := getClient(config.Av.GitHub.Token)
+		ctx := cmd.Context()
+		client, err := getClient()
 		if err != nil {
 			return err
 		}
@@ -77,6 +76,11 @@ var stackSubmitCmd = &cobra.Command{
 			}
 		}
 
+		if config.Av.Metadata.AutoSync {
+			if err := pushStackMeta(repo, repoMeta); err != nil {
+				return err
+			}
+		}
 		return nil
 	},
 }
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/aviator-co/av/internal/utils/fuzzy"
+	"github.com/aviator-co/av/internal/utils/picker"
+	"github.com/spf13/cobra"
+)
+
+var stackSwitchCmd = &cobra.Command{
+	Use:   "switch [<branch>]",
+	Short: "interactively switch to another branch in the stack",
+	Long: strings.TrimSpace(`
+Interactively switch to another branch.
+
+Without arguments, av shows a picker with the tree of stacked branches (like
+av stack tree). Type to fuzzy-filter the branches, use the arrow keys (or
+ctrl-n and ctrl-p) to select a branch, and press enter to check it out. Press
+escape or ctrl-c to cancel.
+
+With an argument, av checks out the branch that best matches it (e.g.,
+"av stack switch login" checks out jane/fix-login). If several branches match
+equally well, av shows the picker with the matching branches (or fails if
+it's not running in a terminal).
+`),
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completeBranches,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, err := getRepo()
+		if err != nil {
+			return err
+		}
+		defaultBranch, err := repo.DefaultBranch()
+		if err != nil {
+			return err
+		}
+		branches, err := meta.ReadAllBranches(repo)
+		if err != nil {
+			return err
+		}
+		currentBranch, err := repo.CurrentBranchName()
+		if err != nil {
+			// Allow switching away from a detached HEAD.
+			currentBranch = ""
+		}
+		items := stackSwitchItems(branches, defaultBranch, currentBranch)
+
+		var filter string
+		if len(args) == 1 {
+			filter = args[0]
+			branch, candidates := stackSwitchMatch(items, filter)
+			if branch != "" {
+				return stackSwitchCheckout(repo, currentBranch, branch)
+			}
+			if len(candidates) == 0 {
+				return errors.Errorf("no branch matches %q", filter)
+			}
+			if !picker.Available() {
+				return errors.Errorf(
+					"%q matches several branches (%s): use a more specific name",
+					filter, strings.Join(candidates, ", "),
+				)
+			}
+		} else if !picker.Available() {
+			return errors.New("av stack switch needs a terminal unless a branch name is given")
+		}
+
+		branch, err := picker.Run(picker.Options{
+			Prompt:   "Switch to branch:",
+			Items:    items,
+			Filter:   filter,
+			Selected: currentBranch,
+		})
+		if errors.Is(err, picker.ErrCancelled) {
+			return errExitSilently{exitInterrupted}
+		} else if err != nil {
+			return err
+		}
+		return stackSwitchCheckout(repo, currentBranch, branch)
+	},
+}
+
+// stackSwitchItems returns the picker items for the branches in the order of
+// av stack tree: every trunk branch is followed by the stacks that are based
+// on it.
+func stackSwitchItems(branches map[string]meta.Branch, defaultBranch string, currentBranch string) []picker.Item {
+	roots := make(map[string][]string)
+	for name, branch := range branches {
+		if branch.IsStackRoot() {
+			roots[branch.Parent.Name] = append(roots[branch.Parent.Name], name)
+		}
+	}
+	trunks := []string{defaultBranch}
+	for trunk := range roots {
+		if trunk != defaultBranch {
+			trunks = append(trunks, trunk)
+		}
+	}
+	sort.Strings(trunks[1:])
+
+	var items []picker.Item
+	var add func(name string, depth int)
+	add = func(name string, depth int) {
+		// Guard against cycles in (corrupt) branch metadata.
+		for _, item := range items {
+			if item.Value == name {
+				return
+			}
+		}
+		items = append(items, stackSwitchItem(branches, name, depth, currentBranch))
+		for _, child := range branches[name].Children {
+			add(child, depth+1)
+		}
+	}
+	for _, trunk := range trunks {
+		add(trunk, 0)
+		sort.Strings(roots[trunk])
+		for _, root := range roots[trunk] {
+			add(root, 1)
+		}
+	}
+	return items
+}
+
+func stackSwitchItem(branches map[string]meta.Branch, name string, depth int, currentBranch string) picker.Item {
+	item := picker.Item{Value: name, Depth: depth, Highlight: name == currentBranch}
+	if pull := branches[name].PullRequest; pull != nil && pull.Number != 0 {
+		item.Detail = fmt.Sprintf("#%d", pull.Number)
+		if pull.State != "" {
+			item.Detail += " " + strings.ToLower(string(pull.State))
+		}
+	}
+	return item
+}
+
+// stackSwitchMatch returns the branch that matches the name best. If there's
+// no single best match, it returns the candidates instead.
+func stackSwitchMatch(items []picker.Item, name string) (string, []string) {
+	values := make([]string, len(items))
+	for i, item := range items {
+		if item.Value == name {
+			return name, nil
+		}
+		values[i] = item.Value
+	}
+	matches := fuzzy.Filter(name, values)
+	if len(matches) == 1 || (len(matches) > 1 && matches[0].Score > matches[1].Score) {
+		return values[matches[0].Index], nil
+	}
+	var candidates []string
+	for _, match := range matches {
+		if match.Score == matches[0].Score {
+			candidates = append(candidates, values[match.Index])
+		}
+	}
+	return "", candidates
+}
+
+func stackSwitchCheckout(repo *git.Repo, currentBranch string, branch string) error {
+	if branch == currentBranch {
+		_, _ = fmt.Fprint(os.Stderr, "Already on branch ", colors.UserInput(branch), "\n")
+		return nil
+	}
+	if _, err := repo.CheckoutBranch(&git.CheckoutBranch{
+		Name: branch,
+	}); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprint(os.Stderr, "Checked out branch ", colors.UserInput(branch), "\n")
+	return nil
+}
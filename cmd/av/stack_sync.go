@@ -13,6 +13,7 @@ import (
 	"github.com/aviator-co/av/internal/actions"
 	"github.com/aviator-co/av/internal/config"
 	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/hooks"
 	"github.com/aviator-co/av/internal/meta"
 	"github.com/aviator-co/av/internal/utils/colors"
 	"github.com/aviator-co/av/internal/utils/stringutils"
@@ -58,6 +59,9 @@ type stackSyncState struct {
 	Continuation *actions.SyncBranchContinuation `json:"continuation,omitempty"`
 	// The config of the sync.
 	Config stackSyncConfig `json:"config"`
+	// If set, the sync was started by `av pr merge --stack`, which has to be
+	// run again after the sync is complete to merge the rest of the stack.
+	MergeStack bool `json:"mergeStack,omitempty"`
 }
 
 var stackSyncFlags struct {
@@ -100,12 +104,13 @@ base branch.
 			return errors.New("cannot use --parent and --trunk together")
 		}
 
-		ctx := context.Background()
+		ctx := cmd.Context()
 
 		repo, repoMeta, err := getRepoInfo()
 		if err != nil {
 			return err
 		}
+		warnOrphanedBranches(repo)
 
 		// Read any preexisting state.
 		// This is required to allow us to handle --continue/--abort
@@ -115,14 +120,14 @@ base branch.
 		}
 
 		if stackSyncFlags.Abort {
-			if state.CurrentBranch == "" || state.Continuation == nil {
+			if state.CurrentBranch == "" {
 				// Try to clear the state file if it exists just to be safe.
 				_ = writeStackSyncState(repo, nil)
 				return errors.New("no sync in progress")
 			}
 
 			// Abort the rebase if we need to
-			if stat, _ := os.Stat(path.Join(repo.GitDir(), "REBASE_HEAD")); stat != nil {
+			if repo.RebaseInProgress() {
 				if _, err := repo.Rebase(git.RebaseOpts{Abort: true}); err != nil {
 					return errors.WrapIf(err, "failed to abort in-progress rebase")
 				}
@@ -170,6 +175,12 @@ base branch.
 				return err
 			}
 
+			if config.Av.Metadata.AutoSync && !stackSyncFlags.NoFetch {
+				if err := pullStackMeta(repo, repoMeta, ""); err != nil {
+					return err
+				}
+			}
+
 			state.OriginalBranch = currentBranch
 			state.Config = stackSyncConfig{
 				stackSyncFlags.Current,
@@ -195,12 +206,24 @@ base branch.
 				NewParent:      state.Config.Parent,
 				NewParentTrunk: state.Config.Parent == defaultBranch,
 			}
+			// Remember where the branch was so that the reparent can be rolled
+			// back if it's interrupted (the branch might have been rebased
+			// already when the metadata is written).
+			var oldHead string
 			if stackSyncFlags.Continue {
 				res, err = actions.ReparentContinue(repo, opts)
 			} else {
+				oldHead, err = repo.RevParse(&git.RevParse{Rev: "refs/heads/" + currentBranch})
+				if err != nil {
+					return err
+				}
 				res, err = actions.Reparent(repo, opts)
 			}
 			if err != nil {
+				if ctx.Err() != nil {
+					// Nothing has been synced yet, so just roll back.
+					return stackSyncReparentInterrupted(repo, opts, oldHead)
+				}
 				return err
 			}
 			if !res.Success {
@@ -277,7 +300,7 @@ base branch.
 
 		logrus.WithField("branches", branchesToSync).Debug("determined branches to sync")
 		//var resErr error
-		client, err := getClient(config.Av.GitHub.Token)
+		client, err := getClient()
 		if err != nil {
 			return err
 		}
@@ -287,6 +310,20 @@ base branch.
 				_, _ = fmt.Fprint(os.Stderr, "\n\n")
 			}
 			state.CurrentBranch = currentBranch
+			if ctx.Err() != nil {
+				return stackSyncInterrupted(repo, &state)
+			}
+			// The pre-sync hook already ran if we're continuing after a
+			// conflict.
+			if state.Continuation == nil {
+				branch, _ := meta.ReadBranch(repo, currentBranch)
+				if err := hooks.Run(ctx, repo, hooks.PreSync, branch); err != nil {
+					if ctx.Err() != nil {
+						return stackSyncInterrupted(repo, &state)
+					}
+					return stackSyncHookFailed(repo, &state, err)
+				}
+			}
 			res, err := actions.SyncBranch(ctx, repo, client, repoMeta, actions.SyncBranchOpts{
 				Branch:       currentBranch,
 				NoFetch:      state.Config.NoFetch,
@@ -295,6 +332,9 @@ base branch.
 				ToTrunk:      state.Config.Trunk,
 			})
 			if err != nil {
+				if ctx.Err() != nil {
+					return stackSyncInterrupted(repo, &state)
+				}
 				return err
 			}
 			if res.Status == git.RebaseConflict {
@@ -306,6 +346,8 @@ base branch.
 			}
 
 			state.Continuation = nil
+			branch, _ := meta.ReadBranch(repo, currentBranch)
+			hooks.RunPost(ctx, repo, hooks.PostSync, branch)
 		}
 
 		// Return to the original branch
@@ -315,10 +357,121 @@ base branch.
 		if err := writeStackSyncState(repo, nil); err != nil {
 			return errors.Wrap(err, "failed to write stack sync state")
 		}
+		if config.Av.Metadata.AutoSync && !state.Config.NoPush {
+			if err := pushStackMeta(repo, repoMeta); err != nil {
+				return err
+			}
+		}
+		if state.MergeStack {
+			_, _ = fmt.Fprint(os.Stderr,
+				"\nThe stack was synced: run ", colors.CliCmd("av pr merge --stack"),
+				" again to merge the rest of the stack\n",
+			)
+		}
 		return nil
 	},
 }
 
+// stackSyncInterrupted handles an interrupt (e.g., Ctrl-C) during a sync. Any
+// rebase that was in progress is aborted (which restores the branch that was
+// being synced) and the state is written so that the sync can be resumed from
+// that branch with --continue.
+func stackSyncInterrupted(repo *git.Repo, state *stackSyncState) error {
+	// The context of the repo is cancelled, so we need a new one to clean up.
+	repo = repo.WithContext(context.Background())
+	if repo.RebaseInProgress() {
+		if _, err := repo.Rebase(git.RebaseOpts{Abort: true}); err != nil {
+			return errors.WrapIf(err, "failed to abort interrupted rebase")
+		}
+	}
+
+	state.Continuation = nil
+	if err := writeStackSyncState(repo, state); err != nil {
+		return errors.Wrap(err, "failed to write stack sync state")
+	}
+	_, _ = fmt.Fprint(os.Stderr,
+		colors.Failure("Sync was interrupted while syncing branch "), colors.UserInput(state.CurrentBranch), "\n",
+		"  - resume the sync with ", colors.CliCmd("av stack sync --continue"),
+		" or abort it with ", colors.CliCmd("av stack sync --abort"), "\n",
+	)
+	return errExitSilently{exitInterrupted}
+}
+
+// stackSyncReparentInterrupted handles an interrupt while re-parenting the
+// branch (before any other branch was synced). If the branch was already
+// rebased onto the new parent but its metadata wasn't written, the branch is
+// reset to oldHead. oldHead is empty if the reparent was continued after a
+// conflict (in which case the original head is unknown).
+func stackSyncReparentInterrupted(repo *git.Repo, opts actions.ReparentOpts, oldHead string) error {
+	// The context of the repo is cancelled, so we need a new one to clean up.
+	repo = repo.WithContext(context.Background())
+	if repo.RebaseInProgress() {
+		if _, err := repo.Rebase(git.RebaseOpts{Abort: true}); err != nil {
+			return errors.WrapIf(err, "failed to abort interrupted rebase")
+		}
+	}
+
+	branch, _ := meta.ReadBranch(repo, opts.Branch)
+	if branch.Parent.Name == opts.NewParent {
+		// The metadata was written, so the reparent itself completed.
+		_, _ = fmt.Fprint(os.Stderr,
+			colors.Failure("Sync was interrupted after re-parenting branch "), colors.UserInput(opts.Branch),
+			colors.Failure(" onto "), colors.UserInput(opts.NewParent), "\n",
+			"  - run ", colors.CliCmd("av stack sync"), " to sync the rest of the stack\n",
+		)
+		return errExitSilently{exitInterrupted}
+	}
+
+	if oldHead == "" {
+		// The original head is unknown, so we can't tell whether the branch
+		// was already rebased.
+		_, _ = fmt.Fprint(os.Stderr,
+			colors.Failure("Sync was interrupted while re-parenting branch "), colors.UserInput(opts.Branch),
+			colors.Failure(" onto "), colors.UserInput(opts.NewParent), "\n",
+			"  - run ", colors.CliCmd("av stack sync --abort"), " and then ",
+			colors.CliCmd("av stack sync --parent ", opts.NewParent), " to re-parent the branch again\n",
+		)
+		return errExitSilently{exitInterrupted}
+	}
+	head, err := repo.RevParse(&git.RevParse{Rev: "refs/heads/" + opts.Branch})
+	if err == nil && head != oldHead {
+		if current, _ := repo.CurrentBranchName(); current == opts.Branch {
+			_, err = repo.Git("reset", "--keep", oldHead)
+		} else {
+			_, err = repo.Git("update-ref", "refs/heads/"+opts.Branch, oldHead, head)
+		}
+	}
+	if err != nil {
+		logrus.WithError(err).Debug("failed to restore branch after interrupted reparent")
+		_, _ = fmt.Fprint(os.Stderr,
+			colors.Failure("Sync was interrupted after rebasing branch "), colors.UserInput(opts.Branch),
+			colors.Failure(" onto "), colors.UserInput(opts.NewParent),
+			colors.Failure(" but before its stack metadata was updated"), "\n",
+			"  - the branch was at ", colors.UserInput(git.ShortSha(oldHead)), " before the sync; run ",
+			colors.CliCmd("av stack sync --parent ", opts.NewParent), " again to finish re-parenting the branch\n",
+		)
+		return errExitSilently{exitInterrupted}
+	}
+	_, _ = fmt.Fprint(os.Stderr, colors.Failure("Sync was interrupted and rolled back"), "\n")
+	return errExitSilently{exitInterrupted}
+}
+
+// stackSyncHookFailed stops the sync because a pre-sync hook failed. The state
+// is written so that the sync can be resumed (from the branch whose hook
+// failed) once the problem is fixed.
+func stackSyncHookFailed(repo *git.Repo, state *stackSyncState, hookErr error) error {
+	if err := writeStackSyncState(repo, state); err != nil {
+		return errors.Wrap(err, "failed to write stack sync state")
+	}
+	_, _ = fmt.Fprint(os.Stderr,
+		colors.Failure("Sync was stopped before syncing branch "), colors.UserInput(state.CurrentBranch),
+		colors.Failure(": ", hookErr.Error()), "\n",
+		"  - resume the sync with ", colors.CliCmd("av stack sync --continue"),
+		" or abort it with ", colors.CliCmd("av stack sync --abort"), "\n",
+	)
+	return errExitSilently{1}
+}
+
 const stackSyncStateFile = "stack-sync.state.json"
 
 func readStackSyncState(repo *git.Repo) (stackSyncState, error) {
@@ -391,4 +544,5 @@ func init() {
 		&stackSyncFlags.Parent, "parent", "",
 		"parent branch to rebase onto",
 	)
+	_ = stackSyncCmd.RegisterFlagCompletionFunc("parent", completeBranches)
 }
@@ -18,6 +18,7 @@ var stackTreeCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		warnOrphanedBranches(repo)
 
 		defaultBranch, err := repo.DefaultBranch()
 		if err != nil {
@@ -60,7 +61,7 @@ func printStackTree(repo *git.Repo, branches map[string]meta.Branch, currentBran
 	indent := strings.Repeat("    ", depth)
 	branch, ok := branches[root]
 	if !ok {
-		fmt.Printf("%s<ERROR: unknown branch: %s>\n", indent, root)
+		fmt.Printf("%s<ERROR: unknown branch: %s (run `av doctor` for details)>\n", indent, root)
 		return
 	}
 	if currentBranch == branch.Name {
@@ -0,0 +1,38 @@
+package e2e_tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aviator-co/av/internal/git/gittest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompletion(t *testing.T) {
+	repo := gittest.NewTempRepo(t)
+	Chdir(t, repo.Dir())
+
+	// main -> one -> two
+	RequireAv(t, "stack", "branch", "one")
+	gittest.CommitFile(t, repo, "one.txt", []byte("one"))
+	RequireAv(t, "stack", "branch", "two")
+	gittest.CommitFile(t, repo, "two.txt", []byte("two"))
+
+	complete := func(args ...string) []string {
+		out := RequireAv(t, append([]string{"__complete"}, args...)...)
+		lines := strings.Split(strings.TrimSpace(out.Stdout), "\n")
+		// The last line is the completion directive.
+		return lines[:len(lines)-1]
+	}
+
+	require.Equal(t,
+		[]string{"main\ttrunk", "one\tparent: main", "two\tparent: one"},
+		complete("stack", "sync", "--parent", ""),
+	)
+	require.Equal(t, []string{"one\tparent: main"}, complete("stack", "branch", "--parent", "o"))
+	require.Equal(t, []string{"1\tone"}, complete("stack", "prev", ""))
+
+	RequireCmd(t, "git", "checkout", "one")
+	require.Equal(t, []string{"1\ttwo"}, complete("stack", "next", ""))
+	require.Equal(t, []string{"pullRequest.draft"}, complete("config", "get", "pullrequest.dr"))
+}
@@ -0,0 +1,49 @@
+package e2e_tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aviator-co/av/internal/git/gittest"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDoctorFixDeletedBranch(t *testing.T) {
+	repo := gittest.NewTempRepo(t)
+	Chdir(t, repo.Dir())
+
+	// main -> one -> two -> three
+	RequireAv(t, "stack", "branch", "one")
+	gittest.CommitFile(t, repo, "one.txt", []byte("one"))
+	RequireAv(t, "stack", "branch", "two")
+	gittest.CommitFile(t, repo, "two.txt", []byte("two"))
+	RequireAv(t, "stack", "branch", "three")
+	gittest.CommitFile(t, repo, "three.txt", []byte("three"))
+
+	// Delete two (without merging it) and add a commit to one so that the
+	// sync below has to rebase three.
+	RequireCmd(t, "git", "checkout", "one")
+	RequireCmd(t, "git", "branch", "-D", "two")
+	gittest.CommitFile(t, repo, "one-more.txt", []byte("one more"))
+
+	// Only the commands that walk the stack warn about the orphaned metadata.
+	require.Contains(t, RequireAv(t, "stack", "tree").Stderr, "av doctor --fix")
+	require.NotContains(t, RequireAv(t, "config", "list").Stderr, "av doctor --fix")
+
+	RequireAv(t, "doctor", "--fix", "--no-fetch")
+	branches, err := meta.ReadAllBranches(repo)
+	require.NoError(t, err)
+	require.NotContains(t, branches, "two")
+	require.Equal(t, "one", branches["three"].Parent.Name)
+
+	// The commits of two are still part of three after the sync.
+	RequireCmd(t, "git", "checkout", "three")
+	RequireAv(t, "stack", "sync", "--no-fetch", "--no-push")
+	RequireCurrentBranchName(t, repo, "three")
+	for _, name := range []string{"one.txt", "one-more.txt", "two.txt", "three.txt"} {
+		_, err := os.Stat(filepath.Join(repo.Dir(), name))
+		require.NoError(t, err, "expected %s to exist after the sync", name)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"github.com/aviator-co/av/internal/git/gittest"
 	"github.com/aviator-co/av/internal/meta"
 	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -21,7 +23,7 @@ func TestStackBranchMove(t *testing.T) {
 
 	// one -> un
 	RequireCmd(t, "git", "checkout", "one")
-	RequireAv(t, "stack", "branch", "-m", "un")
+	RequireAv(t, "stack", "branch", "--rename", "un")
 	RequireCurrentBranchName(t, repo, "un")
 
 	// two -> deux
@@ -29,13 +31,13 @@ func TestStackBranchMove(t *testing.T) {
 	// correct
 	RequireAv(t, "stack", "next")
 	RequireCurrentBranchName(t, repo, "two")
-	RequireAv(t, "stack", "branch", "-m", "deux")
+	RequireAv(t, "stack", "branch", "--rename", "deux")
 	RequireCurrentBranchName(t, repo, "deux")
 
 	// three -> trois
 	RequireAv(t, "stack", "next")
 	RequireCurrentBranchName(t, repo, "three")
-	RequireAv(t, "stack", "branch", "-m", "trois")
+	RequireAv(t, "stack", "branch", "--rename", "trois")
 	RequireCurrentBranchName(t, repo, "trois")
 
 	// Make sure we've handled all the parent/child renames correctly
@@ -48,3 +50,46 @@ func TestStackBranchMove(t *testing.T) {
 	require.Equal(t, "deux", branches["trois"].Parent.Name, "expected parent(trois) to be deux")
 	require.Len(t, branches["trois"].Children, 0, "expected trois to have no children")
 }
+
+func TestStackBranchMessage(t *testing.T) {
+	repo := gittest.NewTempRepo(t)
+	Chdir(t, repo.Dir())
+	t.Setenv("AV_BRANCH_NAMETEMPLATE", "{{.User}}/{{.Slug}}")
+
+	// There's nothing to commit yet.
+	require.NotEqual(t, 0, Av(t, "stack", "branch", "-m", "Add one").ExitCode)
+
+	// -m used to mean --rename, so av points at --rename if it looks like
+	// that's what was meant.
+	res := Av(t, "stack", "branch", "-m", "renamed")
+	require.NotEqual(t, 0, res.ExitCode)
+	require.Contains(t, res.Stderr, "av stack branch --rename renamed")
+	RequireCurrentBranchName(t, repo, "main")
+
+	require.NoError(t, os.WriteFile(filepath.Join(repo.Dir(), "one.txt"), []byte("one"), 0644))
+	RequireCmd(t, "git", "add", "one.txt")
+	RequireAv(t, "stack", "branch", "-m", "Add one.txt!")
+	RequireCurrentBranchName(t, repo, "av-test/add-one-txt")
+	subject, err := repo.Git("log", "-1", "--format=%s")
+	require.NoError(t, err)
+	require.Equal(t, "Add one.txt!", subject)
+
+	// The generated name is made unique.
+	RequireCmd(t, "git", "checkout", "main")
+	require.NoError(t, os.WriteFile(filepath.Join(repo.Dir(), "two.txt"), []byte("two"), 0644))
+	RequireCmd(t, "git", "add", "two.txt")
+	RequireAv(t, "stack", "branch", "-m", "Add one.txt")
+	RequireCurrentBranchName(t, repo, "av-test/add-one-txt-2")
+
+	branches, err := meta.ReadAllBranches(repo)
+	require.NoError(t, err)
+	require.Equal(t, "main", branches["av-test/add-one-txt-2"].Parent.Name)
+
+	// Leftover metadata of a deleted branch isn't reused.
+	RequireCmd(t, "git", "checkout", "main")
+	RequireCmd(t, "git", "update-ref", "refs/av/branch-metadata/av-test/add-three", "refs/av/branch-metadata/av-test/add-one-txt")
+	require.NoError(t, os.WriteFile(filepath.Join(repo.Dir(), "three.txt"), []byte("three"), 0644))
+	RequireCmd(t, "git", "add", "three.txt")
+	RequireAv(t, "stack", "branch", "-m", "Add three")
+	RequireCurrentBranchName(t, repo, "av-test/add-three-2")
+}
@@ -0,0 +1,64 @@
+package e2e_tests
+
+import (
+	"testing"
+
+	"github.com/aviator-co/av/internal/git/gittest"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStackSwitch(t *testing.T) {
+	repo := gittest.NewTempRepo(t)
+	Chdir(t, repo.Dir())
+
+	// Create a stack that forks after fix-login:
+	//   main -> fix-login -> login-tests
+	//                     -> login-docs
+	RequireAv(t, "stack", "branch", "fix-login")
+	gittest.CommitFile(t, repo, "login.txt", []byte("login"))
+	RequireAv(t, "stack", "branch", "login-tests")
+	gittest.CommitFile(t, repo, "tests.txt", []byte("tests"))
+	RequireCmd(t, "git", "checkout", "fix-login")
+	RequireAv(t, "stack", "branch", "login-docs")
+	gittest.CommitFile(t, repo, "docs.txt", []byte("docs"))
+
+	RequireAv(t, "stack", "switch", "ltest")
+	RequireCurrentBranchName(t, repo, "login-tests")
+	RequireAv(t, "stack", "switch", "main")
+	RequireCurrentBranchName(t, repo, "main")
+
+	// Without a terminal, ambiguous names and missing names fail.
+	require.NotEqual(t, 0, Av(t, "stack", "switch", "login").ExitCode)
+	require.NotEqual(t, 0, Av(t, "stack", "switch").ExitCode)
+	require.NotEqual(t, 0, Av(t, "stack", "switch", "nope").ExitCode)
+	RequireCurrentBranchName(t, repo, "main")
+
+	// av stack next can't choose between the children without a terminal.
+	RequireAv(t, "stack", "switch", "fix-login")
+	res := Av(t, "stack", "next")
+	require.NotEqual(t, 0, res.ExitCode)
+	require.Contains(t, res.Stderr, "av stack switch")
+	RequireCurrentBranchName(t, repo, "fix-login")
+}
+
+func TestStackNextCycle(t *testing.T) {
+	repo := gittest.NewTempRepo(t)
+	Chdir(t, repo.Dir())
+
+	RequireAv(t, "stack", "branch", "one")
+	gittest.CommitFile(t, repo, "one.txt", []byte("one"))
+	RequireAv(t, "stack", "branch", "two")
+	gittest.CommitFile(t, repo, "two.txt", []byte("two"))
+
+	// Corrupt the metadata so that the stack loops back to one.
+	two, _ := meta.ReadBranch(repo, "two")
+	two.Children = []string{"one"}
+	require.NoError(t, meta.WriteBranch(repo, two))
+
+	RequireCmd(t, "git", "checkout", "one")
+	res := Av(t, "stack", "next", "--last")
+	require.NotEqual(t, 0, res.ExitCode)
+	require.Contains(t, res.Stderr, "av doctor")
+	RequireCurrentBranchName(t, repo, "one")
+}
@@ -0,0 +1,366 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/gh"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/aviator-co/av/internal/utils/sliceutils"
+	"github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
+)
+
+type PullRequestImport struct {
+	// The pull request to import.
+	Pull *gh.PullRequest
+	// The name of the parent branch.
+	Parent string
+	// If true, the parent branch is a trunk branch (i.e., the pull request is
+	// the root of a stack).
+	ParentTrunk bool
+	// The commit of the parent branch that the pull request branch is based
+	// on. This is optional: if empty (or if the commit isn't part of the
+	// history of the branch), the merge base of the branch and its parent is
+	// used instead.
+	ParentHead string
+}
+
+// ImportPullRequests creates local branches for the given pull requests and
+// writes the av metadata that describes the stack they belong to.
+// The imports must be given in topological order (i.e., every parent must come
+// before its children).
+func ImportPullRequests(repo *git.Repo, imports []PullRequestImport) error {
+	if len(imports) == 0 {
+		return nil
+	}
+	remote, err := repo.DefaultRemote()
+	if err != nil {
+		return err
+	}
+
+	// Fetch everything in a single command. We always fetch the pull request
+	// head ref since it exists even if the head branch was deleted (e.g., after
+	// the pull request was merged) or lives in a fork.
+	fetchArgs := []string{"fetch", remote.Label}
+	for _, imp := range imports {
+		fetchArgs = append(fetchArgs, fmt.Sprintf("refs/pull/%d/head", imp.Pull.Number))
+		if imp.Pull.State == githubv4.PullRequestStateOpen && !imp.Pull.IsCrossRepository {
+			branch := imp.Pull.HeadBranchName()
+			fetchArgs = append(fetchArgs, fmt.Sprintf("+refs/heads/%s:refs/remotes/%s/%s", branch, remote.Label, branch))
+		}
+	}
+	_, _ = fmt.Fprint(os.Stderr,
+		"  - fetching ", colors.UserInput(len(imports)), " pull request(s) from ", colors.UserInput(remote.Label),
+		"\n",
+	)
+	if _, err := repo.Run(&git.RunOpts{Args: fetchArgs, ExitError: true}); err != nil {
+		return errors.WrapIf(err, "failed to fetch pull requests from remote")
+	}
+
+	for _, imp := range imports {
+		if err := importPullRequestBranch(repo, remote, imp); err != nil {
+			return err
+		}
+		if err := importPullRequestMetadata(repo, imp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importPullRequestBranch creates (or fast-forwards) the local branch for the
+// pull request.
+func importPullRequestBranch(repo *git.Repo, remote *git.Remote, imp PullRequestImport) error {
+	name := imp.Pull.HeadBranchName()
+	oid := imp.Pull.HeadRefOID
+	localHead, err := repo.RevParse(&git.RevParse{Rev: "refs/heads/" + name})
+	if err != nil {
+		// The branch doesn't exist locally, so create it.
+		if _, err := repo.Git("branch", name, oid); err != nil {
+			return errors.WrapIff(err, "failed to create branch %q", name)
+		}
+		if imp.Pull.State == githubv4.PullRequestStateOpen && !imp.Pull.IsCrossRepository {
+			// Set the upstream so that `av stack sync` will push to the
+			// existing remote branch.
+			if _, err := repo.Git("config", "branch."+name+".remote", remote.Label); err != nil {
+				return err
+			}
+			if _, err := repo.Git("config", "branch."+name+".merge", "refs/heads/"+name); err != nil {
+				return err
+			}
+		}
+		_, _ = fmt.Fprint(os.Stderr,
+			"  - created branch ", colors.UserInput(name),
+			" for pull request ", colors.UserInput("#", imp.Pull.Number),
+			"\n",
+		)
+		return nil
+	}
+
+	if localHead == oid {
+		return nil
+	}
+	isAncestor, err := repo.IsAncestor(localHead, oid)
+	if err != nil {
+		return err
+	}
+	if !isAncestor {
+		_, _ = fmt.Fprint(os.Stderr,
+			"  - ", colors.Warning("WARNING:"),
+			" local branch ", colors.UserInput(name),
+			" has diverged from pull request ", colors.UserInput("#", imp.Pull.Number),
+			" (keeping the local branch as-is)\n",
+		)
+		return nil
+	}
+	if current, _ := repo.CurrentBranchName(); current == name {
+		_, _ = fmt.Fprint(os.Stderr,
+			"  - ", colors.Warning("WARNING:"),
+			" not updating the currently checked-out branch ", colors.UserInput(name),
+			" (run ", colors.CliCmd("git merge --ff-only ", oid), " to update it)\n",
+		)
+		return nil
+	}
+	if err := repo.UpdateRef(&git.UpdateRef{Ref: "refs/heads/" + name, New: oid, Old: localHead}); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprint(os.Stderr,
+		"  - fast-forwarded branch ", colors.UserInput(name),
+		" to ", colors.UserInput(git.ShortSha(oid)),
+		"\n",
+	)
+	return nil
+}
+
+func importPullRequestMetadata(repo *git.Repo, imp PullRequestImport) error {
+	name := imp.Pull.HeadBranchName()
+	tx := meta.NewTx(repo)
+	branch, _ := tx.ReadBranch(name)
+	oldParent := branch.Parent
+
+	if imp.ParentTrunk {
+		branch.Parent = meta.BranchState{Name: imp.Parent, Trunk: true}
+	} else {
+		head := imp.ParentHead
+		if head != "" {
+			if ok, _ := repo.IsAncestor(head, name); !ok {
+				logrus.WithFields(logrus.Fields{
+					"branch":      name,
+					"parent_head": head,
+				}).Debug("parent head from pull request metadata is not part of branch history")
+				head = ""
+			}
+		}
+		if head == "" {
+			var err error
+			head, err = repo.MergeBase(&git.MergeBase{Revs: []string{name, imp.Parent}})
+			if err != nil {
+				return errors.WrapIff(err, "failed to determine merge base of %q and %q", name, imp.Parent)
+			}
+		}
+		branch.Parent = meta.BranchState{Name: imp.Parent, Head: head}
+	}
+	branch.PullRequest = &meta.PullRequest{
+		ID:        imp.Pull.ID,
+		Number:    imp.Pull.Number,
+		Permalink: imp.Pull.Permalink,
+		State:     imp.Pull.State,
+	}
+	branch.MergeCommit = imp.Pull.GetMergeCommit()
+	tx.WriteBranch(branch)
+
+	// Remove the branch from its previous parent (if it was re-parented)...
+	if !oldParent.Trunk && oldParent.Name != "" && oldParent.Name != branch.Parent.Name {
+		if oldParentMeta, ok := tx.ReadBranch(oldParent.Name); ok {
+			oldParentMeta.Children = sliceutils.DeleteElement(oldParentMeta.Children, name)
+			tx.WriteBranch(oldParentMeta)
+		}
+	}
+	// ...and make sure it's listed as a child of the new one.
+	if !branch.Parent.Trunk {
+		parentMeta, _ := tx.ReadBranch(branch.Parent.Name)
+		if !slices.Contains(parentMeta.Children, name) {
+			parentMeta.Children = append(parentMeta.Children, name)
+			tx.WriteBranch(parentMeta)
+		}
+	}
+	return tx.Commit()
+}
+
+type CheckoutPullRequestOpts struct {
+	// The number of the pull request to check out.
+	Number int64
+	// If true, also import all the (open) pull requests that are stacked on top
+	// of the pull request.
+	Descendants bool
+}
+
+// CheckoutPullRequest creates local branches for the given pull request and
+// every pull request that it's stacked on top of (as determined by the av
+// metadata that is embedded in the pull request body) and checks out the branch
+// for the pull request.
+func CheckoutPullRequest(
+	ctx context.Context, repo *git.Repo, client *gh.Client,
+	repoMeta meta.Repository, opts CheckoutPullRequestOpts,
+) (string, error) {
+	defaultBranch, err := repo.DefaultBranch()
+	if err != nil {
+		return "", err
+	}
+	pull, err := client.GetPullRequest(ctx, gh.PullRequestOpts{
+		Owner:  repoMeta.Owner,
+		Repo:   repoMeta.Name,
+		Number: opts.Number,
+	})
+	if err != nil {
+		return "", err
+	}
+	_, _ = fmt.Fprint(os.Stderr,
+		"Checking out pull request ", colors.UserInput("#", pull.Number, " ", pull.Title), ":",
+		"\n",
+	)
+
+	// Walk down the stack until we reach the trunk.
+	var imports []PullRequestImport
+	seen := make(map[int64]bool)
+	for current := pull; current != nil; {
+		if seen[current.Number] {
+			return "", errors.Errorf("pull request #%d is part of a cycle of stacked pull requests", current.Number)
+		}
+		seen[current.Number] = true
+
+		imp, parentPull, err := stackedPullRequestParent(ctx, client, repoMeta, defaultBranch, current)
+		if err != nil {
+			return "", err
+		}
+		imports = append(imports, imp)
+		current = parentPull
+	}
+	// We walked the stack from the top down, but the imports need to be in
+	// topological order.
+	for i, j := 0, len(imports)-1; i < j; i, j = i+1, j-1 {
+		imports[i], imports[j] = imports[j], imports[i]
+	}
+
+	if opts.Descendants {
+		queue := []*gh.PullRequest{pull}
+		for len(queue) > 0 {
+			parent := queue[0]
+			queue = queue[1:]
+			page, err := client.GetPullRequests(ctx, gh.GetPullRequestsInput{
+				Owner:       repoMeta.Owner,
+				Repo:        repoMeta.Name,
+				BaseRefName: parent.HeadBranchName(),
+				States:      []githubv4.PullRequestState{githubv4.PullRequestStateOpen},
+			})
+			if err != nil {
+				return "", errors.WrapIff(err, "failed to query pull requests stacked on #%d", parent.Number)
+			}
+			for i := range page.PullRequests {
+				child := &page.PullRequests[i]
+				if seen[child.Number] {
+					continue
+				}
+				seen[child.Number] = true
+				imp := PullRequestImport{Pull: child, Parent: parent.HeadBranchName()}
+				if prMeta, err := ReadPRMetadata(child.Body); err == nil && prMeta.Parent == imp.Parent {
+					imp.ParentHead = prMeta.ParentHead
+				}
+				imports = append(imports, imp)
+				queue = append(queue, child)
+			}
+		}
+	}
+
+	if err := ImportPullRequests(repo, imports); err != nil {
+		return "", err
+	}
+
+	branchName := pull.HeadBranchName()
+	if _, err := repo.CheckoutBranch(&git.CheckoutBranch{Name: branchName}); err != nil {
+		return "", err
+	}
+	_, _ = fmt.Fprint(os.Stderr,
+		"  - checked out branch ", colors.UserInput(branchName),
+		"\n",
+	)
+	return branchName, nil
+}
+
+// stackedPullRequestParent determines where the pull request lives within its
+// stack. It returns the import information for the pull request as well as the
+// pull request of its parent branch (which is nil if the pull request is the
+// root of a stack).
+func stackedPullRequestParent(
+	ctx context.Context, client *gh.Client, repoMeta meta.Repository,
+	defaultBranch string, pull *gh.PullRequest,
+) (PullRequestImport, *gh.PullRequest, error) {
+	root := PullRequestImport{Pull: pull, Parent: pull.BaseBranchName(), ParentTrunk: true}
+	// A merged pull request was (by definition) merged into the trunk, so we
+	// consider it a stack root.
+	if pull.State == githubv4.PullRequestStateMerged {
+		return root, nil, nil
+	}
+
+	prMeta, err := ReadPRMetadata(pull.Body)
+	if err != nil {
+		// The pull request wasn't created by av, so the best we can do is to
+		// look for a pull request for the base branch.
+		logrus.WithError(err).WithField("pull", pull.Number).Debug("pull request does not have av metadata")
+		if pull.BaseBranchName() == defaultBranch {
+			return root, nil, nil
+		}
+		page, err := client.GetPullRequests(ctx, gh.GetPullRequestsInput{
+			Owner:       repoMeta.Owner,
+			Repo:        repoMeta.Name,
+			HeadRefName: pull.BaseBranchName(),
+			States:      []githubv4.PullRequestState{githubv4.PullRequestStateOpen},
+		})
+		if err != nil {
+			return PullRequestImport{}, nil, errors.WrapIff(err, "failed to query pull request for branch %q", pull.BaseBranchName())
+		}
+		if len(page.PullRequests) == 0 {
+			return root, nil, nil
+		}
+		return PullRequestImport{Pull: pull, Parent: pull.BaseBranchName()}, &page.PullRequests[0], nil
+	}
+
+	if prMeta.ParentPull == 0 {
+		if prMeta.Trunk != "" {
+			root.Parent = prMeta.Trunk
+		}
+		return root, nil, nil
+	}
+	parentPull, err := client.GetPullRequest(ctx, gh.PullRequestOpts{
+		Owner:  repoMeta.Owner,
+		Repo:   repoMeta.Name,
+		Number: prMeta.ParentPull,
+	})
+	if err != nil {
+		return PullRequestImport{}, nil, err
+	}
+	if parentPull.State == githubv4.PullRequestStateClosed {
+		_, _ = fmt.Fprint(os.Stderr,
+			"  - ", colors.Warning("WARNING:"),
+			" parent pull request ", colors.UserInput("#", parentPull.Number),
+			" of ", colors.UserInput("#", pull.Number),
+			" was closed without being merged (treating ", colors.UserInput("#", pull.Number),
+			" as a stack root)\n",
+		)
+		if prMeta.Trunk != "" {
+			root.Parent = prMeta.Trunk
+		}
+		return root, nil, nil
+	}
+	return PullRequestImport{
+		Pull:       pull,
+		Parent:     parentPull.HeadBranchName(),
+		ParentHead: prMeta.ParentHead,
+	}, parentPull, nil
+}
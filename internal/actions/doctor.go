@@ -0,0 +1,55 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/aviator-co/av/internal/gh"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+	"golang.org/x/exp/maps"
+)
+
+// ValidatePullRequests checks that the pull request associated with each branch
+// is actually a pull request for that branch. This can happen if the metadata
+// was copied from a different branch or the pull request was re-created
+// outside of av.
+func ValidatePullRequests(ctx context.Context, client *gh.Client, branches map[string]meta.Branch) ([]meta.Problem, error) {
+	names := maps.Keys(branches)
+	sort.Strings(names)
+
+	var problems []meta.Problem
+	for _, name := range names {
+		branch := branches[name]
+		if branch.PullRequest == nil || branch.PullRequest.ID == "" {
+			continue
+		}
+		pull, err := client.PullRequest(ctx, branch.PullRequest.ID)
+		if err != nil {
+			return nil, err
+		}
+		if pull.HeadBranchName() == name {
+			continue
+		}
+		problems = append(problems, meta.Problem{
+			Kind:   meta.ProblemPullRequestHead,
+			Branch: name,
+			Message: fmt.Sprintf(
+				"the associated pull request #%d is for the branch %q "+
+					"(the association can be removed and a new pull request created with `av pr create`)",
+				pull.Number, pull.HeadBranchName(),
+			),
+			Fix: unlinkPullRequestFix(name),
+		})
+	}
+	return problems, nil
+}
+
+func unlinkPullRequestFix(name string) func(repo *git.Repo) error {
+	return func(repo *git.Repo) error {
+		branch, _ := meta.ReadBranch(repo, name)
+		branch.PullRequest = nil
+		return meta.WriteBranch(repo, branch)
+	}
+}
@@ -0,0 +1,111 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/editor"
+	"github.com/aviator-co/av/internal/gh"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/aviator-co/av/internal/utils/stringutils"
+	"github.com/aviator-co/av/internal/utils/templateutils"
+	"github.com/shurcooL/githubv4"
+)
+
+type EditPullRequestOpts struct {
+	BranchName string
+	// The new title of the pull request. If nil, the existing title is
+	// preserved.
+	Title *string
+	// The new body of the pull request (which may be empty to clear the body).
+	// If nil, the existing body is preserved.
+	Body *string
+}
+
+// EditPullRequest updates the title and body of the existing pull request for
+// the given branch. If neither a title nor a body is given, a text editor is
+// opened so that the user can edit the existing title and body.
+func EditPullRequest(ctx context.Context, repo *git.Repo, client *gh.Client, opts EditPullRequestOpts) (*gh.PullRequest, error) {
+	branch, _ := meta.ReadBranch(repo, opts.BranchName)
+	if branch.PullRequest == nil {
+		return nil, errors.Errorf(
+			"branch %q does not have an associated pull request (create one with `av pr create`)",
+			opts.BranchName,
+		)
+	}
+
+	_, _ = fmt.Fprint(os.Stderr,
+		"Editing pull request for branch ", colors.UserInput(opts.BranchName), ":",
+		"\n",
+	)
+	pull, err := client.PullRequest(ctx, branch.PullRequest.ID)
+	if err != nil {
+		return nil, err
+	}
+	oldBody := RemovePRMetadata(pull.Body)
+
+	title, body := pull.Title, oldBody
+	if opts.Title != nil && *opts.Title == "" {
+		return nil, errors.New("the title of a pull request cannot be empty")
+	}
+	if opts.Title == nil && opts.Body == nil {
+		commits, err := pullRequestCommits(repo, branch.Parent.Name, opts.BranchName)
+		if err != nil {
+			return nil, err
+		}
+		editorText := templateutils.MustString(prBodyTemplate, prBodyTemplateData{
+			Branch:  opts.BranchName,
+			Title:   pull.Title,
+			Body:    oldBody,
+			Commits: commits,
+			Editing: true,
+		})
+		res, err := editor.Launch(repo, editor.Config{
+			Text:           editorText,
+			TmpFilePattern: "pr-*.md",
+			CommentPrefix:  "%% ",
+		})
+		if err != nil {
+			return nil, errors.WrapIf(err, "failed to launch text editor")
+		}
+		title, body = stringutils.ParseSubjectBody(res)
+		if title == "" {
+			return nil, errors.New("aborting pull request update due to empty message")
+		}
+	} else {
+		if opts.Title != nil {
+			title = *opts.Title
+		}
+		if opts.Body != nil {
+			body = *opts.Body
+		}
+	}
+
+	if title == pull.Title && body == oldBody {
+		_, _ = fmt.Fprint(os.Stderr,
+			"  - no changes to pull request ", colors.UserInput(pull.Permalink), "\n",
+		)
+		return pull, nil
+	}
+
+	prMeta, err := getPRMetadata(repo, branch, nil)
+	if err != nil {
+		return nil, err
+	}
+	pull, err = client.UpdatePullRequest(ctx, githubv4.UpdatePullRequestInput{
+		PullRequestID: githubv4.ID(pull.ID),
+		Title:         gh.Ptr(githubv4.String(title)),
+		Body:          gh.Ptr(githubv4.String(AddPRMetadata(body, prMeta))),
+	})
+	if err != nil {
+		return nil, errors.WrapIf(err, "failed to update pull request")
+	}
+	_, _ = fmt.Fprint(os.Stderr,
+		"  - updated pull request ", colors.UserInput(pull.Permalink), "\n",
+	)
+	return pull, nil
+}
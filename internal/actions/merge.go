@@ -0,0 +1,250 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/aviator"
+	"github.com/aviator-co/av/internal/gh"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+)
+
+// mergePollInterval is how often we check whether or not a pull request was
+// merged while waiting for it to land.
+const mergePollInterval = 15 * time.Second
+
+// mergeWaitTimeout is how long we wait for a pull request to land before giving
+// up.
+const mergeWaitTimeout = 2 * time.Hour
+
+type MergePullRequestOpts struct {
+	BranchName string
+	// The merge method to use. If empty, GitHub's default is used.
+	// This is ignored if Queue is true (the merge method is determined by the
+	// Aviator MergeQueue configuration instead).
+	Method githubv4.PullRequestMergeMethod
+	// If true, queue the pull request in the Aviator MergeQueue instead of
+	// enabling GitHub auto-merge.
+	Queue bool
+	// If true, wait for the pull request to be merged before returning.
+	Wait bool
+}
+
+type MergePullRequestResult struct {
+	// True if the pull request was merged. If false, the pull request was
+	// queued (or scheduled for auto-merge) and will be merged later.
+	Merged bool
+	// The (updated) branch metadata.
+	Branch meta.Branch
+	// The pull request object that was returned from GitHub
+	Pull *gh.PullRequest
+}
+
+// MergePullRequest merges the pull request associated with the given branch
+// (either using GitHub auto-merge or the Aviator MergeQueue). If the pull
+// request is merged before this function returns, the merge commit is recorded
+// in the branch metadata and the pull requests of any child branches are
+// re-targeted onto the trunk.
+func MergePullRequest(
+	ctx context.Context, repo *git.Repo, client *gh.Client, aviatorClient *aviator.Client,
+	repoMeta meta.Repository, opts MergePullRequestOpts,
+) (*MergePullRequestResult, error) {
+	_, _ = fmt.Fprint(os.Stderr,
+		"Merging pull request for branch ", colors.UserInput(opts.BranchName), ":",
+		"\n",
+	)
+
+	branch, _ := meta.ReadBranch(repo, opts.BranchName)
+	if branch.PullRequest == nil || branch.PullRequest.ID == "" {
+		return nil, errors.Errorf(
+			"branch %q does not have an associated pull request (create one with `av pr create`)",
+			branch.Name,
+		)
+	}
+	if !branch.Parent.Trunk {
+		// GitHub will happily merge the pull request into the parent branch, but
+		// that's almost never what the user wants when merging a stack.
+		return nil, errors.Errorf(
+			"branch %q is stacked on top of %q which has not been merged yet "+
+				"(merge the parent first or run `av stack sync` if it was already merged)",
+			branch.Name, branch.Parent.Name,
+		)
+	}
+
+	pull, err := client.PullRequest(ctx, branch.PullRequest.ID)
+	if err != nil {
+		return nil, errors.WrapIff(err, "failed to fetch pull request info for %q", branch.Name)
+	}
+	switch pull.State {
+	case githubv4.PullRequestStateMerged:
+		_, _ = fmt.Fprint(os.Stderr,
+			"  - pull request ", colors.UserInput("#", pull.Number), " is already merged\n",
+		)
+		branch, err = RecordPullRequestMerge(ctx, repo, client, repoMeta, branch, pull)
+		if err != nil {
+			return nil, err
+		}
+		return &MergePullRequestResult{true, branch, pull}, nil
+	case githubv4.PullRequestStateClosed:
+		return nil, errors.Errorf("pull request #%d is closed", pull.Number)
+	}
+
+	// True if GitHub auto-merge was enabled for the pull request.
+	autoMerge := false
+	if opts.Queue {
+		if aviatorClient == nil {
+			logrus.Panicf("internal invariant error: MergePullRequest called with Queue but no Aviator client")
+		}
+		if err := aviatorClient.QueuePullRequest(ctx, aviator.QueuePullRequestInput{
+			Owner:  repoMeta.Owner,
+			Repo:   repoMeta.Name,
+			Number: pull.Number,
+		}); err != nil {
+			return nil, err
+		}
+		_, _ = fmt.Fprint(os.Stderr,
+			"  - queued pull request ", colors.UserInput(pull.Permalink),
+			" in the Aviator MergeQueue\n",
+		)
+	} else {
+		var method *githubv4.PullRequestMergeMethod
+		if opts.Method != "" {
+			method = &opts.Method
+		}
+		var updated *gh.PullRequest
+		if pull.CanMergeNow() {
+			// GitHub refuses to enable auto-merge if the pull request can
+			// already be merged, so we just merge it directly.
+			logrus.WithField("status", pull.MergeStateStatus).Debug("pull request is mergeable, merging directly")
+			updated, err = client.MergePullRequest(ctx, githubv4.MergePullRequestInput{
+				PullRequestID:   pull.ID,
+				ExpectedHeadOid: gh.Ptr(githubv4.GitObjectID(pull.HeadRefOID)),
+				MergeMethod:     method,
+			})
+		} else {
+			autoMerge = true
+			updated, err = client.EnablePullRequestAutoMerge(ctx, githubv4.EnablePullRequestAutoMergeInput{
+				PullRequestID: pull.ID,
+				MergeMethod:   method,
+			})
+		}
+		if err != nil {
+			return nil, err
+		}
+		pull = updated
+		if pull.State != githubv4.PullRequestStateMerged {
+			_, _ = fmt.Fprint(os.Stderr,
+				"  - enabled auto-merge for pull request ", colors.UserInput(pull.Permalink),
+				"\n",
+			)
+		}
+	}
+
+	if pull.State != githubv4.PullRequestStateMerged && opts.Wait {
+		pull, err = waitForPullRequestMerge(ctx, client, pull, autoMerge)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if pull.State != githubv4.PullRequestStateMerged {
+		return &MergePullRequestResult{false, branch, pull}, nil
+	}
+
+	_, _ = fmt.Fprint(os.Stderr,
+		"  - ", colors.Success("merged"), " pull request ", colors.UserInput(pull.Permalink),
+		"\n",
+	)
+	branch, err = RecordPullRequestMerge(ctx, repo, client, repoMeta, branch, pull)
+	if err != nil {
+		return nil, err
+	}
+	return &MergePullRequestResult{true, branch, pull}, nil
+}
+
+// waitForPullRequestMerge polls the pull request until it is merged. It fails
+// if the pull request can't be merged without further action (it was closed,
+// auto-merge was disabled, or it is blocked or has conflicts) or if it isn't
+// merged within mergeWaitTimeout.
+func waitForPullRequestMerge(
+	ctx context.Context, client *gh.Client, pull *gh.PullRequest, autoMerge bool,
+) (*gh.PullRequest, error) {
+	_, _ = fmt.Fprint(os.Stderr,
+		"  - waiting for pull request ", colors.UserInput("#", pull.Number), " to be merged...\n",
+	)
+	timeout := time.NewTimer(mergeWaitTimeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(mergePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timeout.C:
+			return nil, errors.Errorf(
+				"timed out waiting for pull request #%d to be merged (after %s)",
+				pull.Number, mergeWaitTimeout,
+			)
+		case <-ticker.C:
+		}
+		latest, err := client.PullRequest(ctx, pull.ID)
+		if err != nil {
+			return nil, err
+		}
+		switch latest.State {
+		case githubv4.PullRequestStateMerged:
+			return latest, nil
+		case githubv4.PullRequestStateClosed:
+			return nil, errors.Errorf("pull request #%d was closed without being merged", latest.Number)
+		}
+		if autoMerge && latest.AutoMergeRequest == nil {
+			return nil, errors.Errorf("auto-merge was disabled for pull request #%d", latest.Number)
+		}
+		switch latest.MergeStateStatus {
+		case gh.MergeStateStatusBlocked:
+			return nil, errors.Errorf(
+				"pull request #%d is blocked from merging (e.g., by failing checks or missing reviews)",
+				latest.Number,
+			)
+		case gh.MergeStateStatusDirty:
+			return nil, errors.Errorf("pull request #%d has merge conflicts", latest.Number)
+		}
+		logrus.WithFields(logrus.Fields{
+			"pull":   latest.Number,
+			"status": latest.MergeStateStatus,
+		}).Debug("pull request not merged yet")
+	}
+}
+
+// RecordPullRequestMerge records the merge commit of a merged pull request in
+// the branch metadata and re-targets the pull requests of the branch's children
+// onto the trunk branch (so that they aren't closed by GitHub if the merged
+// branch is deleted). The children still need to be synced (which will happen
+// automatically during the next `av stack sync` since the merge commit is
+// recorded).
+func RecordPullRequestMerge(
+	ctx context.Context, repo *git.Repo, client *gh.Client, repoMeta meta.Repository,
+	branch meta.Branch, pull *gh.PullRequest,
+) (meta.Branch, error) {
+	branch.MergeCommit = pull.GetMergeCommit()
+	branch.PullRequest = &meta.PullRequest{
+		ID:        pull.ID,
+		Number:    pull.Number,
+		Permalink: pull.Permalink,
+		State:     pull.State,
+	}
+	if err := meta.WriteBranch(repo, branch); err != nil {
+		return branch, err
+	}
+
+	if err := RetargetChildPullRequests(ctx, repo, client, repoMeta, branch); err != nil {
+		return branch, err
+	}
+	return branch, nil
+}
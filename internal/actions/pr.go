@@ -17,6 +17,7 @@ import (
 	"github.com/aviator-co/av/internal/config"
 	"github.com/aviator-co/av/internal/gh"
 	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/hooks"
 	"github.com/aviator-co/av/internal/meta"
 	"github.com/aviator-co/av/internal/utils/browser"
 	"github.com/aviator-co/av/internal/utils/colors"
@@ -92,11 +93,35 @@ func CreatePullRequest(ctx context.Context, repo *git.Repo, client *gh.Client, o
 	if err != nil {
 		return nil, err
 	}
+	pushRemote := remote.Label
+	if repoMeta.Fork != nil {
+		pushRemote = repoMeta.Fork.Remote
+	}
 
 	_, _ = fmt.Fprint(os.Stderr,
 		"Creating pull request for branch ", colors.UserInput(opts.BranchName), ":",
 		"\n",
 	)
+
+	// figure this out based on whether or not we're on a stacked branch
+	branchMeta, _ := meta.ReadBranch(repo, opts.BranchName)
+	if !branchMeta.Parent.Trunk && repoMeta.Fork != nil {
+		// GitHub requires the base branch of a pull request to live in the
+		// repository that the pull request is opened against, but the parent
+		// branch only exists in the fork.
+		return nil, errors.Errorf(
+			"cannot create a stacked pull request for branch %q from a fork: "+
+				"the base branch of a pull request must exist in %s/%s, but parent branch %q "+
+				"is only pushed to the fork %s/%s (open a pull request for %q first and, "+
+				"once it has been merged, run `av stack sync` to re-target this branch onto the trunk)",
+			opts.BranchName, repoMeta.Owner, repoMeta.Name, branchMeta.Parent.Name,
+			repoMeta.Fork.Owner, repoMeta.Fork.Name, branchMeta.Parent.Name,
+		)
+	}
+	if err := hooks.Run(ctx, repo, hooks.PreSubmit, branchMeta); err != nil {
+		return nil, err
+	}
+
 	if !opts.NoPush || opts.ForcePush {
 		pushFlags := []string{"push"}
 
@@ -113,8 +138,8 @@ func CreatePullRequest(ctx context.Context, repo *git.Repo, client *gh.Client, o
 		})
 		if err != nil {
 			// Set the upstream branch
-			upstream = remote.Label + "/" + opts.BranchName
-			pushFlags = append(pushFlags, "--set-upstream", remote.Label, opts.BranchName)
+			upstream = pushRemote + "/" + opts.BranchName
+			pushFlags = append(pushFlags, "--set-upstream", pushRemote, opts.BranchName)
 		} else {
 			upstream = strings.TrimPrefix(upstream, "refs/remotes/")
 		}
@@ -124,6 +149,9 @@ func CreatePullRequest(ctx context.Context, repo *git.Repo, client *gh.Client, o
 			"  - pushing to ", color.CyanString("%s", upstream),
 			"\n",
 		)
+		if err := hooks.Run(ctx, repo, hooks.PrePush, branchMeta); err != nil {
+			return nil, err
+		}
 		if _, err := repo.Git(pushFlags...); err != nil {
 			return nil, errors.WrapIf(err, "failed to push")
 		}
@@ -134,8 +162,6 @@ func CreatePullRequest(ctx context.Context, repo *git.Repo, client *gh.Client, o
 		)
 	}
 
-	// figure this out based on whether or not we're on a stacked branch
-	branchMeta, _ := meta.ReadBranch(repo, opts.BranchName)
 	prBaseBranch := branchMeta.Parent.Name
 	var parentMeta meta.Branch
 	if !branchMeta.Parent.Trunk {
@@ -158,21 +184,13 @@ func CreatePullRequest(ctx context.Context, repo *git.Repo, client *gh.Client, o
 		logrus.WithField("base", prBaseBranch).Debug("base branch is a trunk branch")
 	}
 
-	commitsList, err := repo.Git("rev-list", "--reverse", fmt.Sprintf("%s..HEAD", prBaseBranch))
+	commits, err := pullRequestCommits(repo, prBaseBranch, "HEAD")
 	if err != nil {
-		return nil, errors.WrapIf(err, "failed to determine commits to include in PR")
+		return nil, err
 	}
-	if commitsList == "" {
+	if len(commits) == 0 {
 		return nil, errors.Errorf("no commits between %q and %q", prBaseBranch, opts.BranchName)
 	}
-	var commits []git.CommitInfo
-	for _, commitHash := range strings.Split(commitsList, "\n") {
-		commit, err := repo.CommitInfo(git.CommitInfoOpts{Rev: commitHash})
-		if err != nil {
-			return nil, errors.WrapIff(err, "failed to get commit info for %q", commitHash)
-		}
-		commits = append(commits, *commit)
-	}
 
 	if opts.Body == "" || opts.Title == "" {
 		// We need to open an editor to ask the user. Try to populate with
@@ -237,14 +255,15 @@ func CreatePullRequest(ctx context.Context, repo *git.Repo, client *gh.Client, o
 	}
 
 	// add the avbeta-stackedprs label to enable Aviator server-side stacked
-	// PRs functionality
+	// PRs functionality (as well as the labels from the config)
+	labels := append([]string{"avbeta-stackedprs"}, config.Av.PullRequest.Labels...)
 	if err := client.AddIssueLabels(ctx, gh.AddIssueLabelInput{
 		Owner:      repoMeta.Owner,
 		Repo:       repoMeta.Name,
 		Number:     pull.Number,
-		LabelNames: []string{"avbeta-stackedprs"},
+		LabelNames: labels,
 	}); err != nil {
-		return nil, errors.WrapIf(err, "adding avbeta-stackedprs label")
+		return nil, errors.WrapIff(err, "adding labels %s", strings.Join(labels, ", "))
 	}
 
 	var action string
@@ -269,19 +288,50 @@ func CreatePullRequest(ctx context.Context, repo *git.Repo, client *gh.Client, o
 		}
 	}
 
+	hooks.RunPost(ctx, repo, hooks.PostSubmit, branchMeta)
 	return &CreatePullRequestResult{didCreatePR, branchMeta, pull}, nil
 }
 
+// pullRequestCommits returns the commits that are included in a pull request
+// from head into base (in chronological order).
+func pullRequestCommits(repo *git.Repo, base string, head string) ([]git.CommitInfo, error) {
+	commitsList, err := repo.Git("rev-list", "--reverse", fmt.Sprintf("%s..%s", base, head))
+	if err != nil {
+		return nil, errors.WrapIf(err, "failed to determine commits to include in PR")
+	}
+	if commitsList == "" {
+		return nil, nil
+	}
+	var commits []git.CommitInfo
+	for _, commitHash := range strings.Split(commitsList, "\n") {
+		commit, err := repo.CommitInfo(git.CommitInfoOpts{Rev: commitHash})
+		if err != nil {
+			return nil, errors.WrapIff(err, "failed to get commit info for %q", commitHash)
+		}
+		commits = append(commits, *commit)
+	}
+	return commits, nil
+}
+
 type prBodyTemplateData struct {
 	Branch  string
 	Title   string
 	Body    string
 	Commits []git.CommitInfo
+	// If true, the template is used to edit an existing pull request.
+	Editing bool
 }
 
-var prBodyTemplate = template.Must(template.New("prBody").Parse(`%% Creating pull request for branch '{{ .Branch }}'
+var prBodyTemplate = template.Must(template.New("prBody").Parse(`
+{{- if .Editing -}}
+%% Editing pull request for branch '{{ .Branch }}'
+%% Lines starting with '%%' will be ignored and an empty message aborts the
+%% update of the pull request.
+{{- else -}}
+%% Creating pull request for branch '{{ .Branch }}'
 %% Lines starting with '%%' will be ignored and an empty message aborts the
 %% creation of the pull request.
+{{- end }}
 
 %% Pull request title (single line)
 {{ .Title }}
@@ -319,10 +369,11 @@ type ensurePROpts struct {
 // occurred.
 func ensurePR(ctx context.Context, client *gh.Client, repoMeta meta.Repository, opts ensurePROpts) (*gh.PullRequest, bool, error) {
 	existing, err := client.GetPullRequests(ctx, gh.GetPullRequestsInput{
-		Owner:       repoMeta.Owner,
-		Repo:        repoMeta.Name,
-		HeadRefName: opts.headRefName,
-		States:      []githubv4.PullRequestState{githubv4.PullRequestStateOpen},
+		Owner:               repoMeta.Owner,
+		Repo:                repoMeta.Name,
+		HeadRefName:         opts.headRefName,
+		HeadRepositoryOwner: repoMeta.HeadOwner(),
+		States:              []githubv4.PullRequestState{githubv4.PullRequestStateOpen},
 	})
 	if err != nil {
 		return nil, false, errors.WrapIf(err, "querying existing pull requests")
@@ -354,13 +405,18 @@ func ensurePR(ctx context.Context, client *gh.Client, repoMeta meta.Repository,
 		return &existing.PullRequests[0], false, nil
 	}
 
-	pull, err := client.CreatePullRequest(ctx, githubv4.CreatePullRequestInput{
-		RepositoryID: githubv4.ID(repoMeta.ID),
-		BaseRefName:  githubv4.String(opts.baseRefName),
-		HeadRefName:  githubv4.String(opts.headRefName),
-		Title:        githubv4.String(opts.title),
-		Body:         gh.Ptr(githubv4.String(AddPRMetadata(opts.body, opts.meta))),
-		Draft:        gh.Ptr(githubv4.Boolean(opts.draft)),
+	var headRepositoryID *githubv4.ID
+	if repoMeta.Fork != nil {
+		headRepositoryID = gh.Ptr(githubv4.ID(repoMeta.Fork.ID))
+	}
+	pull, err := client.CreatePullRequest(ctx, gh.CreatePullRequestInput{
+		RepositoryID:     githubv4.ID(repoMeta.ID),
+		HeadRepositoryID: headRepositoryID,
+		BaseRefName:      githubv4.String(opts.baseRefName),
+		HeadRefName:      githubv4.String(opts.headRefName),
+		Title:            githubv4.String(opts.title),
+		Body:             gh.Ptr(githubv4.String(AddPRMetadata(opts.body, opts.meta))),
+		Draft:            gh.Ptr(githubv4.Boolean(opts.draft)),
 	})
 	if err != nil {
 		return nil, false, errors.WrapIf(err, "opening pull request")
@@ -389,25 +445,17 @@ func UpdatePullRequestState(ctx context.Context, repo *git.Repo, client *gh.Clie
 	branch, _ := meta.ReadBranch(repo, branchName)
 
 	page, err := client.GetPullRequests(ctx, gh.GetPullRequestsInput{
-		Owner:       repoMeta.Owner,
-		Repo:        repoMeta.Name,
-		HeadRefName: branchName,
+		Owner:               repoMeta.Owner,
+		Repo:                repoMeta.Name,
+		HeadRefName:         branchName,
+		HeadRepositoryOwner: repoMeta.HeadOwner(),
 	})
 	if err != nil {
 		return nil, errors.WrapIf(err, "querying GitHub pull requests")
 	}
 
-	if len(page.PullRequests) == 0 {
+	if len(page.PullRequests) == 0 && branch.PullRequest == nil {
 		// branch has no pull request
-		if branch.PullRequest != nil {
-			// This should never happen?
-			logrus.WithFields(logrus.Fields{
-				"branch": branch.Name,
-				"pull":   branch.PullRequest.Permalink,
-			}).Error("GitHub reported no pull requests for branch but local metadata has pull request")
-			return nil, errors.New("GitHub reported no pull requests for branch but local metadata has pull request")
-		}
-
 		return &UpdatePullRequestResult{false, branch, nil}, nil
 	}
 
@@ -466,7 +514,11 @@ func UpdatePullRequestState(ctx context.Context, repo *git.Repo, client *gh.Clie
 	} else {
 		// openPull is nil so the PR should be merged or closed
 		if currentPull != nil {
-			branch.MergeCommit = currentPull.GetMergeCommit()
+			mergeCommit := currentPull.GetMergeCommit()
+			if branch.PullRequest.State != currentPull.State || branch.MergeCommit != mergeCommit {
+				changed = true
+			}
+			branch.MergeCommit = mergeCommit
 			branch.PullRequest = &meta.PullRequest{
 				ID:        currentPull.ID,
 				Number:    currentPull.Number,
@@ -474,7 +526,8 @@ func UpdatePullRequestState(ctx context.Context, repo *git.Repo, client *gh.Clie
 				State:     currentPull.State,
 			}
 		} else {
-			// openPull and currentPull is nil
+			// openPull and currentPull is nil (this can happen if the pull
+			// request was deleted or the branch was renamed)
 			if branch.PullRequest != nil {
 				_, _ = fmt.Fprint(os.Stderr,
 					"  - ", colors.Failure("ERROR:"),
@@ -551,6 +604,21 @@ func ReadPRMetadata(body string) (PRMetadata, error) {
 	return prMeta, err
 }
 
+// RemovePRMetadata returns the given pull request body with the av metadata
+// comment (if any) removed.
+func RemovePRMetadata(body string) string {
+	commentStart, commentEnd, _, err := ParsePRMetadata(body)
+	if err != nil {
+		return body
+	}
+	before := strings.TrimSpace(body[:commentStart])
+	after := strings.TrimSpace(body[commentEnd:])
+	if before == "" || after == "" {
+		return before + after
+	}
+	return before + "\n\n" + after
+}
+
 func AddPRMetadata(body string, prMeta PRMetadata) string {
 	buf := bytes.NewBufferString(body)
 	if commentStart, commentEnd, _, err := ParsePRMetadata(body); err != nil {
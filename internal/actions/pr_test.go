@@ -55,3 +55,24 @@ func TestPRMetadataPreservesBody(t *testing.T) {
 	assert.Contains(t, body2, "It's very neat, actually.")
 	assert.Contains(t, body2, "\n"+actions.PRMetadataCommentStart)
 }
+
+func TestRemovePRMetadata(t *testing.T) {
+	sampleMeta := actions.PRMetadata{
+		Parent:     "foo",
+		ParentHead: "bar",
+		ParentPull: 123,
+		Trunk:      "baz",
+	}
+	body := actions.AddPRMetadata("Hello! This is a cool PR that does some neat things.", sampleMeta)
+	assert.Equal(t, "Hello! This is a cool PR that does some neat things.", actions.RemovePRMetadata(body))
+
+	// Text after the metadata comment should be preserved
+	body += "\n\nIt's very neat, actually."
+	assert.Equal(t,
+		"Hello! This is a cool PR that does some neat things.\n\nIt's very neat, actually.",
+		actions.RemovePRMetadata(body),
+	)
+
+	// Bodies without metadata should be returned unchanged
+	assert.Equal(t, "No metadata here.", actions.RemovePRMetadata("No metadata here."))
+}
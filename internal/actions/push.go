@@ -7,6 +7,8 @@ import (
 
 	"emperror.dev/errors"
 	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/hooks"
+	"github.com/aviator-co/av/internal/meta"
 	"github.com/aviator-co/av/internal/utils/colors"
 	"github.com/kr/text"
 	"github.com/sirupsen/logrus"
@@ -24,7 +26,9 @@ const (
 )
 
 type PushOpts struct {
-	Force ForceOpt
+	// The branch to push. If empty, the current branch is pushed.
+	Branch string
+	Force  ForceOpt
 	// If true, require the upstream tracking information to already be set
 	// (otherwise, don't push).
 	SkipIfUpstreamNotSet bool
@@ -34,16 +38,20 @@ type PushOpts struct {
 	SkipIfUpstreamMatches bool
 }
 
-// Push pushes the current branch to the Git remote.
+// Push pushes the branch (by default, the current branch) to the Git remote.
 // It does not check out the given branch.
 func Push(repo *git.Repo, opts PushOpts) error {
-	currentBranch, err := repo.CurrentBranchName()
-	if err != nil {
-		return errors.WrapIff(err, "failed to determine current branch")
+	currentBranch := opts.Branch
+	if currentBranch == "" {
+		var err error
+		currentBranch, err = repo.CurrentBranchName()
+		if err != nil {
+			return errors.WrapIff(err, "failed to determine current branch")
+		}
 	}
 
 	if opts.SkipIfUpstreamNotSet || opts.SkipIfUpstreamMatches {
-		upstream, err := repo.RevParse(&git.RevParse{Rev: "@{upstream}"})
+		upstream, err := repo.RevParse(&git.RevParse{Rev: currentBranch + "@{upstream}"})
 		if opts.SkipIfUpstreamMatches && git.StderrMatches(err, "no upstream") {
 			_, _ = fmt.Fprint(os.Stderr,
 				"  - not pushing branch ", colors.UserInput(currentBranch),
@@ -58,7 +66,7 @@ func Push(repo *git.Repo, opts PushOpts) error {
 			return errors.WrapIff(err, "failed to determine upstream tracking information for branch %q", currentBranch)
 		}
 
-		head, err := repo.RevParse(&git.RevParse{Rev: "HEAD"})
+		head, err := repo.RevParse(&git.RevParse{Rev: "refs/heads/" + currentBranch})
 		if err != nil {
 			return errors.WrapIff(err, "failed to determine branch HEAD for branch %q", currentBranch)
 		}
@@ -71,6 +79,11 @@ func Push(repo *git.Repo, opts PushOpts) error {
 		}
 	}
 
+	branch, _ := meta.ReadBranch(repo, currentBranch)
+	if err := hooks.Run(repo.Context(), repo, hooks.PrePush, branch); err != nil {
+		return err
+	}
+
 	_, _ = fmt.Fprint(os.Stderr,
 		"  - pushing ", colors.UserInput(currentBranch), "... ",
 	)
@@ -83,6 +96,13 @@ func Push(repo *git.Repo, opts PushOpts) error {
 	case ForcePush:
 		pushArgs = append(pushArgs, "--force")
 	}
+	// Always tell git where to push the branch: it isn't necessarily checked
+	// out and git would push to origin by default.
+	refspec, err := pushRefspec(repo, currentBranch)
+	if err != nil {
+		return err
+	}
+	pushArgs = append(pushArgs, refspec...)
 	res, err := repo.Run(&git.RunOpts{
 		Args: pushArgs,
 	})
@@ -122,3 +142,19 @@ func Push(repo *git.Repo, opts PushOpts) error {
 	)
 	return nil
 }
+
+// pushRefspec returns the remote and refspec to push the branch to its
+// upstream (or to the branch of the same name in the default remote if no
+// upstream is configured).
+func pushRefspec(repo *git.Repo, branch string) ([]string, error) {
+	remote, _ := repo.Git("config", "--get", "branch."+branch+".remote")
+	merge, _ := repo.Git("config", "--get", "branch."+branch+".merge")
+	if remote == "" || merge == "" {
+		defaultRemote, err := repo.DefaultRemote()
+		if err != nil {
+			return nil, err
+		}
+		return []string{defaultRemote.Label, branch}, nil
+	}
+	return []string{remote, "refs/heads/" + branch + ":" + merge}, nil
+}
@@ -0,0 +1,138 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/gh"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/utils/colors"
+)
+
+type RebuildMetadataResult struct {
+	// The pull requests that were imported (in topological order).
+	Imported []PullRequestImport
+	// The pull requests whose av metadata doesn't match the base branch that
+	// is set on GitHub.
+	Conflicts []RebuildMetadataConflict
+}
+
+type RebuildMetadataConflict struct {
+	Pull *gh.PullRequest
+	// The parent branch according to the av metadata embedded in the pull
+	// request body.
+	MetadataParent string
+}
+
+// RebuildMetadata reconstructs the av metadata for every open pull request that
+// was authored by the current GitHub user (and every pull request that those
+// are stacked on top of). Local branches are created for each pull request if
+// they don't already exist.
+func RebuildMetadata(
+	ctx context.Context, repo *git.Repo, client *gh.Client, repoMeta meta.Repository,
+) (*RebuildMetadataResult, error) {
+	viewer, err := client.Viewer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defaultBranch, err := repo.DefaultBranch()
+	if err != nil {
+		return nil, err
+	}
+
+	var queue []*gh.PullRequest
+	var cursor string
+	for {
+		// Let GitHub find the user's pull requests: listing every open pull
+		// request in the repository is slow for large repositories.
+		page, err := client.SearchPullRequests(ctx, gh.SearchPullRequestsInput{
+			Query: fmt.Sprintf("repo:%s/%s is:open author:%s", repoMeta.Owner, repoMeta.Name, viewer.Login),
+			After: cursor,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to fetch pull requests from GitHub")
+		}
+		for i := range page.PullRequests {
+			queue = append(queue, &page.PullRequests[i])
+		}
+		if !page.HasNextPage {
+			break
+		}
+		cursor = page.EndCursor
+	}
+	_, _ = fmt.Fprint(os.Stderr,
+		"Found ", colors.UserInput(len(queue)), " open pull requests by ", colors.UserInput(viewer.Login),
+		"\n",
+	)
+
+	// Determine the parent of every pull request (including the pull requests
+	// of parent branches which might have been authored by somebody else).
+	imports := make(map[string]PullRequestImport)
+	for len(queue) > 0 {
+		pull := queue[0]
+		queue = queue[1:]
+		if _, ok := imports[pull.HeadBranchName()]; ok {
+			continue
+		}
+		imp, parentPull, err := stackedPullRequestParent(ctx, client, repoMeta, defaultBranch, pull)
+		if err != nil {
+			return nil, err
+		}
+		imports[pull.HeadBranchName()] = imp
+		if parentPull != nil {
+			queue = append(queue, parentPull)
+		}
+	}
+
+	res := &RebuildMetadataResult{}
+	for _, imp := range imports {
+		if imp.Parent != imp.Pull.BaseBranchName() {
+			res.Conflicts = append(res.Conflicts, RebuildMetadataConflict{
+				Pull:           imp.Pull,
+				MetadataParent: imp.Parent,
+			})
+		}
+	}
+	sort.Slice(res.Conflicts, func(i, j int) bool {
+		return res.Conflicts[i].Pull.Number < res.Conflicts[j].Pull.Number
+	})
+
+	// Sort the imports topologically (by the depth within their stack) so that
+	// every parent is imported before its children.
+	depths := make(map[string]int)
+	var depth func(name string) int
+	depth = func(name string) int {
+		if d, ok := depths[name]; ok {
+			return d
+		}
+		imp, ok := imports[name]
+		if !ok || imp.ParentTrunk {
+			return 0
+		}
+		// Guard against cycles in the metadata
+		depths[name] = 0
+		d := depth(imp.Parent) + 1
+		depths[name] = d
+		return d
+	}
+	for name := range imports {
+		res.Imported = append(res.Imported, imports[name])
+	}
+	sort.Slice(res.Imported, func(i, j int) bool {
+		a, b := res.Imported[i].Pull, res.Imported[j].Pull
+		da, db := depth(a.HeadBranchName()), depth(b.HeadBranchName())
+		if da != db {
+			return da < db
+		}
+		return a.Number < b.Number
+	})
+
+	if err := ImportPullRequests(repo, res.Imported); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -87,7 +87,7 @@ func Reparent(repo *git.Repo, opts ReparentOpts) (*ReparentResult, error) {
 		"onto_head":   parentSha,
 		"upstream":    upstream,
 	}).Debug("rebasing branch")
-	output, err := repo.Rebase(git.RebaseOpts{
+	rebase, err := repo.RebaseParse(git.RebaseOpts{
 		Onto:     opts.NewParent,
 		Upstream: upstream,
 		Branch:   opts.Branch,
@@ -95,8 +95,20 @@ func Reparent(repo *git.Repo, opts ReparentOpts) (*ReparentResult, error) {
 	if err != nil {
 		return nil, errors.WrapIff(err, "failed to run git rebase")
 	}
+	if rebase.Status == git.RebaseConflict {
+		_, _ = fmt.Fprint(os.Stderr,
+			colors.Failure("      - ERROR:"),
+			" conflict while rebasing branch ", colors.UserInput(opts.Branch),
+			" onto ", colors.UserInput(opts.NewParent),
+			"\n",
+		)
+		return &ReparentResult{Success: false, Hint: rebase.Hint}, nil
+	}
 
-	return handleReparentRebaseOutput(repo, opts, output)
+	if err := reparentWriteMetadata(repo, opts); err != nil {
+		return nil, err
+	}
+	return &ReparentResult{Success: true}, nil
 }
 
 func ReparentContinue(repo *git.Repo, opts ReparentOpts) (*ReparentResult, error) {
@@ -126,7 +138,8 @@ func ReparentContinue(repo *git.Repo, opts ReparentOpts) (*ReparentResult, error
 func reparentWriteMetadata(repo *git.Repo, opts ReparentOpts) error {
 	branch := opts.Branch
 	newParentName := opts.NewParent
-	branchMeta, _ := meta.ReadBranch(repo, branch)
+	tx := meta.NewTx(repo)
+	branchMeta, _ := tx.ReadBranch(branch)
 	oldParent := branchMeta.Parent
 
 	var err error
@@ -134,31 +147,27 @@ func reparentWriteMetadata(repo *git.Repo, opts ReparentOpts) error {
 	if err != nil {
 		return err
 	}
-
-	if err := meta.WriteBranch(repo, branchMeta); err != nil {
-		return errors.WrapIff(err, "failed to write branch meta for %q", branch)
-	}
+	tx.WriteBranch(branchMeta)
 
 	// Make sure to delete the reference to this branch from the old parent if
 	// necessary.
 	if !oldParent.Trunk {
-		if oldParentMeta, ok := meta.ReadBranch(repo, oldParent.Name); ok {
+		if oldParentMeta, ok := tx.ReadBranch(oldParent.Name); ok {
 			oldParentMeta.Children = sliceutils.DeleteElement(oldParentMeta.Children, branch)
-			if err := meta.WriteBranch(repo, oldParentMeta); err != nil {
-				return errors.WrapIff(err, "failed to write branch meta for %q", oldParent.Name)
-			}
+			tx.WriteBranch(oldParentMeta)
 		}
 	}
 
 	// Add this branch as a child of the new parent (unless its a trunk branch)
 	if !opts.NewParentTrunk {
-		newParentMeta, _ := meta.ReadBranch(repo, newParentName)
+		newParentMeta, _ := tx.ReadBranch(newParentName)
 		newParentMeta.Children = append(newParentMeta.Children, branch)
-		if err := meta.WriteBranch(repo, newParentMeta); err != nil {
-			return errors.WrapIff(err, "failed to write branch meta for %q", newParentName)
-		}
+		tx.WriteBranch(newParentMeta)
 	}
 
+	if err := tx.Commit(); err != nil {
+		return errors.WrapIff(err, "failed to write branch meta for %q", branch)
+	}
 	return nil
 }
 
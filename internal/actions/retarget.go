@@ -0,0 +1,165 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/gh"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+)
+
+// RetargetChildPullRequests changes the base branch of the pull requests of
+// the direct children of a merged branch to the trunk branch. This should
+// happen as soon as possible after the branch is merged: if GitHub deletes the
+// merged branch, it also closes every pull request that targets it.
+func RetargetChildPullRequests(
+	ctx context.Context, repo *git.Repo, client *gh.Client,
+	repoMeta meta.Repository, branch meta.Branch,
+) error {
+	if !branch.Parent.Trunk {
+		logrus.WithField("branch", branch.Name).Debug("not re-targeting children of branch that was not merged into trunk")
+		return nil
+	}
+	for _, childName := range branch.Children {
+		child, _ := meta.ReadBranch(repo, childName)
+		if child.PullRequest == nil || child.PullRequest.ID == "" || child.MergeCommit != "" {
+			continue
+		}
+		if _, _, err := RetargetPullRequest(ctx, repo, client, repoMeta, child, nil, branch.Parent.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RetargetPullRequest changes the base branch of the pull request for the
+// given branch. If GitHub already closed the pull request (which happens when
+// the previous base branch was deleted), the pull request is reopened or, if
+// that isn't possible, re-created with the same title, body, and reviewers.
+// The pull may be nil, in which case the PR info is fetched from GitHub.
+// It returns the updated branch metadata and pull request.
+func RetargetPullRequest(
+	ctx context.Context, repo *git.Repo, client *gh.Client, repoMeta meta.Repository,
+	branch meta.Branch, pull *gh.PullRequest, base string,
+) (meta.Branch, *gh.PullRequest, error) {
+	if pull == nil {
+		var err error
+		pull, err = client.PullRequest(ctx, branch.PullRequest.ID)
+		if err != nil {
+			return branch, nil, errors.WrapIff(err, "failed to fetch pull request info for %q", branch.Name)
+		}
+	}
+
+	switch pull.State {
+	case githubv4.PullRequestStateMerged:
+		return branch, pull, nil
+	case githubv4.PullRequestStateOpen:
+		if pull.BaseBranchName() == base {
+			return branch, pull, nil
+		}
+	case githubv4.PullRequestStateClosed:
+		_, _ = fmt.Fprint(os.Stderr,
+			"  - pull request ", colors.UserInput("#", pull.Number),
+			" (", colors.UserInput(branch.Name), ") was closed, reopening it\n",
+		)
+		reopened, err := client.ReopenPullRequest(ctx, pull.ID)
+		if err != nil {
+			// GitHub refuses to reopen pull requests whose base branch was
+			// deleted, so we have to create a new one instead.
+			logrus.WithError(err).Debug("failed to reopen pull request")
+			return recreatePullRequest(ctx, repo, client, repoMeta, branch, pull, base)
+		}
+		pull = reopened
+		branch.PullRequest.State = pull.State
+		if err := meta.WriteBranch(repo, branch); err != nil {
+			return branch, nil, err
+		}
+		if pull.BaseBranchName() == base {
+			return branch, pull, nil
+		}
+	}
+
+	_, _ = fmt.Fprint(os.Stderr,
+		"  - updating base branch of pull request ", colors.UserInput("#", pull.Number),
+		" (", colors.UserInput(branch.Name), ") to ", colors.UserInput(base), "\n",
+	)
+	updated, err := client.UpdatePullRequest(ctx, githubv4.UpdatePullRequestInput{
+		PullRequestID: pull.ID,
+		BaseRefName:   gh.Ptr(githubv4.String(base)),
+	})
+	if err != nil {
+		return branch, nil, errors.WrapIff(err, "failed to update base branch of pull request for %q", branch.Name)
+	}
+	return branch, updated, nil
+}
+
+// recreatePullRequest opens a new pull request for the branch that replaces the
+// given (closed) pull request.
+func recreatePullRequest(
+	ctx context.Context, repo *git.Repo, client *gh.Client, repoMeta meta.Repository,
+	branch meta.Branch, old *gh.PullRequest, base string,
+) (meta.Branch, *gh.PullRequest, error) {
+	reviewers, err := client.PullRequestReviewers(ctx, old.ID)
+	if err != nil {
+		return branch, nil, err
+	}
+
+	var headRepositoryID *githubv4.ID
+	if repoMeta.Fork != nil {
+		headRepositoryID = gh.Ptr(githubv4.ID(repoMeta.Fork.ID))
+	}
+	pull, err := client.CreatePullRequest(ctx, gh.CreatePullRequestInput{
+		RepositoryID:     githubv4.ID(repoMeta.ID),
+		HeadRepositoryID: headRepositoryID,
+		BaseRefName:      githubv4.String(base),
+		HeadRefName:      githubv4.String(branch.Name),
+		Title:            githubv4.String(old.Title),
+		Body:             gh.Ptr(githubv4.String(old.Body)),
+		Draft:            gh.Ptr(githubv4.Boolean(old.IsDraft)),
+	})
+	if err != nil {
+		return branch, nil, errors.WrapIff(err, "failed to re-create pull request for %q", branch.Name)
+	}
+	_, _ = fmt.Fprint(os.Stderr,
+		"  - created pull request ", colors.UserInput(pull.Permalink),
+		" to replace closed pull request ", colors.UserInput("#", old.Number), "\n",
+	)
+
+	if len(reviewers.UserIDs) > 0 || len(reviewers.TeamIDs) > 0 {
+		input := githubv4.RequestReviewsInput{
+			PullRequestID: pull.ID,
+			Union:         gh.Ptr(githubv4.Boolean(true)),
+		}
+		if len(reviewers.UserIDs) > 0 {
+			input.UserIDs = &reviewers.UserIDs
+		}
+		if len(reviewers.TeamIDs) > 0 {
+			input.TeamIDs = &reviewers.TeamIDs
+		}
+		if _, err := client.RequestReviews(ctx, input); err != nil {
+			// Not fatal: the pull request was created, the user just needs to
+			// re-request reviews manually.
+			_, _ = fmt.Fprint(os.Stderr,
+				"  - ", colors.Warning("WARNING:"), " failed to request reviews for pull request ",
+				colors.UserInput("#", pull.Number), ": ", err.Error(), "\n",
+			)
+		}
+	}
+
+	branch.PullRequest = &meta.PullRequest{
+		ID:        pull.ID,
+		Number:    pull.Number,
+		Permalink: pull.Permalink,
+		State:     pull.State,
+	}
+	if err := meta.WriteBranch(repo, branch); err != nil {
+		return branch, nil, err
+	}
+	return branch, pull, nil
+}
@@ -78,7 +78,7 @@ func SyncBranch(
 			}
 			branch = update.Branch
 			pull = update.Pull
-			if update.Changed {
+			if update.Changed && update.Pull != nil {
 				_, _ = fmt.Fprint(os.Stderr, "      - found updated pull request: ", colors.UserInput(update.Pull.Permalink), "\n")
 			}
 			branch = update.Branch
@@ -97,11 +97,32 @@ func SyncBranch(
 					"(merged in commit ", colors.UserInput(git.ShortSha(branch.MergeCommit)), ")"+
 					"\n",
 			)
+			// Make sure the pull requests of the children don't get closed
+			// by GitHub when this branch is deleted.
+			if !opts.NoFetch {
+				if err := RetargetChildPullRequests(ctx, repo, client, repoMeta, branch); err != nil {
+					return nil, err
+				}
+			}
 			return &SyncBranchResult{
 				RebaseResult: git.RebaseResult{Status: git.RebaseAlreadyUpToDate},
 			}, nil
 		}
 
+		// If the parent was merged, re-target the pull request onto the trunk
+		// before anything else (in case the rebase below results in a
+		// conflict).
+		if !opts.NoFetch && !branch.Parent.Trunk && branch.PullRequest != nil {
+			parent, _ := meta.ReadBranch(repo, branch.Parent.Name)
+			if parent.MergeCommit != "" && parent.Parent.Trunk {
+				var err error
+				branch, pull, err = RetargetPullRequest(ctx, repo, client, repoMeta, branch, pull, parent.Parent.Name)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
 		var err error
 		res, err = syncBranchRebase(ctx, repo, opts, branch)
 		if err != nil {
@@ -218,7 +239,7 @@ func syncBranchRebase(
 			" on top of merge commit ", colors.UserInput(short), "\n",
 		)
 		if !opts.NoFetch {
-			if _, err := repo.Git("fetch", remote.Label, branch.MergeCommit); err != nil {
+			if _, err := repo.Git("fetch", remote.Label, parent.MergeCommit); err != nil {
 				return nil, errors.WrapIff(err, "failed to fetch merge commit %q from remote", short)
 			}
 		}
@@ -401,28 +422,28 @@ func syncBranchContinue(
 }
 
 func syncBranchUpdateNewTrunk(repo *git.Repo, branch meta.Branch, newTrunk string) (meta.Branch, error) {
-	oldParent, _ := meta.ReadBranch(repo, branch.Parent.Name)
+	tx := meta.NewTx(repo)
+	oldParent, _ := tx.ReadBranch(branch.Parent.Name)
 	var err error
 	branch.Parent, err = meta.ReadBranchState(repo, newTrunk, true)
 	if err != nil {
 		return branch, err
 	}
-	_, _ = fmt.Fprint(os.Stderr,
-		"  - this branch is now a stack root based on trunk branch ",
-		colors.UserInput(branch.Parent.Name), "\n",
-	)
-	if err := meta.WriteBranch(repo, branch); err != nil {
-		return branch, err
-	}
+	tx.WriteBranch(branch)
 
 	// Remove from the old parent branches metadata
 	if len(oldParent.Children) > 0 {
 		oldParent.Children = sliceutils.DeleteElement(oldParent.Children, branch.Name)
-		if err := meta.WriteBranch(repo, oldParent); err != nil {
-			return branch, err
-		}
+		tx.WriteBranch(oldParent)
+	}
+	if err := tx.Commit(); err != nil {
+		return branch, err
 	}
 
+	_, _ = fmt.Fprint(os.Stderr,
+		"  - this branch is now a stack root based on trunk branch ",
+		colors.UserInput(branch.Parent.Name), "\n",
+	)
 	return branch, nil
 }
 
@@ -477,6 +498,7 @@ func syncBranchPushAndUpdatePullRequest(
 	}
 
 	if err := Push(repo, PushOpts{
+		Branch:                branch.Name,
 		Force:                 ForceWithLease,
 		SkipIfUpstreamNotSet:  true,
 		SkipIfUpstreamMatches: true,
@@ -0,0 +1,142 @@
+// Package auth discovers the GitHub token that av uses to talk to the GitHub
+// API.
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/config"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/sirupsen/logrus"
+)
+
+// Source describes where a token was found.
+type Source string
+
+const (
+	SourceEnv           Source = "environment variable"
+	SourceConfig        Source = "av config file"
+	SourceGhCli         Source = "gh CLI"
+	SourceGitCredential Source = "git credential helper"
+	SourceStore         Source = "av credential store"
+)
+
+type Token struct {
+	Value  string
+	Source Source
+	// The GitHub host that the token belongs to (e.g., github.com).
+	Host string
+}
+
+// envVars is the list of environment variables that are checked for a GitHub
+// token (in order of precedence).
+var envVars = []string{"AV_GITHUB_TOKEN", "GITHUB_TOKEN"}
+
+// Host returns the GitHub host that is used by the repository (e.g.,
+// github.com). The repository may be nil, in which case the host is
+// determined from the av config.
+func Host(repo *git.Repo) string {
+	if repo != nil {
+		if remote, err := repo.DefaultRemote(); err == nil && remote.URL.Hostname() != "" {
+			return remote.URL.Hostname()
+		}
+	}
+	if u, err := url.Parse(config.Av.GitHub.BaseUrl); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return "github.com"
+}
+
+// Resolve finds the GitHub token for the given host. The following sources are
+// checked in order:
+//  1. The github.token key of the av config, which is read from the config
+//     files and the AV_GITHUB_TOKEN and GITHUB_TOKEN environment variables
+//  2. The av credential store (written by `av auth login`)
+//  3. The gh CLI (https://cli.github.com) configuration
+//  4. The configured git credential helpers
+//
+// Tokens that were configured explicitly for av always win over the tokens
+// that av discovers from other tools. Within the av config, the environment
+// variables take precedence over the config files (like for every other config
+// key, see config.Load) so that the token can be overridden for a single
+// command.
+//
+// The repository may be nil (in which case repository-specific git credential
+// helpers are not considered).
+func Resolve(repo *git.Repo, host string) (*Token, error) {
+	if config.Av.GitHub.Token != "" {
+		source := SourceConfig
+		if key, err := config.LookupKey("github.token"); err == nil && strings.HasPrefix(config.Source(key), "$") {
+			source = SourceEnv
+		}
+		return &Token{config.Av.GitHub.Token, source, host}, nil
+	}
+	// The environment is part of the config, but the config might not have
+	// been loaded (e.g., outside of a repository).
+	for _, name := range envVars {
+		if token := os.Getenv(name); token != "" {
+			return &Token{token, SourceEnv, host}, nil
+		}
+	}
+
+	sources := []struct {
+		source Source
+		lookup func() (string, error)
+	}{
+		{SourceStore, func() (string, error) { return ReadStore(host) }},
+		{SourceGhCli, func() (string, error) { return ghCliToken(host) }},
+		{SourceGitCredential, func() (string, error) { return gitCredentialToken(repo, host) }},
+	}
+	for _, s := range sources {
+		token, err := s.lookup()
+		if err != nil {
+			logrus.WithError(err).WithField("source", s.source).Debug("failed to read GitHub token")
+			continue
+		}
+		if token != "" {
+			logrus.WithField("source", s.source).Debug("found GitHub token")
+			return &Token{token, s.source, host}, nil
+		}
+	}
+
+	return nil, errors.Errorf(
+		"no GitHub token found for %s (run `av auth login` or set the GITHUB_TOKEN environment variable)",
+		host,
+	)
+}
+
+// gitCredentialToken asks the configured git credential helpers for the
+// password for the given host. Interactive prompts are disabled so that this
+// never blocks waiting for user input.
+func gitCredentialToken(repo *git.Repo, host string) (string, error) {
+	cmd := exec.Command("git", "credential", "fill")
+	if repo != nil {
+		cmd.Dir = repo.Dir()
+	}
+	cmd.Stdin = strings.NewReader("protocol=https\nhost=" + host + "\n\n")
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GCM_INTERACTIVE=never")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return "", errors.Wrap(err, "git credential fill")
+	}
+	return parseGitCredential(stdout.Bytes()), nil
+}
+
+// parseGitCredential returns the password from the output of
+// `git credential fill`.
+func parseGitCredential(out []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "password=") {
+			return strings.TrimPrefix(line, "password=")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package auth_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aviator-co/av/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	token, err := auth.ReadStore("github.com")
+	require.NoError(t, err)
+	assert.Equal(t, "", token, "empty store should not contain a token")
+
+	require.NoError(t, auth.WriteStore("github.com", "ghp_abc123"))
+	require.NoError(t, auth.WriteStore("github.example.com", "ghp_def456"))
+
+	token, err = auth.ReadStore("github.com")
+	require.NoError(t, err)
+	assert.Equal(t, "ghp_abc123", token)
+	token, err = auth.ReadStore("github.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "ghp_def456", token)
+
+	// The token shouldn't be stored in plain text
+	data, err := os.ReadFile(filepath.Join(auth.StoreDir(), "credentials.json"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "ghp_abc123")
+
+	deleted, err := auth.DeleteStore("github.com")
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	token, err = auth.ReadStore("github.com")
+	require.NoError(t, err)
+	assert.Equal(t, "", token)
+
+	deleted, err = auth.DeleteStore("github.com")
+	require.NoError(t, err)
+	assert.False(t, deleted)
+}
+
+func TestResolveGhCli(t *testing.T) {
+	for _, name := range []string{"AV_GITHUB_TOKEN", "GITHUB_TOKEN"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	ghDir := t.TempDir()
+	t.Setenv("GH_CONFIG_DIR", ghDir)
+	require.NoError(t, os.WriteFile(filepath.Join(ghDir, "hosts.yml"), []byte(`github.com:
+    user: octocat
+    oauth_token: gho_fromghcli
+    git_protocol: https
+`), 0o600))
+
+	token, err := auth.Resolve(nil, "github.com")
+	require.NoError(t, err)
+	assert.Equal(t, "gho_fromghcli", token.Value)
+	assert.Equal(t, auth.SourceGhCli, token.Source)
+
+	// A token from av auth login takes precedence over the gh CLI
+	require.NoError(t, auth.WriteStore("github.com", "ghp_fromstore"))
+	token, err = auth.Resolve(nil, "github.com")
+	require.NoError(t, err)
+	assert.Equal(t, "ghp_fromstore", token.Value)
+	assert.Equal(t, auth.SourceStore, token.Source)
+
+	// The environment takes precedence over everything else
+	t.Setenv("GITHUB_TOKEN", "ghp_fromenv")
+	token, err = auth.Resolve(nil, "github.com")
+	require.NoError(t, err)
+	assert.Equal(t, "ghp_fromenv", token.Value)
+	assert.Equal(t, auth.SourceEnv, token.Source)
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"emperror.dev/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// ghCliToken returns the token that the gh CLI uses for the given host.
+// Older versions of gh store the token in plain text in hosts.yml whereas
+// newer versions store it in the system keyring (in which case we ask gh for
+// the token).
+func ghCliToken(host string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(ghConfigDir(), "hosts.yml"))
+	if err != nil && !os.IsNotExist(err) {
+		return "", errors.WrapIf(err, "failed to read gh hosts.yml")
+	}
+	if err == nil {
+		token, err := parseGhHosts(data, host)
+		if err != nil {
+			return "", err
+		}
+		if token != "" {
+			return token, nil
+		}
+	}
+
+	if _, err := exec.LookPath("gh"); err != nil {
+		return "", nil
+	}
+	out, err := exec.Command("gh", "auth", "token", "--hostname", host).Output()
+	if err != nil {
+		return "", errors.Wrap(err, "gh auth token")
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func ghConfigDir() string {
+	if dir := os.Getenv("GH_CONFIG_DIR"); dir != "" {
+		return dir
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "gh")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "gh")
+}
+
+// parseGhHosts returns the OAuth token for the given host from the contents of
+// the gh CLI hosts.yml file.
+func parseGhHosts(data []byte, host string) (string, error) {
+	var hosts map[string]struct {
+		OAuthToken string `yaml:"oauth_token"`
+	}
+	if err := yaml.Unmarshal(data, &hosts); err != nil {
+		return "", errors.WrapIf(err, "failed to parse gh hosts.yml")
+	}
+	return hosts[host].OAuthToken, nil
+}
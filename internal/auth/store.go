@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+
+	"emperror.dev/errors"
+)
+
+// The av credential store is a JSON file that maps GitHub hosts to tokens.
+// Tokens are encrypted with AES-GCM using a randomly generated key that is
+// stored in a separate file (readable only by the current user). This doesn't
+// protect the tokens from anyone that can read both files, but it does avoid
+// storing tokens in plain text (e.g., if the credentials file is accidentally
+// included in a backup or dotfiles repository).
+
+const (
+	storeFileName    = "credentials.json"
+	storeKeyFileName = "credentials.key"
+)
+
+type storeFile struct {
+	// Map of host to the base64-encoded encrypted token (prefixed with the
+	// nonce).
+	Tokens map[string]string `json:"tokens"`
+}
+
+// StoreDir returns the directory of the av credential store.
+func StoreDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "av")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "av")
+}
+
+// ReadStore returns the token for the given host from the av credential store
+// (or an empty string if there is no token for the host).
+func ReadStore(host string) (string, error) {
+	store, err := readStoreFile()
+	if err != nil {
+		return "", err
+	}
+	encrypted, ok := store.Tokens[host]
+	if !ok {
+		return "", nil
+	}
+	gcm, err := storeCipher(false)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", errors.Errorf("malformed token for %s in av credential store", host)
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	token, err := gcm.Open(nil, nonce, ciphertext, []byte(host))
+	if err != nil {
+		return "", errors.WrapIff(err, "failed to decrypt token for %s", host)
+	}
+	return string(token), nil
+}
+
+// WriteStore writes the token for the given host to the av credential store.
+func WriteStore(host string, token string) error {
+	store, err := readStoreFile()
+	if err != nil {
+		return err
+	}
+	gcm, err := storeCipher(true)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return errors.Wrap(err, "failed to generate nonce")
+	}
+	data := gcm.Seal(nonce, nonce, []byte(token), []byte(host))
+	store.Tokens[host] = base64.StdEncoding.EncodeToString(data)
+	return writeStoreFile(store)
+}
+
+// DeleteStore removes the token for the given host from the av credential
+// store. It returns true if a token was removed.
+func DeleteStore(host string) (bool, error) {
+	store, err := readStoreFile()
+	if err != nil {
+		return false, err
+	}
+	if _, ok := store.Tokens[host]; !ok {
+		return false, nil
+	}
+	delete(store.Tokens, host)
+	return true, writeStoreFile(store)
+}
+
+func readStoreFile() (*storeFile, error) {
+	store := &storeFile{Tokens: make(map[string]string)}
+	data, err := os.ReadFile(filepath.Join(StoreDir(), storeFileName))
+	if os.IsNotExist(err) {
+		return store, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to read av credential store")
+	}
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, errors.Wrap(err, "failed to parse av credential store")
+	}
+	if store.Tokens == nil {
+		store.Tokens = make(map[string]string)
+	}
+	return store, nil
+}
+
+func writeStoreFile(store *storeFile) error {
+	data, err := json.MarshalIndent(store, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal av credential store")
+	}
+	if err := os.MkdirAll(StoreDir(), 0o700); err != nil {
+		return errors.Wrap(err, "failed to create av config directory")
+	}
+	if err := os.WriteFile(filepath.Join(StoreDir(), storeFileName), data, 0o600); err != nil {
+		return errors.Wrap(err, "failed to write av credential store")
+	}
+	return nil
+}
+
+// storeCipher returns the cipher used to encrypt tokens in the credential
+// store. If create is true, a new key is generated if one doesn't exist yet.
+func storeCipher(create bool) (cipher.AEAD, error) {
+	keyFile := filepath.Join(StoreDir(), storeKeyFileName)
+	key, err := os.ReadFile(keyFile)
+	if os.IsNotExist(err) && create {
+		key = make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			return nil, errors.Wrap(err, "failed to generate credential store key")
+		}
+		if err := os.MkdirAll(StoreDir(), 0o700); err != nil {
+			return nil, errors.Wrap(err, "failed to create av config directory")
+		}
+		if err := os.WriteFile(keyFile, key, 0o600); err != nil {
+			return nil, errors.Wrap(err, "failed to write credential store key")
+		}
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to read credential store key")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid credential store key")
+	}
+	return cipher.NewGCM(block)
+}
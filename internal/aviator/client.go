@@ -0,0 +1,112 @@
+package aviator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/utils/logutils"
+	"github.com/sirupsen/logrus"
+)
+
+// Client is a client for the Aviator (MergeQueue) REST API.
+type Client struct {
+	httpClient *http.Client
+	baseUrl    string
+	token      string
+}
+
+func NewClient(baseUrl string, token string) (*Client, error) {
+	if token == "" {
+		return nil, errors.New("no Aviator API token provided (set aviator.apiToken in your configuration file or the AV_AVIATOR_API_TOKEN environment variable)")
+	}
+	return &Client{
+		httpClient: http.DefaultClient,
+		baseUrl:    strings.TrimSuffix(baseUrl, "/"),
+		token:      token,
+	}, nil
+}
+
+type QueuePullRequestInput struct {
+	// The owner (organization) of the GitHub repository.
+	Owner string
+	// The name of the GitHub repository.
+	Repo string
+	// The number of the pull request to queue.
+	Number int64
+}
+
+// QueuePullRequest adds the pull request to the Aviator MergeQueue.
+func (c *Client) QueuePullRequest(ctx context.Context, input QueuePullRequestInput) error {
+	type repository struct {
+		Name string `json:"name"`
+		Org  string `json:"org"`
+	}
+	type pullRequest struct {
+		Number     int64      `json:"number"`
+		Repository repository `json:"repository"`
+	}
+	req := struct {
+		Action      string      `json:"action"`
+		PullRequest pullRequest `json:"pull_request"` //nolint:tagliatelle
+	}{
+		Action: "queue",
+		PullRequest: pullRequest{
+			Number:     input.Number,
+			Repository: repository{Name: input.Repo, Org: input.Owner},
+		},
+	}
+	if err := c.post(ctx, "/api/v1/pull_request", req); err != nil {
+		return errors.Wrap(err, "failed to queue pull request")
+	}
+	return nil
+}
+
+func (c *Client) post(ctx context.Context, endpoint string, body interface{}) error {
+	startTime := time.Now()
+	url := c.baseUrl + endpoint
+	log := logrus.WithFields(logrus.Fields{
+		"url":  url,
+		"body": logutils.Format("%#+v", body),
+	})
+	bodyJson, err := json.Marshal(body)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal request body to JSON")
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(bodyJson))
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	log.Debug("executing Aviator API request...")
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to make API request")
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to read response body")
+	}
+	log.WithField("elapsed", time.Since(startTime)).Debug("Aviator API request completed")
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		log.WithFields(logrus.Fields{
+			"status": res.StatusCode,
+			"body":   string(resBody),
+		}).Debug("Aviator API request failed")
+		return errors.Errorf("Aviator API request for %s failed: %s", endpoint, res.Status)
+	}
+	return nil
+}
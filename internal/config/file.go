@@ -0,0 +1,259 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// Scope identifies which config file a setting is read from or written to.
+type Scope string
+
+const (
+	// ScopeGlobal is the user's config file (e.g., ~/.config/av/config.yaml).
+	ScopeGlobal Scope = "global"
+	// ScopeProject is the config file that is committed at the root of the
+	// repository (.av.yaml or .aviator/av.yaml) and is shared by everyone
+	// working in the repository. It takes precedence over the global config.
+	// Only some keys can be set in the project config (see
+	// Key.ProjectAllowed).
+	ScopeProject Scope = "project"
+	// ScopeRepo is the config file of the local repository
+	// (.git/av/config.yaml), which takes precedence over all other config
+	// files.
+	ScopeRepo Scope = "repo"
+)
+
+func (s Scope) precedence() int {
+	switch s {
+	case ScopeGlobal:
+		return 0
+	case ScopeProject:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// File is a config file. The file doesn't necessarily exist (e.g., if it's
+// about to be created by `av config set`).
+type File struct {
+	Scope Scope
+	Path  string
+	v     *viper.Viper
+}
+
+// Exists returns true if the file exists.
+func (f *File) Exists() bool {
+	_, err := os.Stat(f.Path)
+	return err == nil
+}
+
+// Get returns the value of the key in the file (or false if the key isn't set
+// in the file).
+func (f *File) Get(key Key) (interface{}, bool) {
+	if f.v == nil || !f.v.IsSet(key.Name) {
+		return nil, false
+	}
+	return f.v.Get(key.Name), true
+}
+
+// Keys returns the (lower-case) names of all keys that are set in the file.
+func (f *File) Keys() []string {
+	if f.v == nil {
+		return nil
+	}
+	return f.v.AllKeys()
+}
+
+// UnknownKeys returns the keys that are set in the file but aren't known
+// config keys (usually because of a typo).
+func (f *File) UnknownKeys() []string {
+	var unknown []string
+	for _, name := range f.Keys() {
+		if _, err := LookupKey(name); err != nil {
+			unknown = append(unknown, name)
+		}
+	}
+	return unknown
+}
+
+// IgnoredKeys returns the keys that are set in the file but are ignored
+// because they can't be set in the scope of the file (see
+// Key.ProjectAllowed).
+func (f *File) IgnoredKeys() []string {
+	var ignored []string
+	for _, name := range f.Keys() {
+		if _, err := LookupKey(name); err == nil && !f.allows(name) {
+			ignored = append(ignored, name)
+		}
+	}
+	return ignored
+}
+
+func (f *File) allows(name string) bool {
+	return f.Scope != ScopeProject || projectAllowed(name)
+}
+
+// settings returns the settings of the file that are applied to the
+// configuration (i.e., without the ignored keys).
+func (f *File) settings() *viper.Viper {
+	if f.Scope != ScopeProject {
+		return f.v
+	}
+	v := viper.New()
+	for _, name := range f.Keys() {
+		if f.allows(name) {
+			v.Set(name, f.v.Get(name))
+		}
+	}
+	return v
+}
+
+// Reload reads the file again (e.g., after it was edited by the user).
+func (f *File) Reload() error {
+	v := viper.New()
+	v.SetConfigFile(f.Path)
+	if err := v.ReadInConfig(); err != nil {
+		return errors.Wrapf(err, "failed to read config file %s", f.Path)
+	}
+	f.v = v
+	return nil
+}
+
+// Set sets the key to the value in the file and writes the file (in the
+// format that is indicated by its extension). The file is created if it
+// doesn't exist yet.
+func (f *File) Set(key Key, value interface{}) error {
+	return f.edit(func(settings map[string]interface{}) error {
+		return setPath(settings, strings.Split(key.Name, "."), value)
+	})
+}
+
+// Unset removes the key from the file. It returns false if the key wasn't set
+// in the file.
+func (f *File) Unset(key Key) (bool, error) {
+	if _, ok := f.Get(key); !ok {
+		return false, nil
+	}
+	return true, f.edit(func(settings map[string]interface{}) error {
+		unsetPath(settings, strings.Split(key.Name, "."))
+		return nil
+	})
+}
+
+type codec struct {
+	unmarshal func([]byte, interface{}) error
+	marshal   func(interface{}) ([]byte, error)
+}
+
+// codecs are the formats that av can write. Viper can read more formats than
+// these, but those files have to be edited by hand.
+var codecs = map[string]codec{
+	"json": {json.Unmarshal, func(v interface{}) ([]byte, error) {
+		data, err := json.MarshalIndent(v, "", "  ")
+		return append(data, '\n'), err
+	}},
+	"yaml": {yaml.Unmarshal, marshalYAML},
+	"yml":  {yaml.Unmarshal, marshalYAML},
+	"toml": {toml.Unmarshal, toml.Marshal},
+}
+
+func marshalYAML(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), enc.Close()
+}
+
+func (f *File) edit(fn func(settings map[string]interface{}) error) error {
+	ext := strings.TrimPrefix(filepath.Ext(f.Path), ".")
+	c, ok := codecs[ext]
+	if !ok {
+		return errors.Errorf(
+			"cannot modify %s: %q config files are not supported (use av config edit instead)",
+			f.Path, ext,
+		)
+	}
+
+	settings := make(map[string]interface{})
+	data, err := os.ReadFile(f.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WrapIf(err, "failed to read config file")
+	}
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := c.unmarshal(data, &settings); err != nil {
+			return errors.Wrapf(err, "failed to parse config file %s", f.Path)
+		}
+	}
+	if err := fn(settings); err != nil {
+		return err
+	}
+	data, err = c.marshal(settings)
+	if err != nil {
+		return errors.WrapIf(err, "failed to encode config file")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+		return errors.WrapIf(err, "failed to create config directory")
+	}
+	// The config may contain credentials, so new files are only readable by
+	// the user (existing files keep their permissions).
+	if err := os.WriteFile(f.Path, data, 0600); err != nil {
+		return errors.WrapIf(err, "failed to write config file")
+	}
+	return f.Reload()
+}
+
+// setPath sets the value in the nested settings map. Keys are matched
+// case-insensitively (like viper does) so that the existing spelling of the
+// keys in the file is kept.
+func setPath(settings map[string]interface{}, path []string, value interface{}) error {
+	name, existing := lookupPath(settings, path[0])
+	if len(path) == 1 {
+		settings[name] = value
+		return nil
+	}
+	child, ok := existing.(map[string]interface{})
+	if !ok {
+		if existing != nil {
+			return errors.Errorf("cannot set %s: %q is not a section", strings.Join(path, "."), name)
+		}
+		child = make(map[string]interface{})
+		settings[name] = child
+	}
+	return setPath(child, path[1:], value)
+}
+
+func unsetPath(settings map[string]interface{}, path []string) {
+	name, existing := lookupPath(settings, path[0])
+	if len(path) == 1 {
+		delete(settings, name)
+		return
+	}
+	if child, ok := existing.(map[string]interface{}); ok {
+		unsetPath(child, path[1:])
+		if len(child) == 0 {
+			delete(settings, name)
+		}
+	}
+}
+
+func lookupPath(settings map[string]interface{}, name string) (string, interface{}) {
+	for key, value := range settings {
+		if strings.EqualFold(key, name) {
+			return key, value
+		}
+	}
+	return name, nil
+}
@@ -0,0 +1,250 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"emperror.dev/errors"
+)
+
+// Key is a configuration key (e.g., "pullRequest.draft"). Keys are derived
+// from the fields of Av, so every field is addressable by its key.
+type Key struct {
+	// The name of the key as it's written in config files. Like viper, av
+	// matches key names case-insensitively.
+	Name string
+	// The type of the value (e.g., bool or []string).
+	Type reflect.Type
+	// The index of the field within Av (see reflect.Value.FieldByIndex).
+	index []int
+	// If the key is an entry of a map-valued field (e.g., "hooks.pre-push"),
+	// the key of the entry within the map.
+	entry string
+}
+
+// Keys returns all configuration keys in the order that they're declared in
+// Av. Map-valued fields (such as Hooks) are returned as a single key; see
+// Key.Entries.
+func Keys() []Key {
+	return appendKeys(nil, "", reflect.TypeOf(Av), nil)
+}
+
+func appendKeys(keys []Key, prefix string, t reflect.Type, index []int) []Key {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := prefix + keyName(field.Name)
+		fieldIndex := append(append([]int(nil), index...), i)
+		if field.Type.Kind() == reflect.Struct {
+			keys = appendKeys(keys, name+".", field.Type, fieldIndex)
+			continue
+		}
+		keys = append(keys, Key{Name: name, Type: field.Type, index: fieldIndex})
+	}
+	return keys
+}
+
+// keyName converts a Go field name into the name of the key (e.g.,
+// "PullRequest" -> "pullRequest" and "APIToken" -> "apiToken").
+func keyName(field string) string {
+	runes := []rune(field)
+	upper := 0
+	for upper < len(runes) && unicode.IsUpper(runes[upper]) {
+		upper++
+	}
+	// Keep the last upper-case letter of an acronym since it starts the next
+	// word.
+	if upper > 1 && upper < len(runes) {
+		upper--
+	}
+	for i := 0; i < upper; i++ {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
+
+// LookupKey returns the key with the given (case-insensitive) name. Entries of
+// map-valued keys are addressed as "<key>.<entry>" (e.g., "hooks.pre-push").
+func LookupKey(name string) (Key, error) {
+	for _, key := range Keys() {
+		if strings.EqualFold(key.Name, name) {
+			return key, nil
+		}
+		if key.Type.Kind() != reflect.Map || len(name) <= len(key.Name)+1 {
+			continue
+		}
+		prefix, entry := name[:len(key.Name)], name[len(key.Name)+1:]
+		if !strings.EqualFold(prefix, key.Name) || name[len(key.Name)] != '.' {
+			continue
+		}
+		if strings.Contains(entry, ".") {
+			return Key{}, errors.Errorf("unknown config key %q", name)
+		}
+		// Viper lower-cases all keys when reading config files.
+		entry = strings.ToLower(entry)
+		return Key{
+			Name:  key.Name + "." + entry,
+			Type:  key.Type.Elem(),
+			index: key.index,
+			entry: entry,
+		}, nil
+	}
+	return Key{}, errors.Errorf("unknown config key %q", name)
+}
+
+// IsMap returns true if the key is a map-valued key (whose entries can be set
+// individually).
+func (k Key) IsMap() bool {
+	return k.Type.Kind() == reflect.Map
+}
+
+// EnvVar returns the name of the environment variable that overrides the value
+// of the key (e.g., AV_PULLREQUEST_DRAFT for pullRequest.draft).
+func (k Key) EnvVar() string {
+	return "AV_" + strings.ToUpper(strings.ReplaceAll(k.Name, ".", "_"))
+}
+
+// Secret returns true if the value of the key is a credential that shouldn't
+// be displayed unless it's explicitly asked for.
+func (k Key) Secret() bool {
+	return strings.HasSuffix(strings.ToLower(k.Name), "token")
+}
+
+// projectKeys are the keys (and sections of keys) that can be set in the
+// project config. The project config is committed to the repository, so it
+// must not be able to run commands (hooks), redirect credentials to another
+// host (baseUrl), contain credentials, or choose the remote.
+var projectKeys = []string{"pullRequest", "branch.nameTemplate", "policy"}
+
+// ProjectAllowed returns true if the key can be set in the project config (see
+// ScopeProject).
+func (k Key) ProjectAllowed() bool {
+	return projectAllowed(k.Name)
+}
+
+func projectAllowed(name string) bool {
+	name = strings.ToLower(name)
+	for _, allowed := range projectKeys {
+		allowed = strings.ToLower(allowed)
+		if name == allowed || strings.HasPrefix(name, allowed+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Entries returns the keys of the entries of a map-valued key that are set in
+// the effective configuration (sorted by name).
+func (k Key) Entries() []Key {
+	if !k.IsMap() || k.entry != "" {
+		return nil
+	}
+	m := reflect.ValueOf(&Av).Elem().FieldByIndex(k.index)
+	var names []string
+	for _, name := range m.MapKeys() {
+		names = append(names, name.String())
+	}
+	sort.Strings(names)
+	entries := make([]Key, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, Key{
+			Name:  k.Name + "." + name,
+			Type:  k.Type.Elem(),
+			index: k.index,
+			entry: name,
+		})
+	}
+	return entries
+}
+
+// Value returns the effective value of the key (or nil if it's unset).
+func (k Key) Value() interface{} {
+	return k.valueIn(reflect.ValueOf(&Av).Elem())
+}
+
+// valueIn returns the value of the key in config (which must be of the same
+// type as Av).
+func (k Key) valueIn(config reflect.Value) interface{} {
+	v := config.FieldByIndex(k.index)
+	if k.entry != "" {
+		v = v.MapIndex(reflect.ValueOf(k.entry))
+		if !v.IsValid() {
+			return nil
+		}
+	}
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Map || v.Kind() == reflect.Slice) && v.IsNil() {
+		return nil
+	}
+	return v.Interface()
+}
+
+// Parse converts the command line arguments into a value of the key. List
+// values take one argument per element; all other values take exactly one
+// argument.
+func (k Key) Parse(args []string) (interface{}, error) {
+	t := k.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.String {
+		return args, nil
+	}
+	if t.Kind() == reflect.Map {
+		return nil, errors.Errorf(
+			"%s can't be set as a whole: set its entries instead (e.g., %s.<name>)",
+			k.Name, k.Name,
+		)
+	}
+	if len(args) != 1 {
+		return nil, errors.Errorf("%s takes a single value (got %d)", k.Name, len(args))
+	}
+	arg := args[0]
+	switch t.Kind() {
+	case reflect.String:
+		return arg, nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(arg)
+		if err != nil {
+			return nil, errors.Errorf("invalid value %q for %s: expected true or false", arg, k.Name)
+		}
+		return b, nil
+	case reflect.Int, reflect.Int64:
+		i, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return nil, errors.Errorf("invalid value %q for %s: expected an integer", arg, k.Name)
+		}
+		return i, nil
+	default:
+		return nil, errors.Errorf("%s (of type %s) can't be set from the command line", k.Name, k.Type)
+	}
+}
+
+// FormatValue formats a config value for display. Lists and maps are
+// formatted as JSON; unset values are formatted as the empty string.
+func FormatValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		data, err := json.Marshal(v.Interface())
+		if err == nil {
+			return string(data)
+		}
+	}
+	return fmt.Sprint(v.Interface())
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+
+	"emperror.dev/errors"
+)
+
+// Policy is the policy of a project, which is set in the project config (see
+// ScopeProject).
+type Policy struct {
+	// The keys of the settings that are pinned to their value in the project
+	// config (or to their default value if the project config doesn't set
+	// them). Users can still override pinned settings in their repository
+	// config or the environment, but they're warned about it.
+	Pinned []string
+}
+
+// PolicyViolation is a pinned setting whose effective value differs from the
+// value that it's pinned to.
+type PolicyViolation struct {
+	Key Key
+	// The value that the setting is pinned to.
+	Pinned interface{}
+	// The path of the project config that pins the setting.
+	PinnedBy string
+	// Where the overriding value comes from (see Source).
+	Source string
+}
+
+var policyViolations []PolicyViolation
+
+// PolicyViolations returns the pinned settings that are overridden by the
+// user.
+func PolicyViolations() []PolicyViolation {
+	return policyViolations
+}
+
+// PinnedBy returns the path of the project config if it pins the key.
+func PinnedBy(key Key) (string, bool) {
+	project := projectFile()
+	if project == nil {
+		return "", false
+	}
+	for _, name := range Av.Policy.Pinned {
+		if strings.EqualFold(name, key.Name) || strings.HasPrefix(strings.ToLower(key.Name), strings.ToLower(name)+".") {
+			return project.Path, true
+		}
+	}
+	return "", false
+}
+
+func projectFile() *File {
+	for _, file := range files {
+		if file.Scope == ScopeProject {
+			return file
+		}
+	}
+	return nil
+}
+
+// loadPolicy reads the policy from the project config and checks whether the
+// effective configuration violates it. defaults are the config values before
+// any config file was loaded.
+func loadPolicy(defaults interface{}) error {
+	policyViolations = nil
+	Av.Policy = Policy{}
+	// Only the project config can set the policy (everything else could just
+	// as well override the pinned settings directly).
+	project := projectFile()
+	if project == nil {
+		return nil
+	}
+	Av.Policy.Pinned = project.v.GetStringSlice("policy.pinned")
+	if len(Av.Policy.Pinned) == 0 {
+		return nil
+	}
+
+	// The values as if the project config was the only config file.
+	pinned := reflect.New(reflect.TypeOf(Av))
+	pinned.Elem().Set(reflect.ValueOf(defaults))
+	if err := project.settings().Unmarshal(pinned.Interface()); err != nil {
+		return errors.Wrapf(err, "failed to read av config %s", project.Path)
+	}
+
+	for _, name := range Av.Policy.Pinned {
+		key, err := LookupKey(name)
+		if err != nil {
+			return errors.WithMessagef(err, "invalid policy.pinned in %s", project.Path)
+		}
+		source, ok := OverriddenBy(project, key)
+		if !ok {
+			continue
+		}
+		pinnedValue := key.valueIn(pinned.Elem())
+		if reflect.DeepEqual(key.Value(), pinnedValue) {
+			continue
+		}
+		policyViolations = append(policyViolations, PolicyViolation{
+			Key:      key,
+			Pinned:   pinnedValue,
+			PinnedBy: project.Path,
+			Source:   source,
+		})
+	}
+	return nil
+}
@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"emperror.dev/errors"
@@ -18,6 +20,11 @@ import (
 type Client struct {
 	httpClient *http.Client
 	gh         *githubv4.Client
+
+	mu sync.Mutex
+	// The OAuth scopes of the token (as reported by GitHub in the response
+	// headers of the most recent API request).
+	scopes []string
 }
 
 const githubApiBaseUrl = "https://api.github.com"
@@ -30,7 +37,36 @@ func NewClient(token string) (*Client, error) {
 		&oauth2.Token{AccessToken: token},
 	)
 	httpClient := oauth2.NewClient(context.Background(), src)
-	return &Client{httpClient, githubv4.NewClient(httpClient)}, nil
+	c := &Client{httpClient: httpClient}
+	httpClient.Transport = &scopesTransport{httpClient.Transport, c}
+	c.gh = githubv4.NewClient(httpClient)
+	return c, nil
+}
+
+// scopesTransport is an http.RoundTripper that records the OAuth scopes that
+// GitHub reports for the token in each response.
+type scopesTransport struct {
+	base   http.RoundTripper
+	client *Client
+}
+
+func (t *scopesTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if header, ok := res.Header["X-Oauth-Scopes"]; ok {
+		var scopes []string
+		for _, scope := range strings.Split(strings.Join(header, ","), ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				scopes = append(scopes, scope)
+			}
+		}
+		t.client.mu.Lock()
+		t.client.scopes = scopes
+		t.client.mu.Unlock()
+	}
+	return res, nil
 }
 
 func (c *Client) query(ctx context.Context, query any, variables map[string]any) (reterr error) {
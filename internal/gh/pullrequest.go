@@ -17,9 +17,14 @@ type PullRequest struct {
 	}
 	HeadRefName         string
 	HeadRefOID          string
+	HeadRepositoryOwner struct {
+		Login string
+	}
 	BaseRefName         string
+	IsCrossRepository   bool
 	IsDraft             bool
 	Mergeable           githubv4.MergeableState
+	MergeStateStatus    MergeStateStatus
 	Merged              bool
 	Permalink           string
 	State               githubv4.PullRequestState
@@ -39,6 +44,38 @@ type PullRequest struct {
 			} `graphql:"... on ClosedEvent"`
 		}
 	} `graphql:"timelineItems(last: 10, itemTypes: CLOSED_EVENT)"`
+	// Non-nil if auto-merge is enabled for the pull request.
+	AutoMergeRequest *struct {
+		EnabledAt githubv4.DateTime
+	}
+}
+
+// MergeStateStatus is the detailed status of whether or not a pull request can
+// be merged (the version of githubv4 that we use doesn't include this enum).
+type MergeStateStatus string
+
+const (
+	MergeStateStatusBehind   MergeStateStatus = "BEHIND"
+	MergeStateStatusBlocked  MergeStateStatus = "BLOCKED"
+	MergeStateStatusClean    MergeStateStatus = "CLEAN"
+	MergeStateStatusDirty    MergeStateStatus = "DIRTY"
+	MergeStateStatusHasHooks MergeStateStatus = "HAS_HOOKS"
+	MergeStateStatusUnknown  MergeStateStatus = "UNKNOWN"
+	MergeStateStatusUnstable MergeStateStatus = "UNSTABLE"
+)
+
+// CanMergeNow returns true if the pull request can be merged right away (in
+// which case GitHub refuses to enable auto-merge for it).
+func (p *PullRequest) CanMergeNow() bool {
+	if p.Mergeable != githubv4.MergeableStateMergeable {
+		return false
+	}
+	switch p.MergeStateStatus {
+	case MergeStateStatusClean, MergeStateStatusHasHooks, MergeStateStatusUnstable:
+		return true
+	default:
+		return false
+	}
 }
 
 func (p *PullRequest) HeadBranchName() string {
@@ -87,16 +124,40 @@ func (c *Client) PullRequest(ctx context.Context, id string) (*PullRequest, erro
 	return &query.Node.PullRequest, nil
 }
 
+// GetPullRequest fetches the pull request with the given number.
+func (c *Client) GetPullRequest(ctx context.Context, opts PullRequestOpts) (*PullRequest, error) {
+	var query struct {
+		Repository struct {
+			PullRequest PullRequest `graphql:"pullRequest(number: $number)"`
+		} `graphql:"repository(owner: $owner, name: $repo)"`
+	}
+	if err := c.query(ctx, &query, map[string]interface{}{
+		"owner":  githubv4.String(opts.Owner),
+		"repo":   githubv4.String(opts.Repo),
+		"number": githubv4.Int(opts.Number),
+	}); err != nil {
+		return nil, errors.Wrapf(err, "failed to query pull request #%d", opts.Number)
+	}
+	if query.Repository.PullRequest.ID == "" {
+		return nil, errors.Errorf("pull request #%d not found", opts.Number)
+	}
+	return &query.Repository.PullRequest, nil
+}
+
 type GetPullRequestsInput struct {
 	// REQUIRED
 	Owner string
 	Repo  string
 	// OPTIONAL
 	HeadRefName string
-	BaseRefName string
-	States      []githubv4.PullRequestState
-	First       int64
-	After       string
+	// If set, only return pull requests whose head branch belongs to a
+	// repository with the given owner (e.g., to distinguish between branches
+	// of the same name in different forks).
+	HeadRepositoryOwner string
+	BaseRefName         string
+	States              []githubv4.PullRequestState
+	First               int64
+	After               string
 }
 
 type GetPullRequestsPage struct {
@@ -104,36 +165,70 @@ type GetPullRequestsPage struct {
 	PullRequests []PullRequest
 }
 
+// GetPullRequests returns a page of the pull requests that match the input.
+// If HeadRepositoryOwner is set, the pull requests are filtered after they're
+// fetched (GitHub can't filter by the owner of the head repository), so this
+// keeps fetching pages until it has found at least First pull requests or
+// there are no more pull requests. The returned page may therefore contain
+// more than First pull requests.
 func (c *Client) GetPullRequests(ctx context.Context, input GetPullRequestsInput) (*GetPullRequestsPage, error) {
 	if input.First == 0 {
 		input.First = 50
 	}
-	var query struct {
-		Repository struct {
-			PullRequests struct {
-				Nodes    []PullRequest
-				PageInfo PageInfo
-			} `graphql:"pullRequests(states: $states, headRefName: $headRefName, baseRefName: $baseRefName, first: $first, after: $after)"`
-		} `graphql:"repository(owner: $owner, name: $repo)"`
-	}
-	if err := c.query(ctx, &query, map[string]interface{}{
-		"owner":       githubv4.String(input.Owner),
-		"repo":        githubv4.String(input.Repo),
-		"headRefName": nullable(githubv4.String(input.HeadRefName)),
-		"baseRefName": nullable(githubv4.String(input.BaseRefName)),
-		"states":      &input.States,
-		"first":       githubv4.Int(input.First),
-		"after":       nullable(githubv4.String(input.After)),
-	}); err != nil {
-		return nil, errors.Wrap(err, "failed to query pull requests")
+	page := &GetPullRequestsPage{}
+	after := input.After
+	for {
+		var query struct {
+			Repository struct {
+				PullRequests struct {
+					Nodes    []PullRequest
+					PageInfo PageInfo
+				} `graphql:"pullRequests(states: $states, headRefName: $headRefName, baseRefName: $baseRefName, first: $first, after: $after)"`
+			} `graphql:"repository(owner: $owner, name: $repo)"`
+		}
+		if err := c.query(ctx, &query, map[string]interface{}{
+			"owner":       githubv4.String(input.Owner),
+			"repo":        githubv4.String(input.Repo),
+			"headRefName": nullable(githubv4.String(input.HeadRefName)),
+			"baseRefName": nullable(githubv4.String(input.BaseRefName)),
+			"states":      &input.States,
+			"first":       githubv4.Int(input.First),
+			"after":       nullable(githubv4.String(after)),
+		}); err != nil {
+			return nil, errors.Wrap(err, "failed to query pull requests")
+		}
+		page.PageInfo = query.Repository.PullRequests.PageInfo
+		for _, pull := range query.Repository.PullRequests.Nodes {
+			if input.HeadRepositoryOwner != "" &&
+				!strings.EqualFold(pull.HeadRepositoryOwner.Login, input.HeadRepositoryOwner) {
+				continue
+			}
+			page.PullRequests = append(page.PullRequests, pull)
+		}
+		if input.HeadRepositoryOwner == "" || int64(len(page.PullRequests)) >= input.First || !page.HasNextPage {
+			return page, nil
+		}
+		after = page.EndCursor
 	}
-	return &GetPullRequestsPage{
-		PageInfo:     query.Repository.PullRequests.PageInfo,
-		PullRequests: query.Repository.PullRequests.Nodes,
-	}, nil
 }
 
-func (c *Client) CreatePullRequest(ctx context.Context, input githubv4.CreatePullRequestInput) (*PullRequest, error) {
+// CreatePullRequestInput is the input to the createPullRequest mutation.
+// This mirrors githubv4.CreatePullRequestInput but also includes the
+// headRepositoryId field (which is required to open a pull request from a
+// fork and isn't available in the version of githubv4 that we use).
+// The type name must match the GraphQL input type name.
+type CreatePullRequestInput struct {
+	RepositoryID        githubv4.ID       `json:"repositoryId"`
+	BaseRefName         githubv4.String   `json:"baseRefName"`
+	HeadRefName         githubv4.String   `json:"headRefName"`
+	HeadRepositoryID    *githubv4.ID      `json:"headRepositoryId,omitempty"`
+	Title               githubv4.String   `json:"title"`
+	Body                *githubv4.String  `json:"body,omitempty"`
+	MaintainerCanModify *githubv4.Boolean `json:"maintainerCanModify,omitempty"`
+	Draft               *githubv4.Boolean `json:"draft,omitempty"`
+}
+
+func (c *Client) CreatePullRequest(ctx context.Context, input CreatePullRequestInput) (*PullRequest, error) {
 	var mutation struct {
 		CreatePullRequest struct {
 			PullRequest PullRequest
@@ -181,6 +276,93 @@ func (c *Client) MarkPullRequestReadyForReview(ctx context.Context, id string) (
 	return &mutation.MarkPullRequestReadyForReview.PullRequest, nil
 }
 
+func (c *Client) ReopenPullRequest(ctx context.Context, id string) (*PullRequest, error) {
+	var mutation struct {
+		ReopenPullRequest struct {
+			PullRequest PullRequest
+		} `graphql:"reopenPullRequest(input: $input)"`
+	}
+	if err := c.mutate(ctx, &mutation, githubv4.ReopenPullRequestInput{PullRequestID: id}, nil); err != nil {
+		return nil, errors.Wrap(err, "failed to reopen pull request: github error")
+	}
+	return &mutation.ReopenPullRequest.PullRequest, nil
+}
+
+type PullRequestReviewers struct {
+	// The (GraphQL) IDs of the users that were requested to review the pull
+	// request or that have reviewed the pull request.
+	UserIDs []githubv4.ID
+	// The (GraphQL) IDs of the teams that were requested to review the pull
+	// request.
+	TeamIDs []githubv4.ID
+}
+
+// PullRequestReviewers returns the reviewers of a pull request (both the
+// requested reviewers and the users that have already submitted a review).
+func (c *Client) PullRequestReviewers(ctx context.Context, id string) (*PullRequestReviewers, error) {
+	var query struct {
+		Node struct {
+			PullRequest struct {
+				ReviewRequests struct {
+					Nodes []struct {
+						RequestedReviewer struct {
+							User struct {
+								ID string
+							} `graphql:"... on User"`
+							Team struct {
+								ID string
+							} `graphql:"... on Team"`
+						}
+					}
+				} `graphql:"reviewRequests(first: 100)"`
+				LatestReviews struct {
+					Nodes []struct {
+						Author struct {
+							User struct {
+								ID string
+							} `graphql:"... on User"`
+						}
+					}
+				} `graphql:"latestReviews(first: 100)"`
+			} `graphql:"... on PullRequest"`
+		} `graphql:"node(id: $id)"`
+	}
+	if err := c.query(ctx, &query, map[string]any{"id": githubv4.ID(id)}); err != nil {
+		return nil, errors.Wrap(err, "failed to query pull request reviewers")
+	}
+
+	reviewers := &PullRequestReviewers{}
+	seen := make(map[string]bool)
+	addUser := func(id string) {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			reviewers.UserIDs = append(reviewers.UserIDs, githubv4.ID(id))
+		}
+	}
+	for _, req := range query.Node.PullRequest.ReviewRequests.Nodes {
+		addUser(req.RequestedReviewer.User.ID)
+		if req.RequestedReviewer.Team.ID != "" {
+			reviewers.TeamIDs = append(reviewers.TeamIDs, githubv4.ID(req.RequestedReviewer.Team.ID))
+		}
+	}
+	for _, review := range query.Node.PullRequest.LatestReviews.Nodes {
+		addUser(review.Author.User.ID)
+	}
+	return reviewers, nil
+}
+
+func (c *Client) RequestReviews(ctx context.Context, input githubv4.RequestReviewsInput) (*PullRequest, error) {
+	var mutation struct {
+		RequestReviews struct {
+			PullRequest PullRequest
+		} `graphql:"requestReviews(input: $input)"`
+	}
+	if err := c.mutate(ctx, &mutation, input, nil); err != nil {
+		return nil, errors.Wrap(err, "failed to request reviews: github error")
+	}
+	return &mutation.RequestReviews.PullRequest, nil
+}
+
 type AddIssueLabelInput struct {
 	// The owner of the GitHub repository.
 	Owner string
@@ -262,3 +444,82 @@ func (c *Client) RepoPullRequests(ctx context.Context, opts RepoPullRequestOpts)
 		PullRequests: query.Repository.PullRequests.Nodes,
 	}, nil
 }
+
+type SearchPullRequestsInput struct {
+	// The search query (e.g., "repo:aviator-co/av is:open author:@me"). The
+	// is:pr qualifier is added automatically.
+	Query string
+	First int64
+	After string
+}
+
+// SearchPullRequests returns the pull requests that match the search query.
+// Unlike listing the pull requests of a repository, the search is done by
+// GitHub, so only the matching pull requests have to be fetched.
+func (c *Client) SearchPullRequests(ctx context.Context, input SearchPullRequestsInput) (*GetPullRequestsPage, error) {
+	if input.First == 0 {
+		input.First = 50
+	}
+	var query struct {
+		Search struct {
+			Nodes []struct {
+				PullRequest PullRequest `graphql:"... on PullRequest"`
+			}
+			PageInfo PageInfo
+		} `graphql:"search(query: $query, type: ISSUE, first: $first, after: $after)"`
+	}
+	if err := c.query(ctx, &query, map[string]interface{}{
+		"query": githubv4.String("is:pr " + input.Query),
+		"first": githubv4.Int(input.First),
+		"after": nullable(githubv4.String(input.After)),
+	}); err != nil {
+		return nil, errors.Wrap(err, "failed to search pull requests")
+	}
+	page := &GetPullRequestsPage{PageInfo: query.Search.PageInfo}
+	for _, node := range query.Search.Nodes {
+		page.PullRequests = append(page.PullRequests, node.PullRequest)
+	}
+	return page, nil
+}
+
+// EnablePullRequestAutoMerge enables GitHub's auto-merge feature for the pull
+// request. The pull request will be merged by GitHub once all of the branch
+// protection requirements (e.g., required status checks and reviews) are met.
+func (c *Client) EnablePullRequestAutoMerge(ctx context.Context, input githubv4.EnablePullRequestAutoMergeInput) (*PullRequest, error) {
+	var mutation struct {
+		EnablePullRequestAutoMerge struct {
+			PullRequest PullRequest
+		} `graphql:"enablePullRequestAutoMerge(input: $input)"`
+	}
+	if err := c.mutate(ctx, &mutation, input, nil); err != nil {
+		return nil, errors.Wrap(err, "failed to enable pull request auto-merge: github error")
+	}
+	return &mutation.EnablePullRequestAutoMerge.PullRequest, nil
+}
+
+// DisablePullRequestAutoMerge disables GitHub's auto-merge feature for the
+// pull request.
+func (c *Client) DisablePullRequestAutoMerge(ctx context.Context, input githubv4.DisablePullRequestAutoMergeInput) (*PullRequest, error) {
+	var mutation struct {
+		DisablePullRequestAutoMerge struct {
+			PullRequest PullRequest
+		} `graphql:"disablePullRequestAutoMerge(input: $input)"`
+	}
+	if err := c.mutate(ctx, &mutation, input, nil); err != nil {
+		return nil, errors.Wrap(err, "failed to disable pull request auto-merge: github error")
+	}
+	return &mutation.DisablePullRequestAutoMerge.PullRequest, nil
+}
+
+// MergePullRequest merges the pull request immediately.
+func (c *Client) MergePullRequest(ctx context.Context, input githubv4.MergePullRequestInput) (*PullRequest, error) {
+	var mutation struct {
+		MergePullRequest struct {
+			PullRequest PullRequest
+		} `graphql:"mergePullRequest(input: $input)"`
+	}
+	if err := c.mutate(ctx, &mutation, input, nil); err != nil {
+		return nil, errors.Wrap(err, "failed to merge pull request: github error")
+	}
+	return &mutation.MergePullRequest.PullRequest, nil
+}
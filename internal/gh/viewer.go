@@ -0,0 +1,37 @@
+package gh
+
+import (
+	"context"
+
+	"emperror.dev/errors"
+)
+
+type Viewer struct {
+	Login string
+	Name  string
+	// The OAuth scopes that are granted to the token. This is empty for
+	// tokens that don't use OAuth scopes (e.g., fine-grained personal access
+	// tokens).
+	Scopes []string
+}
+
+// Viewer returns information about the user that is authenticated with the
+// GitHub API.
+func (c *Client) Viewer(ctx context.Context) (*Viewer, error) {
+	var query struct {
+		Viewer struct {
+			Login string
+			Name  string
+		}
+	}
+	if err := c.query(ctx, &query, nil); err != nil {
+		return nil, errors.Wrap(err, "failed to query viewer")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &Viewer{
+		Login:  query.Viewer.Login,
+		Name:   query.Viewer.Name,
+		Scopes: c.scopes,
+	}, nil
+}
@@ -0,0 +1,193 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+)
+
+// catFileProcess is a long-lived `git cat-file --batch` (or --batch-check)
+// process that is used to read objects and resolve refs without spawning a
+// new git process for every read.
+type catFileProcess struct {
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	// Set if the process is in an unknown state (e.g., because reading its
+	// output failed) and must be restarted.
+	broken bool
+}
+
+// startCatFile starts a new cat-file process. The process isn't bound to the
+// context of the repository since it outlives individual commands (it's
+// stopped by Repo.Close).
+func startCatFile(repoDir string, mode string) (*catFileProcess, error) {
+	cmd := exec.Command("git", "cat-file", mode)
+	cmd.Dir = repoDir
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Wrapf(err, "git cat-file %s", mode)
+	}
+	return &catFileProcess{
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: bufio.NewReader(stdout),
+	}, nil
+}
+
+// request writes the given revisions to the process and reads the response for
+// each one. If withContents is true, the object contents are read as well
+// (this must match the mode that the process was started with).
+func (p *catFileProcess) request(revisions []string, withContents bool) ([]*GetRefsItem, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	items, err := p.requestLocked(revisions, withContents)
+	if err != nil {
+		p.broken = true
+		_ = p.cmd.Process.Kill()
+		go func() { _ = p.cmd.Wait() }()
+	}
+	return items, err
+}
+
+func (p *catFileProcess) requestLocked(revisions []string, withContents bool) ([]*GetRefsItem, error) {
+	for _, rev := range revisions {
+		if strings.ContainsAny(rev, "\n") {
+			return nil, errors.Errorf("invalid revision %q", rev)
+		}
+	}
+	// Write the requests concurrently with reading the responses: git might
+	// block on writing its output if we write a lot of revisions at once.
+	writeErr := make(chan error, 1)
+	go func() {
+		var err error
+		for _, rev := range revisions {
+			if _, err = io.WriteString(p.stdin, rev+"\n"); err != nil {
+				break
+			}
+		}
+		writeErr <- err
+	}()
+
+	items := make([]*GetRefsItem, 0, len(revisions))
+	for _, rev := range revisions {
+		// The output *usually* looks like:
+		//        <oid> SP <type> SP <size> LF
+		//        <contents> LF
+		// but it can also be
+		//        <oid> SP {missing|ambiguous} LF
+		header, err := p.stdout.ReadString('\n')
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read cat-file output")
+		}
+		fields := strings.Fields(header)
+		if len(fields) < 2 {
+			return nil, errors.Errorf("failed to read cat-file output: unexpected header %q", header)
+		}
+		item := &GetRefsItem{Revision: rev, Oid: fields[0], Type: fields[1]}
+		items = append(items, item)
+		if item.Type == "missing" || item.Type == "ambiguous" || !withContents {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, errors.Errorf("failed to read cat-file output: unexpected header %q", header)
+		}
+		var size int64
+		if _, err := fmt.Sscanf(fields[2], "%d", &size); err != nil {
+			return nil, errors.Wrap(err, "failed to read cat-file output")
+		}
+		// The contents are followed by a newline.
+		contents := make([]byte, size+1)
+		if _, err := io.ReadFull(p.stdout, contents); err != nil {
+			return nil, errors.Wrap(err, "failed to read cat-file output")
+		}
+		item.Contents = contents[:size]
+	}
+	if err := <-writeErr; err != nil {
+		return nil, errors.Wrap(err, "failed to write cat-file input")
+	}
+	return items, nil
+}
+
+func (p *catFileProcess) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_ = p.stdin.Close()
+	return p.cmd.Wait()
+}
+
+// catFile returns the long-lived cat-file process for the given mode (starting
+// it if necessary).
+func (r *Repo) catFile(mode string) (*catFileProcess, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p, ok := r.catFiles[mode]; ok && !p.broken {
+		return p, nil
+	}
+	p, err := startCatFile(r.repoDir, mode)
+	if err != nil {
+		return nil, err
+	}
+	r.log.Debugf("started git cat-file %s", mode)
+	r.catFiles[mode] = p
+	return p, nil
+}
+
+// ObjectIDs resolves the given revisions to object IDs (using a long-lived
+// `git cat-file --batch-check` process). The object ID of a revision that
+// doesn't exist is Missing.
+func (r *Repo) ObjectIDs(revisions []string) ([]string, error) {
+	startTime := time.Now()
+	p, err := r.catFile("--batch-check")
+	if err != nil {
+		return nil, err
+	}
+	items, err := p.request(revisions, false)
+	r.recordCall("cat-file --batch-check", time.Since(startTime))
+	if err != nil {
+		return nil, err
+	}
+	oids := make([]string, len(items))
+	for i, item := range items {
+		oids[i] = item.Oid
+		if item.Type == "missing" || item.Type == "ambiguous" {
+			oids[i] = Missing
+		}
+	}
+	return oids, nil
+}
+
+// Close stops any long-lived git processes associated with the repository.
+// The repository can still be used afterwards (the processes are restarted as
+// needed).
+func (r *Repo) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	for mode, p := range r.catFiles {
+		if p.broken {
+			// Already killed when it broke.
+			delete(r.catFiles, mode)
+			continue
+		}
+		if err := p.close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(r.catFiles, mode)
+	}
+	return errors.Combine(errs...)
+}
@@ -0,0 +1,54 @@
+package git_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/git/gittest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetRefs(t *testing.T) {
+	repo := gittest.NewTempRepo(t)
+	head, err := repo.RevParse(&git.RevParse{Rev: "HEAD"})
+	require.NoError(t, err)
+
+	items, err := repo.GetRefs(&git.GetRefs{Revisions: []string{"HEAD:README.md", "refs/heads/nope"}})
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, git.TypeBlob, items[0].Type)
+	assert.Equal(t, "# Hello World", string(items[0].Contents))
+	assert.Equal(t, "missing", items[1].Type)
+
+	// Objects and refs that are created after the process was started are
+	// visible to subsequent reads.
+	oid, err := repo.GitStdin([]string{"hash-object", "-w", "--stdin"}, strings.NewReader("hello\n"))
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateRef(&git.UpdateRef{Ref: "refs/test/hello", New: oid}))
+	items, err = repo.GetRefs(&git.GetRefs{Revisions: []string{"refs/test/hello"}})
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, oid, items[0].Oid)
+	assert.Equal(t, "hello\n", string(items[0].Contents))
+
+	oids, err := repo.ObjectIDs([]string{"refs/heads/main", "refs/test/hello", "refs/heads/nope"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{head, oid, git.Missing}, oids)
+
+	// The process is restarted after the repository is closed.
+	require.NoError(t, repo.Close())
+	oids, err = repo.ObjectIDs([]string{"refs/test/hello"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{oid}, oids)
+
+	var found bool
+	for _, stats := range repo.Stats() {
+		if stats.Command == "cat-file --batch-check" {
+			found = true
+			assert.Equal(t, 2, stats.Count)
+		}
+	}
+	assert.True(t, found, "expected stats for cat-file --batch-check")
+}
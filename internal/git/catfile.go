@@ -1,10 +1,7 @@
 package git
 
 import (
-	"bytes"
-	"emperror.dev/errors"
-	"fmt"
-	"io"
+	"time"
 )
 
 type GetRefs struct {
@@ -24,69 +21,17 @@ type GetRefsItem struct {
 }
 
 // GetRefs reads the contents of the specified objects from the repository.
-// This corresponds to the `git cat-file --batch` command.
+// This uses a long-lived `git cat-file --batch` process.
 func (r *Repo) GetRefs(opts *GetRefs) ([]*GetRefsItem, error) {
-	input := new(bytes.Buffer)
-	for _, item := range opts.Revisions {
-		input.WriteString(item)
-		input.WriteString("\n")
+	if len(opts.Revisions) == 0 {
+		return nil, nil
 	}
-
-	res, err := r.GitStdin([]string{"cat-file", "--batch"}, input)
+	startTime := time.Now()
+	p, err := r.catFile("--batch")
 	if err != nil {
 		return nil, err
 	}
-	output := bytes.NewBufferString(res)
-	items := make([]*GetRefsItem, 0, len(opts.Revisions))
-	for _, rev := range opts.Revisions {
-		// The output *usually* looks like:
-		//        <oid> SP <type> SP <size> LF
-		//        <contents> LF
-		// but it can also be
-		//        <oid> SP {missing|ambiguous} LF
-
-		item := GetRefsItem{Revision: rev}
-		items = append(items, &item)
-		_, err := fmt.Fscanf(output, "%s %s", &item.Oid, &item.Type)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to read cat-file output")
-		}
-
-		// special case where the rest of the format is ignored
-		if item.Type == "missing" || item.Type == "ambiguous" {
-			_, err := fmt.Fscanf(output, "\n")
-			if err != nil {
-				return nil, errors.Wrap(err, "failed to read cat-file output")
-			}
-			continue
-		}
-
-		// normal case: read the contents of the object
-		var size int64
-		_, err = fmt.Fscanf(output, "%d\n", &size)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to read cat-file output")
-		}
-		item.Contents = make([]byte, size)
-		_, err = io.ReadFull(output, item.Contents)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to read cat-file output")
-		}
-
-		// output includes a newline after the item contents
-		// we have to read it otherwise subsequent iterations will fail
-		// (Scanf refuses to consume the newline)
-		lf, err := output.ReadByte()
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				continue
-			}
-			return nil, errors.Wrap(err, "failed to read cat-file output")
-		}
-		if lf != '\n' {
-			return nil, errors.New("failed to read cat-file output")
-		}
-	}
-
-	return items, nil
+	items, err := p.request(opts.Revisions, true)
+	r.recordCall("cat-file --batch", time.Since(startTime))
+	return items, err
 }
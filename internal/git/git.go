@@ -2,12 +2,15 @@ package git
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"net/url"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"emperror.dev/errors"
@@ -17,25 +20,99 @@ import (
 )
 
 type Repo struct {
-	repoDir string
-	log     logrus.FieldLogger
+	repoDir   string
+	gitDir    string
+	commonDir string
+	log       logrus.FieldLogger
+	// The context that git commands are run with (see WithContext).
+	ctx context.Context
+	// The state that is shared between all copies of the Repo that were
+	// created with WithContext.
+	*repoState
 }
 
-func OpenRepo(repoDir string) (*Repo, error) {
+type repoState struct {
+	mu sync.Mutex
+	// Long-lived `git cat-file` processes (keyed by mode).
+	catFiles map[string]*catFileProcess
+	// Statistics about the git commands that were run (keyed by command).
+	stats map[string]*CallStats
+	// The cached remote configuration and default branch. These are
+	// invalidated whenever the files that they're derived from change.
+	remoteConfig       *RemoteConfig
+	remoteConfigStamp  fileStamp
+	defaultBranch      string
+	defaultBranchStamp fileStamp
+	// The remote that was chosen by the user (see SetDefaultRemote).
+	preferredRemote string
+	// Set if git merge-tree doesn't support --write-tree (git < 2.38), in
+	// which case rebases can't be done in memory.
+	mergeTreeUnsupported bool
+}
+
+// OpenRepo opens the Git repository whose working tree is at repoDir. Every
+// git command that is run for the repository is killed when ctx is done.
+func OpenRepo(ctx context.Context, repoDir string) (*Repo, error) {
 	r := &Repo{
-		repoDir,
-		logrus.WithFields(logrus.Fields{"repo": path.Base(repoDir)}),
+		repoDir: repoDir,
+		log:     logrus.WithFields(logrus.Fields{"repo": path.Base(repoDir)}),
+		ctx:     ctx,
+		repoState: &repoState{
+			catFiles: make(map[string]*catFileProcess),
+			stats:    make(map[string]*CallStats),
+		},
+	}
+
+	// In a linked worktree (or a submodule), .git is a file that points to the
+	// actual Git directory, so we need to ask Git where it is.
+	out, err := r.Git("rev-parse", "--absolute-git-dir", "--git-common-dir")
+	if err != nil {
+		return nil, errors.WrapIff(err, "failed to determine Git directory of %q", repoDir)
+	}
+	dirs := strings.Split(out, "\n")
+	if len(dirs) != 2 {
+		return nil, errors.Errorf("failed to determine Git directory of %q: unexpected output %q", repoDir, out)
+	}
+	r.gitDir = dirs[0]
+	r.commonDir = dirs[1]
+	if !filepath.IsAbs(r.commonDir) {
+		r.commonDir = filepath.Join(repoDir, r.commonDir)
 	}
 
 	return r, nil
 }
 
+// WithContext returns a copy of the repository that runs git commands with the
+// given context. This is mostly useful to clean up after the original context
+// was cancelled (e.g., because the user pressed Ctrl-C).
+func (r *Repo) WithContext(ctx context.Context) *Repo {
+	r2 := *r
+	r2.ctx = ctx
+	return &r2
+}
+
+// Context returns the context that git commands are run with.
+func (r *Repo) Context() context.Context {
+	return r.ctx
+}
+
+// Dir returns the top-level directory of the working tree.
 func (r *Repo) Dir() string {
 	return r.repoDir
 }
 
+// GitDir returns the Git directory of the working tree. For linked worktrees,
+// this is a directory within the common Git directory that contains the state
+// that is specific to the worktree (e.g., HEAD or an in-progress rebase).
 func (r *Repo) GitDir() string {
-	return path.Join(r.repoDir, ".git")
+	return r.gitDir
+}
+
+// CommonDir returns the Git directory that is shared between all of the
+// worktrees of the repository (e.g., the directory that contains the refs and
+// the config).
+func (r *Repo) CommonDir() string {
+	return r.commonDir
 }
 
 func (r *Repo) DefaultBranch() (string, error) {
@@ -44,7 +121,16 @@ func (r *Repo) DefaultBranch() (string, error) {
 		return "", err
 	}
 
-	ref, err := r.Git("symbolic-ref", "refs/remotes/"+remote.Label+"/HEAD")
+	headRef := "refs/remotes/" + remote.Label + "/HEAD"
+	stamp := r.stampFiles("config", headRef)
+	r.mu.Lock()
+	if r.defaultBranch != "" && r.defaultBranchStamp == stamp {
+		defer r.mu.Unlock()
+		return r.defaultBranch, nil
+	}
+	r.mu.Unlock()
+
+	ref, err := r.Git("symbolic-ref", headRef)
 	if err != nil {
 		logrus.WithError(err).Debug("failed to determine remote HEAD")
 		// this communicates with the remote, so we probably don't want to run
@@ -56,15 +142,25 @@ func (r *Repo) DefaultBranch() (string, error) {
 		)
 		return "", errors.New("failed to determine remote HEAD")
 	}
-	return strings.TrimPrefix(ref, "refs/remotes/"+remote.Label+"/"), nil
+	defaultBranch := strings.TrimPrefix(ref, "refs/remotes/"+remote.Label+"/")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.defaultBranch = defaultBranch
+	r.defaultBranchStamp = stamp
+	return defaultBranch, nil
 }
 
 func (r *Repo) Git(args ...string) (string, error) {
 	startTime := time.Now()
-	cmd := exec.Command("git", args...)
+	cmd := exec.CommandContext(r.ctx, "git", args...)
 	cmd.Dir = r.repoDir
 	out, err := cmd.Output()
-	log := r.log.WithField("duration", time.Since(startTime))
+	duration := time.Since(startTime)
+	r.recordCall(args[0], duration)
+	log := r.log.WithField("duration", duration)
+	if err != nil && r.ctx.Err() != nil {
+		return "", errors.Wrapf(r.ctx.Err(), "git %s", args[0])
+	}
 	if err != nil {
 		stderr := "<no output>"
 		var exitError *exec.ExitError
@@ -83,6 +179,8 @@ func (r *Repo) Git(args ...string) (string, error) {
 type RunOpts struct {
 	Args []string
 	Env  []string
+	// The standard input of the command (if any).
+	Stdin io.Reader
 	// If true, return a non-nil error if the command exited with a non-zero
 	// exit code.
 	ExitError bool
@@ -100,14 +198,23 @@ func (o Output) Lines() []string {
 }
 
 func (r *Repo) Run(opts *RunOpts) (*Output, error) {
-	cmd := exec.Command("git", opts.Args...)
+	startTime := time.Now()
+	cmd := exec.CommandContext(r.ctx, "git", opts.Args...)
 	cmd.Dir = r.repoDir
 	r.log.Debugf("git %s", opts.Args)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 	cmd.Env = append(os.Environ(), opts.Env...)
+	cmd.Stdin = opts.Stdin
 	err := cmd.Run()
+	if len(opts.Args) > 0 {
+		r.recordCall(opts.Args[0], time.Since(startTime))
+	}
+	if err != nil && r.ctx.Err() != nil {
+		// The command was killed, so its exit code is meaningless.
+		return nil, errors.Wrapf(r.ctx.Err(), "git %s", opts.Args)
+	}
 	var exitError *exec.ExitError
 	if err != nil && !errors.As(err, &exitError) {
 		return nil, errors.Wrapf(err, "git %s", opts.Args)
@@ -123,11 +230,16 @@ func (r *Repo) Run(opts *RunOpts) (*Output, error) {
 }
 
 func (r *Repo) GitStdin(args []string, stdin io.Reader) (string, error) {
-	cmd := exec.Command("git", args...)
+	startTime := time.Now()
+	cmd := exec.CommandContext(r.ctx, "git", args...)
 	cmd.Dir = r.repoDir
 	cmd.Stdin = stdin
 	r.log.Debugf("git %s", args)
 	out, err := cmd.Output()
+	r.recordCall(args[0], time.Since(startTime))
+	if err != nil && r.ctx.Err() != nil {
+		return "", errors.Wrapf(r.ctx.Err(), "git %s", args[0])
+	}
 	if err != nil {
 		stderr := "<no output>"
 		var exitError *exec.ExitError
@@ -227,6 +339,25 @@ func (r *Repo) MergeBase(mb *MergeBase) (string, error) {
 	return r.Git(args...)
 }
 
+// IsAncestor returns true if the first commit is an ancestor of the second
+// commit (every commit is considered an ancestor of itself).
+func (r *Repo) IsAncestor(ancestor string, descendant string) (bool, error) {
+	res, err := r.Run(&RunOpts{
+		Args: []string{"merge-base", "--is-ancestor", ancestor, descendant},
+	})
+	if err != nil {
+		return false, err
+	}
+	switch res.ExitCode {
+	case 0:
+		return true, nil
+	case 1:
+		return false, nil
+	default:
+		return false, errors.Errorf("git merge-base --is-ancestor: %s", string(res.Stderr))
+	}
+}
+
 type UpdateRef struct {
 	// The name of the ref (e.g., refs/heads/my-branch).
 	Ref string
@@ -248,6 +379,50 @@ func (r *Repo) UpdateRef(update *UpdateRef) error {
 	return errors.WrapIff(err, "failed to write ref %q (%s)", update.Ref, ShortSha(update.New))
 }
 
+// ErrRefConflict is returned by UpdateRefs if the current value of a ref did
+// not match the expected old value.
+var ErrRefConflict = errors.New("ref was modified concurrently")
+
+// UpdateRefs updates several refs within the Git repository in a single
+// transaction: either all of the refs are updated or none of them are.
+// A New value of Missing deletes the ref.
+func (r *Repo) UpdateRefs(updates []UpdateRef) error {
+	var stdin bytes.Buffer
+	for _, update := range updates {
+		if update.New == Missing {
+			if update.Old == Missing {
+				// Nothing to do: the ref is expected to not exist.
+				continue
+			}
+			stdin.WriteString("delete " + update.Ref)
+		} else {
+			stdin.WriteString("update " + update.Ref + " " + update.New)
+		}
+		if update.Old != "" {
+			stdin.WriteString(" " + update.Old)
+		}
+		stdin.WriteString("\n")
+	}
+	if stdin.Len() == 0 {
+		return nil
+	}
+	res, err := r.Run(&RunOpts{
+		Args:  []string{"update-ref", "--stdin"},
+		Stdin: &stdin,
+	})
+	if err != nil {
+		return err
+	}
+	if res.ExitCode != 0 {
+		stderr := strings.TrimSpace(string(res.Stderr))
+		if strings.Contains(stderr, "cannot lock ref") {
+			return errors.WithMessage(ErrRefConflict, stderr)
+		}
+		return errors.Errorf("failed to update refs: %s", stderr)
+	}
+	return nil
+}
+
 type Remote struct {
 	// the label given to the remote config, typically "origin"
 	Label string
@@ -257,20 +432,15 @@ type Remote struct {
 	RepoSlug string
 }
 
-func getRemote(repoDir string, label string) (*Remote, error) {
+func (r *Repo) getRemote(label string) (*Remote, error) {
 	// Note: 'git remote get-url' gets the "real" URL of the remote (taking
 	// 'insteadOf' from git config into account) whereas 'git config --get ...'
 	// does *not*. Not sure if it matters here.
-	cmd := exec.Command("git", "remote", "get-url", label)
-	cmd.Dir = repoDir
-	out, err := cmd.Output()
-
+	remoteUrl, err := r.Git("remote", "get-url", label)
 	if err != nil {
 		return nil, err
 	}
 
-	remoteUrl := strings.TrimSpace(string(out))
-
 	if remoteUrl == "" {
 		return nil, errors.New("remote URL is empty")
 	}
@@ -294,16 +464,22 @@ type RemoteConfig struct {
 	remoteMap     map[string]*Remote
 }
 
+// RemoteConfig returns the configuration of the Git remotes. The result is
+// cached until the Git config changes.
 func (r *Repo) RemoteConfig() (*RemoteConfig, error) {
-	cmd := exec.Command("git", "remote")
-	cmd.Dir = r.repoDir
-	out, err := cmd.Output()
+	stamp := r.stampFiles("config")
+	r.mu.Lock()
+	if r.remoteConfig != nil && r.remoteConfigStamp == stamp {
+		defer r.mu.Unlock()
+		return r.remoteConfig, nil
+	}
+	r.mu.Unlock()
 
+	strOut, err := r.Git("remote")
 	if err != nil {
 		return nil, err
 	}
 
-	strOut := string(out)
 	defaultRemote := ""
 	remoteMap := make(map[string]*Remote)
 
@@ -319,7 +495,7 @@ func (r *Repo) RemoteConfig() (*RemoteConfig, error) {
 			defaultRemote = label
 		}
 
-		remote, err := getRemote(r.repoDir, label)
+		remote, err := r.getRemote(label)
 
 		if err != nil {
 			return nil, err
@@ -328,7 +504,12 @@ func (r *Repo) RemoteConfig() (*RemoteConfig, error) {
 		remoteMap[label] = remote
 	}
 
-	return &RemoteConfig{defaultRemote, remoteMap}, nil
+	remoteConfig := &RemoteConfig{defaultRemote, remoteMap}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.remoteConfig = remoteConfig
+	r.remoteConfigStamp = stamp
+	return remoteConfig, nil
 }
 
 func (r *Repo) Remote(label string) (*Remote, error) {
@@ -345,7 +526,25 @@ func (r *Repo) Remote(label string) (*Remote, error) {
 	return remote, nil
 }
 
+// SetDefaultRemote sets the remote that DefaultRemote returns (instead of
+// origin or the first listed remote). An empty label restores the default.
+func (r *Repo) SetDefaultRemote(label string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.preferredRemote = label
+}
+
+// DefaultRemote returns the remote that av pushes to and fetches from. This is
+// the remote set with SetDefaultRemote if any, otherwise origin (or the first
+// listed remote if there's no origin).
 func (r *Repo) DefaultRemote() (*Remote, error) {
+	r.mu.Lock()
+	preferred := r.preferredRemote
+	r.mu.Unlock()
+	if preferred != "" {
+		return r.Remote(preferred)
+	}
+
 	remoteConfig, err := r.RemoteConfig()
 	if err != nil {
 		return nil, err
@@ -1,6 +1,10 @@
 package git_test
 
 import (
+	"context"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/git"
 	"github.com/aviator-co/av/internal/git/gittest"
 	"github.com/stretchr/testify/require"
 	"testing"
@@ -77,3 +81,40 @@ func TestRemote(t *testing.T) {
 	_, err = repo.DefaultRemote()
 	require.ErrorContains(t, err, "no remote config found")
 }
+
+func TestRepoContext(t *testing.T) {
+	repo := gittest.NewTempRepo(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := repo.WithContext(ctx)
+	cancel()
+
+	_, err := cancelled.Git("status")
+	require.True(t, errors.Is(err, context.Canceled), "expected cancellation error, got %v", err)
+	_, err = cancelled.Run(&git.RunOpts{Args: []string{"status"}})
+	require.True(t, errors.Is(err, context.Canceled), "expected cancellation error, got %v", err)
+
+	// The original repo is unaffected
+	_, err = repo.Git("status")
+	require.NoError(t, err)
+}
+
+func TestSetDefaultRemote(t *testing.T) {
+	repo := gittest.NewTempRepo(t)
+	_, err := repo.Git("remote", "add", "upstream", "https://github.com/aviator-co/upstream-repo.git")
+	require.NoError(t, err)
+
+	repo.SetDefaultRemote("upstream")
+	remote, err := repo.DefaultRemote()
+	require.NoError(t, err)
+	require.Equal(t, "upstream", remote.Label)
+	require.Equal(t, "aviator-co/upstream-repo", remote.RepoSlug)
+
+	repo.SetDefaultRemote("nonexistent")
+	_, err = repo.DefaultRemote()
+	require.Error(t, err)
+
+	repo.SetDefaultRemote("")
+	remote, err = repo.DefaultRemote()
+	require.NoError(t, err)
+	require.Equal(t, "origin", remote.Label)
+}
@@ -1,6 +1,7 @@
 package gittest
 
 import (
+	"context"
 	"github.com/aviator-co/av/internal/git"
 	"github.com/aviator-co/av/internal/meta"
 	"github.com/sirupsen/logrus"
@@ -31,8 +32,9 @@ func NewTempRepo(t *testing.T) *git.Repo {
 	err := init.Run()
 	require.NoError(t, err, "failed to initialize git repository")
 
-	repo, err := git.OpenRepo(dir)
+	repo, err := git.OpenRepo(context.Background(), dir)
 	require.NoError(t, err, "failed to open repo")
+	t.Cleanup(func() { _ = repo.Close() })
 
 	settings := map[string]string{
 		"user.name":  "av-test",
@@ -1,7 +1,10 @@
 package git
 
 import (
+	"emperror.dev/errors"
 	"github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 )
@@ -42,6 +45,13 @@ func (r *Repo) Rebase(opts RebaseOpts) (*Output, error) {
 			Args: []string{"rebase", "--abort"},
 		})
 	}
+	if opts.Branch != "" {
+		// Git refuses to rebase a branch that is checked out in another
+		// worktree, but only after it already checked out the branch here.
+		if err := r.CheckNotCheckedOutElsewhere(opts.Branch); err != nil {
+			return nil, err
+		}
+	}
 	if opts.Onto != "" {
 		args = append(args, "--onto", opts.Onto)
 	}
@@ -53,8 +63,33 @@ func (r *Repo) Rebase(opts RebaseOpts) (*Output, error) {
 	return r.Run(&RunOpts{Args: args})
 }
 
+// RebaseInProgress returns true if a rebase was started in the worktree and
+// hasn't been finished or aborted yet (e.g., because of a conflict or because
+// git was interrupted).
+func (r *Repo) RebaseInProgress() bool {
+	for _, name := range []string{"rebase-merge", "rebase-apply"} {
+		if _, err := os.Stat(filepath.Join(r.GitDir(), name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
 // RebaseParse runs a `git rebase` and parses the output into a RebaseResult.
+// If opts.Branch is set, the branch is first rebased in memory (without
+// checking it out); a real `git rebase` is only run if that's not possible
+// (usually because a commit conflicts and the user needs to resolve it).
 func (r *Repo) RebaseParse(opts RebaseOpts) (*RebaseResult, error) {
+	if opts.Branch != "" && !opts.Continue && !opts.Abort {
+		res, err := r.restack(opts)
+		if err == nil {
+			return res, nil
+		}
+		if !errors.Is(err, errRestackFallback) {
+			return nil, err
+		}
+		r.log.WithError(err).Debug("falling back to git rebase")
+	}
 	out, err := r.Rebase(opts)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,242 @@
+package git
+
+import (
+	"bytes"
+	"strings"
+
+	"emperror.dev/errors"
+)
+
+// errRestackFallback is returned by restack if the rebase can't be done in
+// memory (e.g., because a commit conflicts) and needs to fall back to a real
+// `git rebase`.
+var errRestackFallback = errors.New("cannot rebase in memory")
+
+// restack performs the equivalent of `git rebase --onto <onto> <upstream>
+// <branch>` entirely within the object database: each commit is replayed with
+// `git merge-tree --write-tree` (git 2.38+) and `git commit-tree`, and only the
+// branch ref is updated at the end. This means that the working tree is never
+// touched (unless the branch is checked out, in which case it's updated like
+// `git reset --keep` would).
+//
+// Nothing is modified if any of the commits conflict; errRestackFallback is
+// returned instead so that the caller can run a real rebase (which stops at the
+// conflict so that the user can resolve it).
+func (r *Repo) restack(opts RebaseOpts) (*RebaseResult, error) {
+	r.mu.Lock()
+	unsupported := r.mergeTreeUnsupported
+	r.mu.Unlock()
+	if unsupported {
+		return nil, errors.WithMessage(errRestackFallback, "git merge-tree --write-tree is not supported")
+	}
+	if err := r.CheckNotCheckedOutElsewhere(opts.Branch); err != nil {
+		return nil, err
+	}
+	onto := opts.Onto
+	if onto == "" {
+		onto = opts.Upstream
+	}
+	branchRef := "refs/heads/" + opts.Branch
+	oids, err := r.ObjectIDs([]string{branchRef + "^{commit}", onto + "^{commit}", opts.Upstream + "^{commit}"})
+	if err != nil {
+		return nil, err
+	}
+	for i, rev := range []string{branchRef, onto, opts.Upstream} {
+		if oids[i] == Missing {
+			return nil, errors.Errorf("failed to rebase: %q is not a commit", rev)
+		}
+	}
+	oldHead, base := oids[0], oids[1]
+
+	// This is the same set of commits (in the same order) that git rebase
+	// picks: merge commits are dropped and commits whose changes are already
+	// in upstream are skipped.
+	out, err := r.Git(
+		"rev-list", "--reverse", "--topo-order", "--no-merges", "--cherry-pick", "--right-only",
+		oids[2]+"..."+oldHead,
+	)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := r.readCommits(strings.Fields(out))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range commits {
+		if len(c.parents) == 1 && c.parents[0] == base {
+			// The commit is already based on the new base, so we can keep it
+			// as is (this is what git rebase does too).
+			base = c.oid
+			continue
+		}
+		next, err := r.replayCommit(c, base)
+		if err != nil {
+			return nil, err
+		}
+		base = next
+	}
+
+	if base == oldHead {
+		return &RebaseResult{Status: RebaseAlreadyUpToDate}, nil
+	}
+	if err := r.restackUpdateBranch(opts.Branch, oldHead, base, onto); err != nil {
+		return nil, err
+	}
+	r.log.Debugf("rebased %s in memory (%s -> %s)", opts.Branch, ShortSha(oldHead), ShortSha(base))
+	return &RebaseResult{Status: RebaseUpdated}, nil
+}
+
+type restackCommit struct {
+	oid     string
+	tree    string
+	parents []string
+	// The author identity and date (in Git's internal format).
+	authorName  string
+	authorEmail string
+	authorDate  string
+	message     []byte
+}
+
+func (r *Repo) readCommits(oids []string) ([]restackCommit, error) {
+	if len(oids) == 0 {
+		return nil, nil
+	}
+	items, err := r.GetRefs(&GetRefs{Revisions: oids})
+	if err != nil {
+		return nil, err
+	}
+	commits := make([]restackCommit, 0, len(items))
+	for _, item := range items {
+		c, err := parseRestackCommit(item)
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, c)
+	}
+	return commits, nil
+}
+
+func parseRestackCommit(item *GetRefsItem) (restackCommit, error) {
+	c := restackCommit{oid: item.Oid}
+	if item.Type != "commit" {
+		return c, errors.Errorf("failed to read commit %q: unexpected object type %q", item.Revision, item.Type)
+	}
+	header, message, _ := bytes.Cut(item.Contents, []byte("\n\n"))
+	c.message = message
+	for _, line := range strings.Split(string(header), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "tree":
+			c.tree = value
+		case "parent":
+			c.parents = append(c.parents, value)
+		case "author":
+			// author Jane Doe <jane@example.com> 1700000000 +0000
+			end := strings.LastIndex(value, "> ")
+			start := strings.Index(value, " <")
+			if start == -1 || end == -1 || end < start {
+				return c, errors.Errorf("failed to read commit %s: malformed author %q", item.Oid, value)
+			}
+			c.authorName = value[:start]
+			c.authorEmail = value[start+2 : end]
+			c.authorDate = value[end+2:]
+		case "encoding":
+			// commit-tree always writes UTF-8 (and so does everyone else
+			// nowadays), so leave the rare exception to git rebase.
+			return c, errors.WithMessagef(errRestackFallback, "commit %s uses encoding %s", ShortSha(item.Oid), value)
+		}
+	}
+	return c, nil
+}
+
+// replayCommit cherry-picks the commit on top of base and returns the new
+// commit (which is base itself if the commit became empty).
+func (r *Repo) replayCommit(c restackCommit, base string) (string, error) {
+	if len(c.parents) == 0 {
+		return "", errors.WithMessagef(errRestackFallback, "commit %s is a root commit", ShortSha(c.oid))
+	}
+	parent := c.parents[0]
+	// A cherry-pick is a three-way merge of base and the commit using the
+	// parent of the commit as the merge base. merge-tree only supports
+	// specifying the merge base since git 2.40, so instead we create a
+	// temporary commit with the tree of base whose parent is the parent of the
+	// commit. The only merge base of that commit and the commit is the parent.
+	baseTree, err := r.Git("rev-parse", base+"^{tree}")
+	if err != nil {
+		return "", err
+	}
+	tmp, err := r.commitTree(baseTree, parent, nil, []byte("av: temporary commit\n"))
+	if err != nil {
+		return "", err
+	}
+	res, err := r.Run(&RunOpts{Args: []string{"merge-tree", "--write-tree", "--no-messages", tmp, c.oid}})
+	if err != nil {
+		return "", err
+	}
+	switch res.ExitCode {
+	case 0:
+	case 1:
+		return "", errors.WithMessagef(errRestackFallback, "commit %s conflicts", ShortSha(c.oid))
+	default:
+		// Most likely, this version of git doesn't support --write-tree.
+		r.mu.Lock()
+		r.mergeTreeUnsupported = true
+		r.mu.Unlock()
+		return "", errors.WithMessagef(errRestackFallback, "git merge-tree failed: %s", strings.TrimSpace(string(res.Stderr)))
+	}
+	tree := strings.TrimSpace(string(res.Stdout))
+
+	if tree == baseTree {
+		parentTree, err := r.Git("rev-parse", parent+"^{tree}")
+		if err != nil {
+			return "", err
+		}
+		// Like git rebase, drop commits that became empty but keep the ones
+		// that were empty to begin with.
+		if parentTree != c.tree {
+			r.log.Debugf("dropping commit %s since its changes are already present", ShortSha(c.oid))
+			return base, nil
+		}
+	}
+
+	env := []string{
+		"GIT_AUTHOR_NAME=" + c.authorName,
+		"GIT_AUTHOR_EMAIL=" + c.authorEmail,
+		"GIT_AUTHOR_DATE=" + c.authorDate,
+	}
+	return r.commitTree(tree, base, env, c.message)
+}
+
+func (r *Repo) commitTree(tree string, parent string, env []string, message []byte) (string, error) {
+	res, err := r.Run(&RunOpts{
+		Args:      []string{"commit-tree", tree, "-p", parent},
+		Env:       env,
+		Stdin:     bytes.NewReader(message),
+		ExitError: true,
+	})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(res.Stdout)), nil
+}
+
+// restackUpdateBranch points the branch at the rebased commits. If the branch
+// is checked out, the working tree is updated as well (and local changes are
+// kept unless they conflict with the rebased commits).
+func (r *Repo) restackUpdateBranch(branch string, oldHead string, newHead string, onto string) error {
+	reflogMsg := "rebase (av): " + branch + " onto " + onto
+	if current, err := r.CurrentBranchName(); err == nil && current == branch {
+		_, err := r.Run(&RunOpts{
+			Args:      []string{"reset", "--keep", newHead},
+			Env:       []string{"GIT_REFLOG_ACTION=" + reflogMsg},
+			ExitError: true,
+		})
+		return errors.WrapIff(err, "failed to update checked out branch %q", branch)
+	}
+	_, err := r.Run(&RunOpts{
+		Args:      []string{"update-ref", "-m", reflogMsg, "refs/heads/" + branch, newHead, oldHead},
+		ExitError: true,
+	})
+	return errors.WrapIff(err, "failed to update branch %q", branch)
+}
@@ -0,0 +1,86 @@
+package git_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/git/gittest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRebaseInMemory(t *testing.T) {
+	repo := gittest.NewTempRepo(t)
+
+	// main <- one <- two
+	_, err := repo.Git("checkout", "-b", "one")
+	require.NoError(t, err)
+	gittest.CommitFile(t, repo, "one.txt", []byte("one"), gittest.WithMessage("Add one\n\nWith a body."))
+	_, err = repo.Git("checkout", "-b", "two")
+	require.NoError(t, err)
+	gittest.CommitFile(t, repo, "two.txt", []byte("two"))
+	_, err = repo.Git("checkout", "main")
+	require.NoError(t, err)
+	gittest.CommitFile(t, repo, "main.txt", []byte("main"))
+	oldOne, err := repo.RevParse(&git.RevParse{Rev: "one"})
+	require.NoError(t, err)
+
+	// Rebasing a branch that isn't checked out doesn't touch the working tree.
+	res, err := repo.RebaseParse(git.RebaseOpts{Branch: "one", Upstream: "main"})
+	require.NoError(t, err)
+	assert.Equal(t, git.RebaseUpdated, res.Status)
+	current, err := repo.CurrentBranchName()
+	require.NoError(t, err)
+	assert.Equal(t, "main", current)
+	assert.NoFileExists(t, filepath.Join(repo.Dir(), "one.txt"))
+	assert.False(t, repo.RebaseInProgress())
+
+	parent, err := repo.RevParse(&git.RevParse{Rev: "one^"})
+	require.NoError(t, err)
+	mainHead, err := repo.RevParse(&git.RevParse{Rev: "main"})
+	require.NoError(t, err)
+	assert.Equal(t, mainHead, parent)
+	for _, format := range []string{"%an <%ae> %ad", "%B"} {
+		oldValue, err := repo.Git("show", "-s", "--format="+format, oldOne)
+		require.NoError(t, err)
+		newValue, err := repo.Git("show", "-s", "--format="+format, "one")
+		require.NoError(t, err)
+		assert.Equal(t, oldValue, newValue)
+	}
+
+	// The children are replayed onto the rebased parent with --onto.
+	res, err = repo.RebaseParse(git.RebaseOpts{Branch: "two", Onto: "one", Upstream: oldOne})
+	require.NoError(t, err)
+	assert.Equal(t, git.RebaseUpdated, res.Status)
+	out, err := repo.Git("log", "--format=%s", "two")
+	require.NoError(t, err)
+	assert.Equal(t, "Write two.txt\nAdd one\nWrite main.txt\nInitial commit", out)
+
+	res, err = repo.RebaseParse(git.RebaseOpts{Branch: "two", Upstream: "one"})
+	require.NoError(t, err)
+	assert.Equal(t, git.RebaseAlreadyUpToDate, res.Status)
+}
+
+func TestRebaseInMemoryConflict(t *testing.T) {
+	repo := gittest.NewTempRepo(t)
+
+	_, err := repo.Git("checkout", "-b", "feature")
+	require.NoError(t, err)
+	gittest.CommitFile(t, repo, "README.md", []byte("feature"))
+	_, err = repo.Git("checkout", "main")
+	require.NoError(t, err)
+	gittest.CommitFile(t, repo, "README.md", []byte("main"))
+
+	// Conflicts fall back to a real rebase (which stops at the conflict).
+	res, err := repo.RebaseParse(git.RebaseOpts{Branch: "feature", Upstream: "main"})
+	require.NoError(t, err)
+	assert.Equal(t, git.RebaseConflict, res.Status)
+	assert.True(t, repo.RebaseInProgress())
+	_, err = repo.Rebase(git.RebaseOpts{Abort: true})
+	require.NoError(t, err)
+	readme, err := os.ReadFile(filepath.Join(repo.Dir(), "README.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "feature", string(readme))
+}
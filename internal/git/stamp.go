@@ -0,0 +1,26 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fileStamp identifies the state of a set of files in the common Git directory
+// so that cached values that are derived from them can be invalidated when they
+// change.
+type fileStamp string
+
+func (r *Repo) stampFiles(names ...string) fileStamp {
+	var sb strings.Builder
+	for _, name := range names {
+		stat, err := os.Stat(filepath.Join(r.CommonDir(), name))
+		if err != nil {
+			_, _ = fmt.Fprintf(&sb, "%s:missing;", name)
+			continue
+		}
+		_, _ = fmt.Fprintf(&sb, "%s:%d:%d;", name, stat.ModTime().UnixNano(), stat.Size())
+	}
+	return fileStamp(sb.String())
+}
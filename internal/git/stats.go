@@ -0,0 +1,45 @@
+package git
+
+import (
+	"sort"
+	"time"
+)
+
+// CallStats records how many times a git command was run and how long it took
+// in total.
+type CallStats struct {
+	// The git subcommand (e.g., rev-parse).
+	Command  string
+	Count    int
+	Duration time.Duration
+}
+
+func (r *Repo) recordCall(command string, duration time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats, ok := r.stats[command]
+	if !ok {
+		stats = &CallStats{Command: command}
+		r.stats[command] = stats
+	}
+	stats.Count++
+	stats.Duration += duration
+}
+
+// Stats returns statistics about the git commands that were run for this
+// repository (ordered by total duration, longest first).
+func (r *Repo) Stats() []CallStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := make([]CallStats, 0, len(r.stats))
+	for _, stats := range r.stats {
+		res = append(res, *stats)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Duration != res[j].Duration {
+			return res[i].Duration > res[j].Duration
+		}
+		return res[i].Command < res[j].Command
+	})
+	return res
+}
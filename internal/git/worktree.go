@@ -0,0 +1,78 @@
+package git
+
+import (
+	"path/filepath"
+	"strings"
+
+	"emperror.dev/errors"
+)
+
+// ErrBranchCheckedOut is returned when trying to modify a branch that is
+// checked out in another worktree.
+var ErrBranchCheckedOut = errors.New("branch is checked out in another worktree")
+
+type Worktree struct {
+	// The top-level directory of the worktree.
+	Path string
+	// The commit that is checked out in the worktree.
+	Head string
+	// The (short) name of the branch that is checked out in the worktree
+	// (empty if the worktree has a detached HEAD).
+	Branch string
+}
+
+// Worktrees returns all of the worktrees of the repository (including the
+// main worktree).
+func (r *Repo) Worktrees() ([]Worktree, error) {
+	out, err := r.Git("worktree", "list", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+	// The output consists of one stanza per worktree (separated by an empty
+	// line) where each line is "<attribute> SP <value>".
+	var worktrees []Worktree
+	for _, stanza := range strings.Split(out, "\n\n") {
+		var wt Worktree
+		for _, line := range strings.Split(stanza, "\n") {
+			attr, value, _ := strings.Cut(line, " ")
+			switch attr {
+			case "worktree":
+				wt.Path = value
+			case "HEAD":
+				wt.Head = value
+			case "branch":
+				wt.Branch = strings.TrimPrefix(value, "refs/heads/")
+			}
+		}
+		if wt.Path != "" {
+			worktrees = append(worktrees, wt)
+		}
+	}
+	return worktrees, nil
+}
+
+// CheckNotCheckedOutElsewhere returns an error (wrapping ErrBranchCheckedOut)
+// if the given branch is checked out in a worktree other than this one.
+func (r *Repo) CheckNotCheckedOutElsewhere(branch string) error {
+	worktrees, err := r.Worktrees()
+	if err != nil {
+		return err
+	}
+	for _, wt := range worktrees {
+		if wt.Branch != branch || samePath(wt.Path, r.repoDir) {
+			continue
+		}
+		return errors.WithMessagef(ErrBranchCheckedOut, "cannot modify branch %q (checked out at %s)", branch, wt.Path)
+	}
+	return nil
+}
+
+func samePath(a, b string) bool {
+	if resolved, err := filepath.EvalSymlinks(a); err == nil {
+		a = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(b); err == nil {
+		b = resolved
+	}
+	return filepath.Clean(a) == filepath.Clean(b)
+}
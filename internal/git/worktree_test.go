@@ -0,0 +1,50 @@
+package git_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/git/gittest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorktree(t *testing.T) {
+	repo := gittest.NewTempRepo(t)
+	_, err := repo.Git("branch", "feature")
+	require.NoError(t, err)
+	wtDir := filepath.Join(t.TempDir(), "feature")
+	_, err = repo.Git("worktree", "add", wtDir, "feature")
+	require.NoError(t, err)
+
+	wtRepo, err := git.OpenRepo(context.Background(), wtDir)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = wtRepo.Close() })
+
+	// The worktree has its own Git directory but shares the common one.
+	assert.Equal(t, samePath(t, repo.GitDir()), samePath(t, repo.CommonDir()))
+	assert.Equal(t, samePath(t, repo.CommonDir()), samePath(t, wtRepo.CommonDir()))
+	assert.NotEqual(t, samePath(t, wtRepo.GitDir()), samePath(t, wtRepo.CommonDir()))
+
+	worktrees, err := repo.Worktrees()
+	require.NoError(t, err)
+	require.Len(t, worktrees, 2)
+	assert.Equal(t, "main", worktrees[0].Branch)
+	assert.Equal(t, "feature", worktrees[1].Branch)
+
+	// Branches that are checked out in another worktree can't be rebased.
+	require.NoError(t, wtRepo.CheckNotCheckedOutElsewhere("feature"))
+	err = repo.CheckNotCheckedOutElsewhere("feature")
+	assert.True(t, errors.Is(err, git.ErrBranchCheckedOut), "expected checked out error, got %v", err)
+	_, err = repo.Rebase(git.RebaseOpts{Upstream: "main", Branch: "feature"})
+	assert.True(t, errors.Is(err, git.ErrBranchCheckedOut), "expected checked out error, got %v", err)
+}
+
+func samePath(t *testing.T, p string) string {
+	resolved, err := filepath.EvalSymlinks(p)
+	require.NoError(t, err)
+	return resolved
+}
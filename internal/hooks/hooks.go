@@ -0,0 +1,155 @@
+// Package hooks runs user-defined commands at well-defined points of av
+// operations (e.g., before pull requests are submitted).
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/config"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/sirupsen/logrus"
+)
+
+type Hook string
+
+const (
+	// PreBranch runs before a new stacked branch is created.
+	PreBranch Hook = "pre-branch"
+	// PostBranch runs after a new stacked branch was created.
+	PostBranch Hook = "post-branch"
+	// PreSync runs before a branch is synced with its parent.
+	PreSync Hook = "pre-sync"
+	// PostSync runs after a branch was synced with its parent (the branch is
+	// not necessarily checked out at that point).
+	PostSync Hook = "post-sync"
+	// PreSubmit runs before the pull request for a branch is created or
+	// updated.
+	PreSubmit Hook = "pre-submit"
+	// PostSubmit runs after the pull request for a branch was created or
+	// updated.
+	PostSubmit Hook = "post-submit"
+	// PrePush runs before a branch is pushed to the remote.
+	PrePush Hook = "pre-push"
+)
+
+// Info is the information about the branch that a hook is run for. It's
+// written (as JSON) to the standard input of the hook and is also available as
+// AV_* environment variables.
+type Info struct {
+	Hook        Hook              `json:"hook"`
+	Branch      string            `json:"branch"`
+	Parent      string            `json:"parent,omitempty"`
+	ParentTrunk bool              `json:"parentTrunk,omitempty"`
+	PullRequest *meta.PullRequest `json:"pullRequest,omitempty"`
+}
+
+func (i Info) env() []string {
+	env := []string{
+		"AV_HOOK=" + string(i.Hook),
+		"AV_BRANCH=" + i.Branch,
+		"AV_PARENT=" + i.Parent,
+		"AV_PARENT_TRUNK=" + strconv.FormatBool(i.ParentTrunk),
+	}
+	if i.PullRequest != nil {
+		env = append(env,
+			"AV_PR_ID="+i.PullRequest.ID,
+			"AV_PR_NUMBER="+strconv.FormatInt(i.PullRequest.Number, 10),
+			"AV_PR_URL="+i.PullRequest.Permalink,
+		)
+	}
+	return env
+}
+
+// Error is returned by Run if a hook exits with a non-zero exit code.
+type Error struct {
+	Hook     Hook
+	Command  string
+	ExitCode int
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s hook %q failed with exit code %d", e.Hook, e.Command, e.ExitCode)
+}
+
+// Dir returns the directory that contains the hook executables of the
+// repository (.git/av/hooks).
+func Dir(repo *git.Repo) string {
+	return filepath.Join(repo.CommonDir(), "av", "hooks")
+}
+
+// Run runs the given hook for the branch. The executable named after the hook
+// in Dir runs first (if any), followed by the commands that are configured in
+// the hooks section of the config (which are run with sh).
+//
+// Run stops at the first hook that fails and returns an *Error (which should
+// abort the operation in case of a pre-* hook).
+func Run(ctx context.Context, repo *git.Repo, hook Hook, branch meta.Branch) error {
+	info := Info{
+		Hook:        hook,
+		Branch:      branch.Name,
+		Parent:      branch.Parent.Name,
+		ParentTrunk: branch.Parent.Trunk,
+		PullRequest: branch.PullRequest,
+	}
+	stdin, err := json.Marshal(info)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal hook info")
+	}
+
+	var commands [][]string
+	executable := filepath.Join(Dir(repo), string(hook))
+	if stat, err := os.Stat(executable); err == nil {
+		if stat.Mode()&0111 == 0 {
+			_, _ = fmt.Fprint(os.Stderr,
+				"  - ", colors.Warning("WARNING:"), " ignoring hook ", colors.UserInput(executable),
+				" because it's not executable\n",
+			)
+		} else {
+			commands = append(commands, []string{executable})
+		}
+	}
+	for _, command := range config.Av.Hooks[string(hook)] {
+		commands = append(commands, []string{"sh", "-c", command})
+	}
+
+	for _, command := range commands {
+		display := command[len(command)-1]
+		logrus.WithFields(logrus.Fields{"hook": hook, "branch": branch.Name}).Debugf("running hook %q", display)
+		_, _ = fmt.Fprint(os.Stderr,
+			"  - running ", colors.UserInput(string(hook)), " hook ", colors.CliCmd(display), "\n",
+		)
+		cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+		cmd.Dir = repo.Dir()
+		cmd.Env = append(os.Environ(), info.env()...)
+		cmd.Stdin = bytes.NewReader(stdin)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		err := cmd.Run()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && ctx.Err() == nil {
+			return &Error{Hook: hook, Command: display, ExitCode: exitErr.ExitCode()}
+		}
+		if err != nil {
+			return errors.WrapIff(err, "failed to run %s hook %q", hook, display)
+		}
+	}
+	return nil
+}
+
+// RunPost runs a post-* hook. Since the operation has already happened at that
+// point, a failure is only reported as a warning.
+func RunPost(ctx context.Context, repo *git.Repo, hook Hook, branch meta.Branch) {
+	if err := Run(ctx, repo, hook, branch); err != nil {
+		_, _ = fmt.Fprint(os.Stderr, "  - ", colors.Warning("WARNING: "), err.Error(), "\n")
+	}
+}
@@ -0,0 +1,66 @@
+package hooks_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/config"
+	"github.com/aviator-co/av/internal/git/gittest"
+	"github.com/aviator-co/av/internal/hooks"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	repo := gittest.NewTempRepo(t)
+	ctx := context.Background()
+	out := filepath.Join(t.TempDir(), "out")
+	branch := meta.Branch{
+		Name:        "feature",
+		Parent:      meta.BranchState{Name: "main", Trunk: true},
+		PullRequest: &meta.PullRequest{ID: "PR_1", Number: 1, Permalink: "https://github.com/aviator-co/av/pull/1"},
+	}
+
+	// No hooks configured
+	require.NoError(t, hooks.Run(ctx, repo, hooks.PreSubmit, branch))
+
+	// The executable hook receives the info on stdin and in the environment.
+	require.NoError(t, os.MkdirAll(hooks.Dir(repo), 0755))
+	script := "#!/bin/sh\ncat > " + out + "\necho \"$AV_HOOK $AV_BRANCH $AV_PARENT $AV_PR_NUMBER\" >> " + out + ".env\n"
+	require.NoError(t, os.WriteFile(filepath.Join(hooks.Dir(repo), "pre-submit"), []byte(script), 0755))
+	require.NoError(t, hooks.Run(ctx, repo, hooks.PreSubmit, branch))
+
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	var info hooks.Info
+	require.NoError(t, json.Unmarshal(data, &info))
+	assert.Equal(t, hooks.PreSubmit, info.Hook)
+	assert.Equal(t, "feature", info.Branch)
+	assert.Equal(t, "main", info.Parent)
+	assert.True(t, info.ParentTrunk)
+	assert.Equal(t, int64(1), info.PullRequest.Number)
+	env, err := os.ReadFile(out + ".env")
+	require.NoError(t, err)
+	assert.Equal(t, "pre-submit feature main 1\n", string(env))
+
+	// Configured commands run after the executable and stop at the first
+	// failure.
+	config.Av.Hooks = map[string][]string{
+		"pre-submit": {"echo config >> " + out + ".env", "exit 3", "echo unreachable >> " + out + ".env"},
+	}
+	t.Cleanup(func() { config.Av.Hooks = nil })
+	err = hooks.Run(ctx, repo, hooks.PreSubmit, branch)
+	var hookErr *hooks.Error
+	require.True(t, errors.As(err, &hookErr), "expected hook error, got %v", err)
+	assert.Equal(t, hooks.PreSubmit, hookErr.Hook)
+	assert.Equal(t, "exit 3", hookErr.Command)
+	assert.Equal(t, 3, hookErr.ExitCode)
+	env, err = os.ReadFile(out + ".env")
+	require.NoError(t, err)
+	assert.Equal(t, "pre-submit feature main 1\npre-submit feature main 1\nconfig\n", string(env))
+}
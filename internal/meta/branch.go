@@ -30,58 +30,17 @@ type Branch struct {
 
 	// The merge commit onto the trunk branch, if any
 	MergeCommit string `json:"mergeCommit,omitempty"`
+
+	// The version of the metadata format that this metadata was stored in
+	// (see BranchSchemaVersion). The metadata is always written in the
+	// latest format.
+	Version int `json:"version"`
 }
 
 func (b *Branch) IsStackRoot() bool {
 	return b.Parent.Trunk
 }
 
-func (b *Branch) UnmarshalJSON(bytes []byte) error {
-	// We have to do a bit of backwards-compatible trickery here to support the
-	// fact that "parent" used to be a string field and now it's a struct
-	// (the main reason it's a struct is because we want the parent info to be
-	// updated atomically and doing it like this makes it harder to forget to
-	// update the branch name but forget to update the HEAD sha).
-	// Two things are happening here as far as the code is concerned:
-	// 1. We want to still use the normal JSON machinery to parse most fields
-	//    out of Branch (without having to write our own JSON parsing logic
-	//    here). To do that, we have to define a type alias for Branch which
-	// 	  effectively erases the UnmarshalJSON method (otherwise we get a stack
-	//	  overflow as this function would be called recursively).
-	// 2. We define a new type that embeds BranchAlias but overrides the Parent
-	//    field so we can parse that manually ourselves.
-	type BranchAlias Branch
-	type data struct {
-		BranchAlias
-		Parent json.RawMessage `json:"parent"`
-	}
-	var d data
-	if err := json.Unmarshal(bytes, &d); err != nil {
-		return err
-	}
-
-	// Copy over all the data that we unmarshalled into BranchAlias. This is
-	// everything except since Parent which we'll handle next. We need to take
-	// special care to copy name since it won't be defined on BranchAlias (since
-	// Name is not serialized to JSON). Instead we expect that the struct is
-	// always initialized with the name defined, so we have to copy it over here.
-	// (Doing just "*b = ..." will result in us erasing the name.)
-	d.BranchAlias.Name = b.Name
-	*b = Branch(d.BranchAlias)
-
-	// Parse the parent information (which can either be a string or a JSON)
-	var err error
-	b.Parent, err = unmarshalBranchState(d.Parent)
-	if err != nil {
-		return err
-	}
-
-	logrus.Debugf("parsed branch metadata: %s => %#+v %#+v", bytes, d, b)
-	return nil
-}
-
-var _ json.Unmarshaler = (*Branch)(nil)
-
 type PullRequest struct {
 	// The GitHub (GraphQL) ID of the pull request.
 	ID string `json:"id"`
@@ -101,25 +60,24 @@ func (p *PullRequest) GetNumber() int64 {
 	return p.Number
 }
 
-func unmarshalBranch(repo *git.Repo, name string, refName string, blob string) (Branch, bool) {
+// unmarshalBranch parses the branch metadata blob (upgrading it to the latest
+// format if necessary).
+// Corrupt metadata is never deleted here: `av doctor` reports it (see
+// Validate) and lets the user decide what to do with it.
+func unmarshalBranch(repo *git.Repo, name string, blob string) (Branch, error) {
 	branch := Branch{Name: name}
-	if err := json.Unmarshal([]byte(blob), &branch); err != nil {
-		logrus.WithError(err).WithField("ref", refName).Error("corrupt stack metadata, deleting...")
-		_ = repo.UpdateRef(&git.UpdateRef{Ref: refName, New: git.Missing})
-		return branch, false
+	if err := migrate(repo, name, []byte(blob), branchMigrations, &branch); err != nil {
+		return branch, errors.WrapIff(err, "failed to read metadata for branch %q", name)
 	}
-	if branch.Parent.Name == "" {
-		// COMPAT: assume parent branch is the default/mainline branch
-		defaultBranch, err := repo.DefaultBranch()
-		if err != nil {
-			// panic isn't great, but plumbing through the error is more effort
-			// that it's worth here
-			panic(errors.Wrap(err, "failed to determine repository default branch"))
-		}
-		branch.Parent.Name = defaultBranch
-		branch.Parent.Trunk = true
+	// The name isn't stored in the JSON (it's derived from the ref name).
+	branch.Name = name
+	if branch.Version > BranchSchemaVersion {
+		logrus.WithFields(logrus.Fields{
+			"branch":  name,
+			"version": branch.Version,
+		}).Debug("branch metadata was written by a newer version of av")
 	}
-	return branch, true
+	return branch, nil
 }
 
 // ReadBranch loads information about the branch from the git repository.
@@ -128,30 +86,41 @@ func unmarshalBranch(repo *git.Repo, name string, refName string, blob string) (
 // useful default is returned.
 func ReadBranch(repo *git.Repo, branchName string) (Branch, bool) {
 	refName := branchMetaRefName(branchName)
-	blob, err := repo.Git("cat-file", "blob", refName)
-
-	// Just assume that any error here means that the metadata ref doesn't exist
-	// (there's no easy way to distinguish between that and an actual Git error)
-	if err != nil {
-		defaultBranch, err := repo.DefaultBranch()
+	items, err := repo.GetRefs(&git.GetRefs{Revisions: []string{refName}})
+	if err != nil || len(items) != 1 || items[0].Type != git.TypeBlob {
 		if err != nil {
-			// panic isn't great, but plumbing through the error is more effort
-			// that it's worth here
-			panic(errors.Wrap(err, "failed to determine repository default branch"))
+			logrus.WithError(err).WithField("ref", refName).Debug("failed to read branch metadata")
 		}
-		// If there is no branch metadata, it probably means that they created
-		// the branch with "git checkout -b" and we implicitly assume that
-		// the branch is a stack root whose trunk is the repo default branch.
-		return Branch{
-			Name: branchName,
-			Parent: BranchState{
-				Trunk: true,
-				Name:  defaultBranch,
-			},
-		}, false
+		return defaultBranchMeta(repo, branchName), false
 	}
 
-	return unmarshalBranch(repo, branchName, refName, blob)
+	branch, err := unmarshalBranch(repo, branchName, string(items[0].Contents))
+	if err != nil {
+		logrus.WithError(err).Error("failed to read branch metadata")
+		return defaultBranchMeta(repo, branchName), false
+	}
+	return branch, true
+}
+
+// defaultBranchMeta returns the metadata that is assumed for a branch that
+// doesn't have any metadata yet.
+func defaultBranchMeta(repo *git.Repo, branchName string) Branch {
+	defaultBranch, err := repo.DefaultBranch()
+	if err != nil {
+		// panic isn't great, but plumbing through the error is more effort
+		// that it's worth here
+		panic(errors.Wrap(err, "failed to determine repository default branch"))
+	}
+	// If there is no branch metadata, it probably means that they created
+	// the branch with "git checkout -b" and we implicitly assume that
+	// the branch is a stack root whose trunk is the repo default branch.
+	return Branch{
+		Name: branchName,
+		Parent: BranchState{
+			Trunk: true,
+			Name:  defaultBranch,
+		},
+	}
 }
 
 // ReadAllBranches fetches all branch metadata stored in the git repository.
@@ -186,40 +155,66 @@ func ReadAllBranches(repo *git.Repo) (map[string]Branch, error) {
 	branches := make(map[string]Branch, len(refs))
 	for _, ref := range refContents {
 		name := strings.TrimPrefix(ref.Revision, branchMetaRefPrefix)
-		branch, _ := unmarshalBranch(repo, name, ref.Revision, string(ref.Contents))
+		branch, err := unmarshalBranch(repo, name, string(ref.Contents))
+		if err != nil {
+			logrus.WithError(err).Error("failed to read branch metadata")
+			continue
+		}
 		branches[name] = branch
 	}
 	return branches, nil
 }
 
+// Trunk returns the trunk branch that the stack of the given branch is based
+// on.
 func Trunk(repo *git.Repo, branchName string) (string, error) {
-	branch, _ := ReadBranch(repo, branchName)
-	if branch.Parent.Trunk {
-		return branch.Parent.Name, nil
+	var visited []string
+	current := branchName
+	for {
+		branch, _ := ReadBranch(repo, current)
+		if branch.Parent.Trunk {
+			return branch.Parent.Name, nil
+		}
+		visited = append(visited, current)
+		current = branch.Parent.Name
+		if slices.Contains(visited, current) {
+			return "", errors.Errorf(
+				"invariant error: branch %q is its own ancestor (run `av doctor` to find and fix the problem)",
+				current,
+			)
+		}
 	}
-	return Trunk(repo, branch.Parent.Name)
 }
 
 // Find all the ancestor branches of the given branch name and append them to
 // the given slice (in topological order: a comes before b if a is an ancestor
 // of b).
 func PreviousBranches(branches map[string]Branch, name string) ([]string, error) {
-	current, ok := branches[name]
-	if !ok {
-		return nil, errors.Errorf("branch metadata not found for %q", name)
-	}
-	parent := current.Parent
-	if parent.Trunk {
-		return nil, nil
-	}
-	if parent.Name == name {
-		logrus.Fatalf("invariant error: branch %q is its own parent (this is probably a bug with av)", name)
+	var previous []string
+	current := name
+	for {
+		branch, ok := branches[current]
+		if !ok {
+			return nil, errors.Errorf("branch metadata not found for %q", current)
+		}
+		if branch.Parent.Trunk {
+			break
+		}
+		current = branch.Parent.Name
+		if current == name || slices.Contains(previous, current) {
+			return nil, errors.Errorf(
+				"invariant error: branch %q is its own ancestor (run `av doctor` to find and fix the problem)",
+				current,
+			)
+		}
+		previous = append(previous, current)
 	}
-	previous, err := PreviousBranches(branches, parent.Name)
-	if err != nil {
-		return nil, err
+	// previous is in the order that we walked up the stack, but we need to
+	// return the stack root first.
+	for i, j := 0, len(previous)-1; i < j; i, j = i+1, j-1 {
+		previous[i], previous[j] = previous[j], previous[i]
 	}
-	return append(previous, parent.Name), nil
+	return previous, nil
 }
 
 // Find all the child branches of the given branch name and append them to
@@ -260,47 +255,63 @@ func FindStackRoot(branches map[string]Branch, name string) (Branch, bool) {
 
 // WriteBranch writes branch metadata to the git repository.
 // It can be loaded again with ReadBranch.
+// To update the metadata of several branches at once, use a Tx instead.
 func WriteBranch(repo *git.Repo, s Branch) error {
+	objectId, err := storeBranch(repo, s)
+	if err != nil {
+		return err
+	}
+	refName := branchMetaRefName(s.Name)
+	if err := repo.UpdateRef(&git.UpdateRef{Ref: refName, New: objectId}); err != nil {
+		return err
+	}
+	logrus.
+		WithFields(logrus.Fields{"ref": refName, "sha": git.ShortSha(objectId)}).
+		Debug("created stack ref")
+	return nil
+}
+
+// storeBranch validates the branch metadata and stores it as a blob in the
+// git repository. It returns the object ID of the blob.
+func storeBranch(repo *git.Repo, s Branch) (string, error) {
 	// Assert a few invariants here
 	// These should be checked by the caller before calling WriteBranch, but
 	// we want to be extra safe to avoid getting into an inconsistent state.
 	if s.Name == "" {
-		return errors.New("cannot write branch metadata: branch name is empty")
+		return "", errors.New("cannot write branch metadata: branch name is empty")
 	}
 
 	if s.Parent.Name == s.Name {
-		return errors.New("cannot write branch metadata: parent branch is the same as the branch itself")
+		return "", errors.New("cannot write branch metadata: parent branch is the same as the branch itself")
 	}
 
 	if s.Parent.Trunk && s.Parent.Head != "" {
-		return errors.New("invariant error: cannot write branch metadata: parent branch is a trunk branch and has a head commit assigned")
+		return "", errors.New("invariant error: cannot write branch metadata: parent branch is a trunk branch and has a head commit assigned")
 	} else if !s.Parent.Trunk && s.Parent.Head == "" {
-		return errors.New("invariant error: cannot write branch metadata: parent branch is not a trunk branch and has no head commit assigned")
+		return "", errors.New("invariant error: cannot write branch metadata: parent branch is not a trunk branch and has no head commit assigned")
 	}
 
 	if slices.Contains(s.Children, s.Name) {
-		return errors.New("cannot write branch metadata: branch is a child of itself")
+		return "", errors.New("cannot write branch metadata: branch is a child of itself")
 	}
 
-	refName := branchMetaRefName(s.Name)
+	if s.Version > BranchSchemaVersion {
+		return "", errors.WrapIff(ErrNewerSchema, "cannot write metadata for branch %q", s.Name)
+	}
+	s.Version = BranchSchemaVersion
+
 	content, err := json.Marshal(s)
 	if err != nil {
-		return errors.Wrap(err, "failed to marshal stack metadata")
+		return "", errors.Wrap(err, "failed to marshal stack metadata")
 	}
 	objectId, err := repo.GitStdin(
 		[]string{"hash-object", "-w", "--stdin"},
 		bytes.NewReader(content),
 	)
 	if err != nil {
-		return errors.Wrap(err, "failed to store stack metadata in git")
+		return "", errors.Wrap(err, "failed to store stack metadata in git")
 	}
-	if err := repo.UpdateRef(&git.UpdateRef{Ref: refName, New: objectId}); err != nil {
-		return err
-	}
-	logrus.
-		WithFields(logrus.Fields{"ref": refName, "sha": git.ShortSha(objectId)}).
-		Debug("created stack ref")
-	return nil
+	return objectId, nil
 }
 
 func DeleteBranch(repo *git.Repo, name string) error {
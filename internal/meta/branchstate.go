@@ -2,7 +2,6 @@ package meta
 
 import (
 	"emperror.dev/errors"
-	"encoding/json"
 	"github.com/aviator-co/av/internal/git"
 	"github.com/sirupsen/logrus"
 )
@@ -70,7 +69,7 @@ func (b Branch) BaseCommit(r *git.Repo) (string, error) {
 		logrus.Warnf(
 			"invariant error: corrupt stack metadata: "+
 				"branch %q parent %q should have (head XOR trunk) set "+
-				"(this may result in incorrect rebases)",
+				"(this may result in incorrect rebases, run `av doctor` for details)",
 			b.Name, b.Parent.Name,
 		)
 	}
@@ -83,33 +82,3 @@ func (b Branch) BaseCommit(r *git.Repo) (string, error) {
 	}
 	return base, nil
 }
-
-// unmarshalBranchState unmarshals a BranchState from JSON (which can either be
-// a string value or a JSON object).
-func unmarshalBranchState(data []byte) (BranchState, error) {
-	// COMPAT: If the parent is unset/null/empty, it means that the branch is
-	// a stack root and so the parent branch is considered a trunk.
-	if len(data) == 0 || string(data) == `null` || string(data) == `""` {
-		return BranchState{Trunk: true}, nil
-	}
-
-	if data[0] == '"' {
-		var s string
-		if err := json.Unmarshal(data, &s); err != nil {
-			return BranchState{}, err
-		}
-		if s == "" {
-			return BranchState{}, nil
-		}
-		return BranchState{Name: s, Head: ""}, nil
-	}
-
-	// Define a type alias here so that it doesn't have the UnmarshalJSON
-	// method (otherwise we get a recursive infinite loop).
-	type alias BranchState
-	var s alias
-	if err := json.Unmarshal(data, &s); err != nil {
-		return BranchState{}, err
-	}
-	return BranchState(s), nil
-}
@@ -0,0 +1,36 @@
+package meta_test
+
+import (
+	"testing"
+
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/git/gittest"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/stretchr/testify/require"
+)
+
+// newTwoBranchStack creates a repository with the stack main <- one <- two
+// (each branch with one commit and metadata) where two is checked out. It
+// returns the repository and the head commit of one.
+func newTwoBranchStack(t *testing.T) (*git.Repo, string) {
+	t.Helper()
+	repo := gittest.NewTempRepo(t)
+	_, err := repo.Git("checkout", "-b", "one")
+	require.NoError(t, err)
+	gittest.CommitFile(t, repo, "one.txt", []byte("one"))
+	oneHead, err := repo.RevParse(&git.RevParse{Rev: "one"})
+	require.NoError(t, err)
+	_, err = repo.Git("checkout", "-b", "two")
+	require.NoError(t, err)
+	gittest.CommitFile(t, repo, "two.txt", []byte("two"))
+	require.NoError(t, meta.WriteBranch(repo, meta.Branch{
+		Name:     "one",
+		Parent:   meta.BranchState{Name: "main", Trunk: true},
+		Children: []string{"two"},
+	}))
+	require.NoError(t, meta.WriteBranch(repo, meta.Branch{
+		Name:   "two",
+		Parent: meta.BranchState{Name: "one", Head: oneHead},
+	}))
+	return repo, oneHead
+}
@@ -0,0 +1,181 @@
+package meta
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/sirupsen/logrus"
+)
+
+// The current versions of the metadata formats. Metadata that was written
+// before versioning was introduced is considered version 0.
+//
+// When changing the format of the metadata, bump the version and add a
+// migration to branchMigrations (or repositoryMigrations) that upgrades
+// metadata in the previous format.
+const (
+	BranchSchemaVersion     = 1
+	RepositorySchemaVersion = 1
+)
+
+// ErrNewerSchema is returned when trying to write metadata that was read in a
+// format that is newer than what this version of av understands.
+var ErrNewerSchema = errors.New("the metadata was written by a newer version of av (please upgrade av)")
+
+// A migration upgrades the raw JSON fields of a metadata blob from one version
+// to the next. The name is the name of the branch (or empty for the repository
+// metadata).
+type migration func(repo *git.Repo, name string, fields map[string]json.RawMessage) error
+
+// branchMigrations[i] upgrades branch metadata from version i to version i+1.
+var branchMigrations = []migration{
+	migrateBranchV1,
+}
+
+// repositoryMigrations[i] upgrades repository metadata from version i to
+// version i+1.
+var repositoryMigrations = []migration{
+	// Version 1 only introduced the version field itself.
+	func(*git.Repo, string, map[string]json.RawMessage) error { return nil },
+}
+
+// migrateBranchV1 normalizes the parent field. In version 0, the parent could
+// be a plain string (the name of the parent branch, without the parent head)
+// and an empty parent meant that the branch was a stack root based on the
+// repository default branch.
+func migrateBranchV1(repo *git.Repo, name string, fields map[string]json.RawMessage) error {
+	var parent BranchState
+	data := fields["parent"]
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &parent.Name); err != nil {
+			return err
+		}
+	} else if len(data) > 0 && string(data) != "null" {
+		if err := json.Unmarshal(data, &parent); err != nil {
+			return err
+		}
+	}
+
+	if parent.Name == "" {
+		defaultBranch, err := repo.DefaultBranch()
+		if err != nil {
+			return errors.WrapIf(err, "failed to determine the parent branch (the repository default branch is unknown)")
+		}
+		parent = BranchState{Name: defaultBranch, Trunk: true}
+	}
+	if !parent.Trunk && parent.Head == "" {
+		// Use the merge base as the best guess for the parent head. If the
+		// branches don't exist anymore, the head is left empty (and the
+		// branch needs to be re-parented, which is reported by `av doctor`).
+		head, err := repo.MergeBase(&git.MergeBase{
+			Revs: []string{"refs/heads/" + name, "refs/heads/" + parent.Name},
+		})
+		if err != nil {
+			logrus.WithError(err).WithField("branch", name).Debug("failed to determine parent head")
+		}
+		parent.Head = head
+	}
+
+	var err error
+	fields["parent"], err = json.Marshal(parent)
+	return err
+}
+
+// migrate upgrades the raw JSON metadata to the latest version and unmarshals
+// it into dest. The version field is left untouched (so that it reflects the
+// version that the metadata was stored in).
+func migrate(repo *git.Repo, name string, data []byte, migrations []migration, dest interface{}) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	var version int
+	if raw, ok := fields["version"]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return errors.WrapIf(err, "invalid metadata version")
+		}
+	}
+	for v := version; v < len(migrations); v++ {
+		if err := migrations[v](repo, name, fields); err != nil {
+			return errors.WrapIff(err, "failed to migrate metadata to version %d", v+1)
+		}
+	}
+	migrated, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(migrated, dest)
+}
+
+type MigrateResult struct {
+	// The branches whose metadata was upgraded.
+	Migrated []string
+	// The branches whose metadata was written by a newer version of av.
+	Newer []string
+	// The branches whose metadata couldn't be upgraded because the parent
+	// head couldn't be determined (the branch needs to be re-parented).
+	Skipped []string
+	// True if the repository metadata was upgraded.
+	Repository bool
+}
+
+// Migrate rewrites all of the metadata in the repository in the latest format.
+func Migrate(repo *git.Repo) (*MigrateResult, error) {
+	result := &MigrateResult{}
+
+	repoMeta, err := ReadRepository(repo)
+	if err != nil && !errors.Is(err, ErrRepoNotInitialized) {
+		return nil, err
+	}
+	if err == nil && repoMeta.Version < RepositorySchemaVersion {
+		if err := WriteRepository(repo, repoMeta); err != nil {
+			return nil, err
+		}
+		result.Repository = true
+	}
+
+	refs, err := repo.ListRefs(&git.ListRefs{Patterns: []string{branchMetaRefPrefix + "**"}})
+	if err != nil {
+		return nil, err
+	}
+	if len(refs) == 0 {
+		return result, nil
+	}
+	refNames := make([]string, len(refs))
+	for i, ref := range refs {
+		refNames[i] = ref.Name
+	}
+	sort.Strings(refNames)
+	items, err := repo.GetRefs(&git.GetRefs{Revisions: refNames})
+	if err != nil {
+		return nil, err
+	}
+
+	tx := NewTx(repo)
+	for _, item := range items {
+		name := strings.TrimPrefix(item.Revision, branchMetaRefPrefix)
+		branch, err := unmarshalBranch(repo, name, string(item.Contents))
+		if err != nil {
+			return nil, errors.WrapIff(err, "failed to read metadata for branch %q", name)
+		}
+		switch {
+		case branch.Version > BranchSchemaVersion:
+			result.Newer = append(result.Newer, name)
+		case branch.Version < BranchSchemaVersion && !branch.Parent.Trunk && branch.Parent.Head == "":
+			result.Skipped = append(result.Skipped, name)
+		case branch.Version < BranchSchemaVersion:
+			// The metadata was already upgraded in memory by unmarshalBranch
+			// and is written in the latest format.
+			tx.WriteBranch(branch)
+			result.Migrated = append(result.Migrated, name)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	logrus.WithField("branches", result.Migrated).Debug("migrated branch metadata")
+	return result, nil
+}
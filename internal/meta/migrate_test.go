@@ -0,0 +1,61 @@
+package meta_test
+
+import (
+	"strings"
+	"testing"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeRawBranchMeta(t *testing.T, repo *git.Repo, name string, blob string) {
+	oid, err := repo.GitStdin([]string{"hash-object", "-w", "--stdin"}, strings.NewReader(blob))
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateRef(&git.UpdateRef{Ref: "refs/av/branch-metadata/" + name, New: oid}))
+}
+
+func TestMigrate(t *testing.T) {
+	repo, oneHead := newTwoBranchStack(t)
+	_, err := repo.Git("symbolic-ref", "refs/remotes/origin/HEAD", "refs/remotes/origin/main")
+	require.NoError(t, err)
+
+	// version 0: the parent is a string (or missing for stack roots)
+	writeRawBranchMeta(t, repo, "one", `{"children":["two"]}`)
+	writeRawBranchMeta(t, repo, "two", `{"parent":"one"}`)
+	writeRawBranchMeta(t, repo, "three", `{"parent":{"name":"","trunk":true}}`)
+	writeRawBranchMeta(t, repo, "deleted", `{"parent":"one"}`)
+	// a version from the future
+	writeRawBranchMeta(t, repo, "future", `{"parent":{"name":"main","trunk":true},"version":100}`)
+
+	// Old metadata is upgraded in memory when it's read
+	one, ok := meta.ReadBranch(repo, "one")
+	require.True(t, ok)
+	assert.Equal(t, meta.BranchState{Name: "main", Trunk: true}, one.Parent)
+	assert.Equal(t, 0, one.Version)
+	two, _ := meta.ReadBranch(repo, "two")
+	assert.Equal(t, meta.BranchState{Name: "one", Head: oneHead}, two.Parent)
+
+	res, err := meta.Migrate(repo)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"one", "three", "two"}, res.Migrated)
+	assert.Equal(t, []string{"future"}, res.Newer)
+	assert.Equal(t, []string{"deleted"}, res.Skipped)
+
+	blob, err := repo.Git("cat-file", "blob", "refs/av/branch-metadata/three")
+	require.NoError(t, err)
+	assert.Contains(t, blob, `"parent":{"name":"main","trunk":true}`)
+	assert.Contains(t, blob, `"version":1`)
+	repoMeta, err := meta.ReadRepository(repo)
+	require.NoError(t, err)
+	assert.Equal(t, meta.RepositorySchemaVersion, repoMeta.Version)
+
+	// Metadata from a newer version of av can be read but not written
+	future, ok := meta.ReadBranch(repo, "future")
+	require.True(t, ok)
+	assert.Equal(t, 100, future.Version)
+	err = meta.WriteBranch(repo, future)
+	assert.True(t, errors.Is(err, meta.ErrNewerSchema), "expected newer schema error, got %v", err)
+}
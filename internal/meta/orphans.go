@@ -0,0 +1,218 @@
+package meta
+
+import (
+	"sort"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/utils/sliceutils"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
+)
+
+// OrphanedBranch is branch metadata whose Git branch no longer exists
+// (usually because the branch was renamed or deleted with git instead of av).
+type OrphanedBranch struct {
+	Branch Branch
+	// The branch that the orphaned branch was (most likely) renamed to. This
+	// is empty if the branch was deleted (or the new name can't be
+	// determined).
+	RenamedTo string
+}
+
+// OrphanedBranchNames returns the names of the branches that have metadata but
+// no corresponding Git branch. This is cheap enough to run before every
+// command (see FindOrphanedBranches to determine what happened to them).
+func OrphanedBranchNames(repo *git.Repo, branches map[string]Branch) ([]string, error) {
+	heads, err := branchHeads(repo)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for name, branch := range branches {
+		// Merged branches are commonly deleted; their metadata is still needed
+		// to sync their children and is cleaned up by av stack sync.
+		if _, ok := heads[name]; !ok && branch.MergeCommit == "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// FindOrphanedBranches finds the branches that have metadata but no
+// corresponding Git branch and tries to determine whether they were renamed.
+//
+// A branch without metadata is considered the new name of an orphaned branch
+// if its reflog records the rename (`git branch -m` writes a "renamed" entry)
+// or, failing that, if it's the only such branch that points at a commit that
+// the orphaned branch is known to have pointed at (the parent head recorded by
+// its children or its remote-tracking branch).
+func FindOrphanedBranches(repo *git.Repo, branches map[string]Branch) ([]OrphanedBranch, error) {
+	heads, err := branchHeads(repo)
+	if err != nil {
+		return nil, err
+	}
+	names, err := OrphanedBranchNames(repo, branches)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	// Only branches that don't have metadata yet can be the new name of a
+	// renamed branch.
+	var candidates []string
+	for name := range heads {
+		if _, ok := branches[name]; !ok {
+			candidates = append(candidates, name)
+		}
+	}
+	sort.Strings(candidates)
+
+	renames := make(map[string]string)
+	for _, candidate := range candidates {
+		if old := renamedFrom(repo, candidate); old != "" {
+			renames[old] = candidate
+		}
+	}
+
+	var orphans []OrphanedBranch
+	for _, name := range names {
+		orphan := OrphanedBranch{Branch: branches[name]}
+		if renamedTo, ok := renames[name]; ok {
+			orphan.RenamedTo = renamedTo
+		} else {
+			knownHeads := knownBranchHeads(repo, branches, name)
+			var matches []string
+			for _, candidate := range candidates {
+				if slices.Contains(knownHeads, heads[candidate]) {
+					matches = append(matches, candidate)
+				}
+			}
+			if len(matches) == 1 {
+				orphan.RenamedTo = matches[0]
+			}
+		}
+		orphans = append(orphans, orphan)
+	}
+	return orphans, nil
+}
+
+func branchHeads(repo *git.Repo) (map[string]string, error) {
+	refs, err := repo.ListRefs(&git.ListRefs{Patterns: []string{"refs/heads/**"}})
+	if err != nil {
+		return nil, err
+	}
+	heads := make(map[string]string, len(refs))
+	for _, ref := range refs {
+		heads[strings.TrimPrefix(ref.Name, "refs/heads/")] = ref.Oid
+	}
+	return heads, nil
+}
+
+// renamedFrom returns the previous name of the given branch according to its
+// reflog (or an empty string if the branch was never renamed).
+func renamedFrom(repo *git.Repo, name string) string {
+	out, err := repo.Git("reflog", "show", "--format=%gs", "refs/heads/"+name, "--")
+	if err != nil {
+		logrus.WithError(err).WithField("branch", name).Debug("failed to read branch reflog")
+		return ""
+	}
+	// The entries are listed from newest to oldest, so the first rename that
+	// we find is the most recent one.
+	suffix := " to refs/heads/" + name
+	for _, line := range strings.Split(out, "\n") {
+		if !strings.HasPrefix(line, "Branch: renamed refs/heads/") || !strings.HasSuffix(line, suffix) {
+			continue
+		}
+		return strings.TrimSuffix(strings.TrimPrefix(line, "Branch: renamed refs/heads/"), suffix)
+	}
+	return ""
+}
+
+// knownBranchHeads returns the commits that the given (deleted) branch is
+// known to have pointed at.
+func knownBranchHeads(repo *git.Repo, branches map[string]Branch, name string) []string {
+	var knownHeads []string
+	for _, child := range branches {
+		if !child.Parent.Trunk && child.Parent.Name == name && child.Parent.Head != "" {
+			knownHeads = append(knownHeads, child.Parent.Head)
+		}
+	}
+	refs, err := repo.ListRefs(&git.ListRefs{Patterns: []string{"refs/remotes/*/" + name}})
+	if err == nil {
+		for _, ref := range refs {
+			knownHeads = append(knownHeads, ref.Oid)
+		}
+	}
+	return knownHeads
+}
+
+// RenameBranch stages moving the metadata of a branch to a new name (including
+// the references from its parent and children).
+func (tx *Tx) RenameBranch(oldName string, newName string) {
+	branch, _ := tx.ReadBranch(oldName)
+	branch.Name = newName
+	tx.DeleteBranch(oldName)
+	tx.WriteBranch(branch)
+
+	// Update the parent's reference to the child (unless the parent is a trunk
+	// which doesn't maintain references to children).
+	if !branch.Parent.Trunk {
+		parent, _ := tx.ReadBranch(branch.Parent.Name)
+		if sliceutils.Replace(parent.Children, oldName, newName) > 0 {
+			tx.WriteBranch(parent)
+		}
+	}
+
+	// Update all child branches to refer to the correct (renamed) parent.
+	for _, childName := range branch.Children {
+		child, _ := tx.ReadBranch(childName)
+		child.Parent.Name = newName
+		tx.WriteBranch(child)
+	}
+}
+
+// RemoveBranch stages deleting the metadata of a branch. Its children are
+// re-parented onto its parent. Since the commits of the removed branch are
+// still part of the history of the children, the new parent head of every
+// child is the merge base of the child and its new parent (so that the next
+// sync keeps those commits). If the new parent is a trunk, the children become
+// stack roots instead.
+func (tx *Tx) RemoveBranch(name string) error {
+	branch, _ := tx.ReadBranch(name)
+	children := append([]string(nil), branch.Children...)
+	if !branch.Parent.Trunk {
+		parent, _ := tx.ReadBranch(branch.Parent.Name)
+		parent.Children = sliceutils.DeleteElement(parent.Children, name)
+		for _, child := range children {
+			if !slices.Contains(parent.Children, child) {
+				parent.Children = append(parent.Children, child)
+			}
+		}
+		tx.WriteBranch(parent)
+	}
+	for _, childName := range children {
+		child, _ := tx.ReadBranch(childName)
+		if branch.Parent.Trunk {
+			child.Parent = BranchState{Name: branch.Parent.Name, Trunk: true}
+		} else {
+			head, err := tx.repo.MergeBase(&git.MergeBase{
+				Revs: []string{"refs/heads/" + childName, "refs/heads/" + branch.Parent.Name},
+			})
+			if err != nil {
+				return errors.WrapIff(
+					err, "failed to determine the new parent head of %q on %q",
+					childName, branch.Parent.Name,
+				)
+			}
+			child.Parent = BranchState{Name: branch.Parent.Name, Head: head}
+		}
+		tx.WriteBranch(child)
+	}
+	tx.DeleteBranch(name)
+	return nil
+}
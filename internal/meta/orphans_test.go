@@ -0,0 +1,82 @@
+package meta_test
+
+import (
+	"testing"
+
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/git/gittest"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindOrphanedBranches(t *testing.T) {
+	// main <- one <- two <- three
+	repo, oneHead := newTwoBranchStack(t)
+	twoHead, err := repo.RevParse(&git.RevParse{Rev: "two"})
+	require.NoError(t, err)
+	_, err = repo.Git("checkout", "-b", "three")
+	require.NoError(t, err)
+	gittest.CommitFile(t, repo, "three.txt", []byte("three"))
+	tx := meta.NewTx(repo)
+	tx.WriteBranch(meta.Branch{
+		Name:     "two",
+		Parent:   meta.BranchState{Name: "one", Head: oneHead},
+		Children: []string{"three"},
+	})
+	tx.WriteBranch(meta.Branch{
+		Name:   "three",
+		Parent: meta.BranchState{Name: "two", Head: twoHead},
+	})
+	require.NoError(t, tx.Commit())
+
+	// Rename one with git (recorded in the reflog) and "rename" two by
+	// deleting it and creating a new branch at the same commit.
+	_, err = repo.Git("branch", "-m", "one", "one-renamed")
+	require.NoError(t, err)
+	_, err = repo.Git("branch", "two-copy", "two")
+	require.NoError(t, err)
+	_, err = repo.Git("branch", "-D", "two")
+	require.NoError(t, err)
+
+	branches, err := meta.ReadAllBranches(repo)
+	require.NoError(t, err)
+	orphans, err := meta.FindOrphanedBranches(repo, branches)
+	require.NoError(t, err)
+	require.Len(t, orphans, 2)
+	assert.Equal(t, "one", orphans[0].Branch.Name)
+	assert.Equal(t, "one-renamed", orphans[0].RenamedTo)
+	assert.Equal(t, "two", orphans[1].Branch.Name)
+	assert.Equal(t, "two-copy", orphans[1].RenamedTo)
+
+	// Fixing the problems moves the metadata to the new names
+	for _, problem := range meta.Validate(repo, branches) {
+		assert.Equal(t, meta.ProblemRenamedBranch, problem.Kind)
+		require.NoError(t, problem.Fix(repo))
+	}
+	branches, err = meta.ReadAllBranches(repo)
+	require.NoError(t, err)
+	assert.Empty(t, meta.Validate(repo, branches))
+	assert.Equal(t, []string{"two-copy"}, branches["one-renamed"].Children)
+	assert.Equal(t, "one-renamed", branches["two-copy"].Parent.Name)
+	assert.Equal(t, "two-copy", branches["three"].Parent.Name)
+
+	// Deleting a branch re-parents its children
+	_, err = repo.Git("checkout", "main")
+	require.NoError(t, err)
+	_, err = repo.Git("branch", "-D", "two-copy")
+	require.NoError(t, err)
+	orphanNames, err := meta.OrphanedBranchNames(repo, branches)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"two-copy"}, orphanNames)
+	problems := meta.Validate(repo, branches)
+	require.Len(t, problems, 1)
+	assert.Equal(t, meta.ProblemDeletedBranch, problems[0].Kind)
+	require.NoError(t, problems[0].Fix(repo))
+	branches, err = meta.ReadAllBranches(repo)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"three"}, branches["one-renamed"].Children)
+	// The commits of the deleted branch are still part of three, so the new
+	// parent head must be the head of one (not of the deleted branch).
+	assert.Equal(t, meta.BranchState{Name: "one-renamed", Head: oneHead}, branches["three"].Parent)
+}
@@ -16,6 +16,36 @@ type Repository struct {
 	Owner string `json:"owner"`
 	// The name of the repository (e.g., av)
 	Name string `json:"name"`
+	// The fork of the repository that branches are pushed to (if using a
+	// fork-based workflow). If nil, branches are pushed to the repository
+	// itself.
+	Fork *Fork `json:"fork,omitempty"`
+	// The Git remote that av pushes to and fetches from (chosen at `av init`).
+	// If empty, origin (or the first listed remote) is used.
+	Remote string `json:"remote,omitempty"`
+	// The version of the metadata format (see RepositorySchemaVersion).
+	Version int `json:"version"`
+}
+
+type Fork struct {
+	// The label of the Git remote for the fork (e.g., fork)
+	Remote string `json:"remote"`
+	// The GitHub (GraphQL) ID of the fork repository.
+	ID string `json:"id"`
+	// The owner of the fork (e.g., my-username)
+	Owner string `json:"owner"`
+	// The name of the fork (usually the same as the name of the repository)
+	Name string `json:"name"`
+}
+
+// HeadOwner returns the owner of the repository that pull request head
+// branches live in (i.e., the owner of the fork if using a fork-based
+// workflow).
+func (r Repository) HeadOwner() string {
+	if r.Fork != nil {
+		return r.Fork.Owner
+	}
+	return r.Owner
 }
 
 var ErrRepoNotInitialized = errors.New("this repository not initialized: please run `av init`")
@@ -25,12 +55,12 @@ var ErrRepoNotInitialized = errors.New("this repository not initialized: please
 func ReadRepository(repo *git.Repo) (Repository, error) {
 	var meta Repository
 
-	metaPath := path.Join(repo.Dir(), ".git", "av", "repo-metadata.json")
+	metaPath := path.Join(repo.CommonDir(), "av", "repo-metadata.json")
 	data, err := os.ReadFile(metaPath)
 	if err != nil {
 		return meta, ErrRepoNotInitialized
 	}
-	if err := json.Unmarshal(data, &meta); err != nil {
+	if err := migrate(repo, "", data, repositoryMigrations, &meta); err != nil {
 		logrus.WithError(err).Error("repository metadata file is corrupt - ignoring")
 		return meta, ErrRepoNotInitialized
 	}
@@ -40,10 +70,15 @@ func ReadRepository(repo *git.Repo) (Repository, error) {
 // WriteRepository writes repository metadata to the git repo.
 // It can be loaded again with ReadRepository.
 func WriteRepository(repo *git.Repo, meta Repository) error {
-	if err := os.Mkdir(path.Join(repo.Dir(), ".git", "av"), 0755); err != nil && !os.IsExist(err) {
+	if meta.Version > RepositorySchemaVersion {
+		return errors.WrapIf(ErrNewerSchema, "cannot write repository metadata")
+	}
+	meta.Version = RepositorySchemaVersion
+	// The repository metadata is shared between all worktrees.
+	if err := os.Mkdir(path.Join(repo.CommonDir(), "av"), 0755); err != nil && !os.IsExist(err) {
 		return errors.Wrap(err, "failed to create av metadata directory")
 	}
-	metaPath := path.Join(repo.Dir(), ".git", "av", "repo-metadata.json")
+	metaPath := path.Join(repo.CommonDir(), "av", "repo-metadata.json")
 	data, err := json.MarshalIndent(meta, "", "  ")
 	if err != nil {
 		return errors.Wrap(err, "failed to marshal repository metadata")
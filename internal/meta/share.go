@@ -0,0 +1,347 @@
+package meta
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
+)
+
+// Branch metadata can be shared through the Git remote so that stacks can be
+// picked up on another machine (or by another person). The metadata refs are
+// pushed to a per-user namespace on the remote
+//
+//	refs/av/users/<namespace>/branch-metadata/<branch>
+//
+// and fetched into remote-tracking refs
+//
+//	refs/av/remotes/<remote>/users/<namespace>/branch-metadata/<branch>
+
+func sharedBranchMetaRefPrefix(namespace string) string {
+	return "refs/av/users/" + namespace + "/branch-metadata/"
+}
+
+func trackingBranchMetaRefPrefix(remote string, namespace string) string {
+	return "refs/av/remotes/" + remote + "/users/" + namespace + "/branch-metadata/"
+}
+
+var namespaceInvalidChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// DefaultNamespace returns the default namespace that is used to share branch
+// metadata through the remote. This is derived from the Git user email (e.g.,
+// jane.doe@example.com becomes jane.doe).
+func DefaultNamespace(repo *git.Repo) (string, error) {
+	email, err := repo.Git("config", "user.email")
+	if err != nil || email == "" {
+		return "", errors.New("failed to determine metadata namespace: git user.email is not set")
+	}
+	local, _, _ := strings.Cut(email, "@")
+	namespace := strings.Trim(namespaceInvalidChars.ReplaceAllString(local, "-"), "-.")
+	if namespace == "" {
+		return "", errors.Errorf("failed to determine metadata namespace from git user.email %q", email)
+	}
+	return namespace, nil
+}
+
+// ConfigureFetchRefspec configures the given remote so that a normal
+// `git fetch` also fetches the shared branch metadata of every user.
+func ConfigureFetchRefspec(repo *git.Repo, remote string) error {
+	refspec := "+refs/av/users/*:refs/av/remotes/" + remote + "/users/*"
+	key := "remote." + remote + ".fetch"
+	existing, _ := repo.Git("config", "--get-all", key)
+	if slices.Contains(strings.Split(existing, "\n"), refspec) {
+		return nil
+	}
+	if _, err := repo.Git("config", "--add", key, refspec); err != nil {
+		return errors.WrapIff(err, "failed to configure fetch refspec for remote %q", remote)
+	}
+	return nil
+}
+
+// PushBranches pushes the branch metadata to the given namespace on the remote.
+//
+// The remote metadata is pulled (and merged into the local metadata) first so
+// that another machine's changes aren't overwritten. Remote refs are only
+// updated if they still match what was pulled (otherwise the push fails and
+// has to be retried), and only the metadata of branches that don't exist
+// locally or on the remote anymore is deleted.
+func PushBranches(repo *git.Repo, remote string, namespace string) (*PullBranchesResult, error) {
+	pulled, err := PullBranches(repo, remote, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	localRefs, err := repo.ListRefs(&git.ListRefs{Patterns: []string{branchMetaRefPrefix + "**"}})
+	if err != nil {
+		return nil, err
+	}
+	trackingPrefix := trackingBranchMetaRefPrefix(remote, namespace)
+	trackingRefs, err := repo.ListRefs(&git.ListRefs{Patterns: []string{trackingPrefix + "**"}})
+	if err != nil {
+		return nil, err
+	}
+	remoteOids := make(map[string]string, len(trackingRefs))
+	for _, ref := range trackingRefs {
+		remoteOids[strings.TrimPrefix(ref.Name, trackingPrefix)] = ref.Oid
+	}
+
+	sharedPrefix := sharedBranchMetaRefPrefix(namespace)
+	var leases, refspecs []string
+	for _, ref := range localRefs {
+		name := strings.TrimPrefix(ref.Name, branchMetaRefPrefix)
+		if remoteOids[name] == ref.Oid {
+			continue
+		}
+		leases = append(leases, "--force-with-lease="+sharedPrefix+name+":"+remoteOids[name])
+		refspecs = append(refspecs, ref.Name+":"+sharedPrefix+name)
+	}
+	for _, name := range pulled.Skipped {
+		leases = append(leases, "--force-with-lease="+sharedPrefix+name+":"+remoteOids[name])
+		refspecs = append(refspecs, ":"+sharedPrefix+name)
+	}
+	if len(refspecs) == 0 {
+		return pulled, nil
+	}
+
+	args := append(append([]string{"push"}, leases...), remote)
+	res, err := repo.Run(&git.RunOpts{Args: append(args, refspecs...)})
+	if err != nil {
+		return nil, err
+	}
+	if res.ExitCode != 0 {
+		return nil, errors.Errorf("failed to push branch metadata to %q: %s", remote, strings.TrimSpace(string(res.Stderr)))
+	}
+	return pulled, nil
+}
+
+type PullBranchesResult struct {
+	// The branches whose metadata was added or updated from the remote.
+	Updated []string
+	// The branches whose local metadata conflicted with the remote metadata
+	// (and was resolved).
+	Conflicts []string
+	// The branches that have metadata on the remote but don't exist locally
+	// (or on the remote).
+	Skipped []string
+	// The branches whose remote metadata couldn't be read (e.g., because it
+	// was written by a newer version of av).
+	Invalid []string
+}
+
+// PullBranches fetches the branch metadata in the given namespace from the
+// remote and merges it into the local metadata. Local branches are created for
+// any branches that only exist on the remote.
+func PullBranches(repo *git.Repo, remote string, namespace string) (*PullBranchesResult, error) {
+	if err := ConfigureFetchRefspec(repo, remote); err != nil {
+		return nil, err
+	}
+	trackingPrefix := trackingBranchMetaRefPrefix(remote, namespace)
+	refspec := "+refs/av/users/" + namespace + "/*:refs/av/remotes/" + remote + "/users/" + namespace + "/*"
+	res, err := repo.Run(&git.RunOpts{
+		Args: []string{"fetch", "--prune", remote, refspec},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if res.ExitCode != 0 {
+		return nil, errors.Errorf("failed to fetch branch metadata from %q: %s", remote, strings.TrimSpace(string(res.Stderr)))
+	}
+
+	refs, err := repo.ListRefs(&git.ListRefs{Patterns: []string{trackingPrefix + "**"}})
+	if err != nil {
+		return nil, err
+	}
+	refNames := make([]string, len(refs))
+	for i, ref := range refs {
+		refNames[i] = ref.Name
+	}
+	sort.Strings(refNames)
+	var contents []*git.GetRefsItem
+	if len(refNames) > 0 {
+		contents, err = repo.GetRefs(&git.GetRefs{Revisions: refNames})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	local, err := ReadAllBranches(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	// The metadata of every branch after the pull (which is needed to decide
+	// which children to keep when resolving conflicts).
+	resolved := make(map[string]Branch, len(local))
+	for name, branch := range local {
+		resolved[name] = branch
+	}
+	type conflict struct{ local, remote Branch }
+	var conflicts []conflict
+
+	result := &PullBranchesResult{}
+	for _, item := range contents {
+		name := strings.TrimPrefix(item.Revision, trackingPrefix)
+		remoteBranch, err := unmarshalBranch(repo, name, string(item.Contents))
+		if err != nil {
+			logrus.WithError(err).Warn("failed to read remote branch metadata")
+			result.Invalid = append(result.Invalid, name)
+			continue
+		}
+
+		localBranch, exists := local[name]
+		if !exists {
+			created, err := ensureLocalBranch(repo, remote, name)
+			if err != nil {
+				return nil, err
+			}
+			if !created {
+				result.Skipped = append(result.Skipped, name)
+				continue
+			}
+			resolved[name] = remoteBranch
+			result.Updated = append(result.Updated, name)
+			continue
+		}
+
+		if branchMetadataEqual(localBranch, remoteBranch) {
+			continue
+		}
+		merged, err := ResolveBranchConflict(repo, localBranch, remoteBranch)
+		if err != nil {
+			return nil, err
+		}
+		resolved[name] = merged
+		conflicts = append(conflicts, conflict{localBranch, remoteBranch})
+	}
+
+	// Now that the parent of every branch is known, keep the children of
+	// either version whose resolved metadata still points at the branch (a
+	// child that was moved to another parent on one side must not be listed
+	// under both parents). Children without metadata are only kept if they're
+	// listed by the winning version.
+	for _, c := range conflicts {
+		name := c.local.Name
+		merged := resolved[name]
+		winnerChildren := merged.Children
+		merged.Children = nil
+		for _, child := range append(append(append([]string(nil), winnerChildren...), c.local.Children...), c.remote.Children...) {
+			if slices.Contains(merged.Children, child) {
+				continue
+			}
+			childBranch, ok := resolved[child]
+			if ok && (childBranch.Parent.Trunk || childBranch.Parent.Name != name) {
+				continue
+			}
+			if !ok && !slices.Contains(winnerChildren, child) {
+				continue
+			}
+			merged.Children = append(merged.Children, child)
+		}
+		resolved[name] = merged
+		result.Conflicts = append(result.Conflicts, name)
+		if !branchMetadataEqual(c.local, merged) {
+			result.Updated = append(result.Updated, name)
+		}
+	}
+	sort.Strings(result.Updated)
+
+	// Write all of the changes at once so that the local metadata is never
+	// partially updated.
+	tx := NewTx(repo)
+	for _, name := range result.Updated {
+		tx.WriteBranch(resolved[name])
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ensureLocalBranch makes sure that the given branch exists locally (creating
+// it from the remote-tracking branch if necessary). It returns false if the
+// branch doesn't exist locally or on the remote.
+func ensureLocalBranch(repo *git.Repo, remote string, name string) (bool, error) {
+	if _, err := repo.RevParse(&git.RevParse{Rev: "refs/heads/" + name}); err == nil {
+		return true, nil
+	}
+	remoteRef := "refs/remotes/" + remote + "/" + name
+	if _, err := repo.RevParse(&git.RevParse{Rev: remoteRef}); err != nil {
+		logrus.WithField("branch", name).Debug("branch doesn't exist locally or on the remote")
+		return false, nil
+	}
+	if _, err := repo.Git("branch", "--track", name, remoteRef); err != nil {
+		return false, errors.WrapIff(err, "failed to create branch %q", name)
+	}
+	return true, nil
+}
+
+// ResolveBranchConflict merges two conflicting versions of the metadata for
+// the same branch. The version whose parent head is part of the history of the
+// local branch wins (if both are, the one that was based on the more recent
+// parent commit wins, and if neither are, the local version wins). Information
+// that is missing from the winning version (e.g., the pull request) is filled
+// in from the other version. Only the children of the winning version are kept;
+// PullBranches adds the children of the losing version once it knows that their
+// metadata still points at the branch.
+func ResolveBranchConflict(repo *git.Repo, local Branch, remote Branch) (Branch, error) {
+	head, err := repo.RevParse(&git.RevParse{Rev: "refs/heads/" + local.Name})
+	if err != nil {
+		return local, nil
+	}
+	localMatches := branchBasedOn(repo, local.Parent, head)
+	remoteMatches := branchBasedOn(repo, remote.Parent, head)
+
+	winner, loser := local, remote
+	switch {
+	case remoteMatches && !localMatches:
+		winner, loser = remote, local
+	case remoteMatches && localMatches && !local.Parent.Trunk && !remote.Parent.Trunk:
+		// Both versions are consistent with the branch history, so prefer the
+		// one that is based on the more recent parent commit.
+		if local.Parent.Head != remote.Parent.Head && isAncestor(repo, local.Parent.Head, remote.Parent.Head) {
+			winner, loser = remote, local
+		}
+	}
+
+	if winner.PullRequest == nil {
+		winner.PullRequest = loser.PullRequest
+	}
+	if winner.MergeCommit == "" {
+		winner.MergeCommit = loser.MergeCommit
+	}
+	winner.Name = local.Name
+	return winner, nil
+}
+
+// branchBasedOn returns true if the branch head is based on the given parent
+// state (i.e., the recorded parent head is part of the branch's history).
+func branchBasedOn(repo *git.Repo, parent BranchState, head string) bool {
+	if parent.Trunk {
+		return true
+	}
+	return isAncestor(repo, parent.Head, head)
+}
+
+func isAncestor(repo *git.Repo, ancestor string, descendant string) bool {
+	if ancestor == "" {
+		return false
+	}
+	ok, err := repo.IsAncestor(ancestor, descendant)
+	if err != nil {
+		// This usually means that the commit doesn't exist locally.
+		logrus.WithError(err).Debug("failed to determine commit ancestry")
+		return false
+	}
+	return ok
+}
+
+func branchMetadataEqual(a Branch, b Branch) bool {
+	aData, aErr := json.Marshal(a)
+	bData, bErr := json.Marshal(b)
+	return aErr == nil && bErr == nil && string(aData) == string(bData)
+}
@@ -0,0 +1,147 @@
+package meta_test
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/git/gittest"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShareBranches(t *testing.T) {
+	remoteDir := filepath.Join(t.TempDir(), "remote.git")
+	require.NoError(t, exec.Command("git", "init", "--bare", remoteDir).Run())
+
+	// main <- one <- two
+	repo1, oneHead := newTwoBranchStack(t)
+	_, err := repo1.Git("remote", "set-url", "origin", remoteDir)
+	require.NoError(t, err)
+	_, err = repo1.Git("push", "origin", "main", "one", "two")
+	require.NoError(t, err)
+	_, err = meta.PushBranches(repo1, "origin", "av-test")
+	require.NoError(t, err)
+
+	// A normal git fetch should include the shared metadata
+	fetchSpec, err := repo1.Git("config", "--get-all", "remote.origin.fetch")
+	require.NoError(t, err)
+	assert.Contains(t, fetchSpec, "+refs/av/users/*:refs/av/remotes/origin/users/*")
+
+	// Clone the repository (e.g., on a different machine) and pull the metadata
+	cloneDir := filepath.Join(t.TempDir(), "clone")
+	require.NoError(t, exec.Command("git", "clone", remoteDir, cloneDir).Run())
+	repo2, err := git.OpenRepo(context.Background(), cloneDir)
+	require.NoError(t, err)
+	_, err = repo2.Git("config", "user.email", "av-test@nonexistant")
+	require.NoError(t, err)
+	_, err = repo2.Git("config", "user.name", "av-test")
+	require.NoError(t, err)
+
+	res, err := meta.PullBranches(repo2, "origin", "av-test")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"one", "two"}, res.Updated)
+	branches, err := meta.ReadAllBranches(repo2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"two"}, branches["one"].Children)
+	assert.Equal(t, oneHead, branches["two"].Parent.Head)
+	_, err = repo2.RevParse(&git.RevParse{Rev: "refs/heads/two"})
+	require.NoError(t, err, "pull should create local branches")
+
+	// Record a pull request on the second machine only
+	two := branches["two"]
+	two.PullRequest = &meta.PullRequest{ID: "PR_two", Number: 2}
+	require.NoError(t, meta.WriteBranch(repo2, two))
+
+	// Sync the stack on the first machine (amending "one" and rebasing "two")
+	gittest.WithCheckoutBranch(t, repo1, "one", func() {
+		gittest.CommitFile(t, repo1, "one.txt", []byte("one v2"), gittest.WithAmend())
+	})
+	newOneHead, err := repo1.RevParse(&git.RevParse{Rev: "one"})
+	require.NoError(t, err)
+	_, err = repo1.Git("rebase", "--onto", newOneHead, oneHead, "two")
+	require.NoError(t, err)
+	require.NoError(t, meta.WriteBranch(repo1, meta.Branch{
+		Name:   "two",
+		Parent: meta.BranchState{Name: "one", Head: newOneHead},
+	}))
+	_, err = repo1.Git("push", "--force", "origin", "one", "two")
+	require.NoError(t, err)
+	_, err = meta.PushBranches(repo1, "origin", "av-test")
+	require.NoError(t, err)
+
+	// Pull the latest branches and metadata on the second machine. The remote
+	// metadata matches the new branch history so it should win, but the pull
+	// request information should be preserved.
+	_, err = repo2.Git("fetch", "origin")
+	require.NoError(t, err)
+	_, err = repo2.Git("branch", "--force", "two", "origin/two")
+	require.NoError(t, err)
+	res, err = meta.PullBranches(repo2, "origin", "av-test")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"two"}, res.Conflicts)
+	two, _ = meta.ReadBranch(repo2, "two")
+	assert.Equal(t, newOneHead, two.Parent.Head)
+	require.NotNil(t, two.PullRequest)
+	assert.Equal(t, int64(2), two.PullRequest.Number)
+
+	// Move two onto main on the second machine. The remote metadata of one
+	// still lists two as a child, but two must not end up with two parents.
+	_, err = repo2.Git("checkout", "two")
+	require.NoError(t, err)
+	_, err = repo2.Git("rebase", "--onto", "origin/main", newOneHead)
+	require.NoError(t, err)
+	two.Parent = meta.BranchState{Name: "main", Trunk: true}
+	require.NoError(t, meta.WriteBranch(repo2, two))
+	one, _ := meta.ReadBranch(repo2, "one")
+	one.Children = nil
+	require.NoError(t, meta.WriteBranch(repo2, one))
+	res, err = meta.PullBranches(repo2, "origin", "av-test")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"one", "two"}, res.Conflicts)
+	branches, err = meta.ReadAllBranches(repo2)
+	require.NoError(t, err)
+	assert.Empty(t, branches["one"].Children)
+	assert.Equal(t, "main", branches["two"].Parent.Name)
+
+	// Push a new branch from a third machine that has never pulled the
+	// metadata. This must not delete (or overwrite) the metadata that was
+	// pushed from the other machines.
+	cloneDir = filepath.Join(t.TempDir(), "clone3")
+	require.NoError(t, exec.Command("git", "clone", remoteDir, cloneDir).Run())
+	repo3, err := git.OpenRepo(context.Background(), cloneDir)
+	require.NoError(t, err)
+	_, err = repo3.Git("checkout", "-b", "three", "origin/main")
+	require.NoError(t, err)
+	require.NoError(t, meta.WriteBranch(repo3, meta.Branch{
+		Name:   "three",
+		Parent: meta.BranchState{Name: "main", Trunk: true},
+	}))
+	_, err = meta.PushBranches(repo3, "origin", "av-test")
+	require.NoError(t, err)
+	remoteRefs, err := repo3.Git("ls-remote", "--refs", "origin", "refs/av/users/av-test/*")
+	require.NoError(t, err)
+	assert.Contains(t, remoteRefs, "refs/av/users/av-test/branch-metadata/one")
+	assert.Contains(t, remoteRefs, "refs/av/users/av-test/branch-metadata/two")
+	assert.Contains(t, remoteRefs, "refs/av/users/av-test/branch-metadata/three")
+	branches, err = meta.ReadAllBranches(repo3)
+	require.NoError(t, err)
+	assert.Equal(t, newOneHead, branches["two"].Parent.Head)
+
+	// The metadata of a branch that was deleted everywhere is removed from
+	// the remote.
+	_, err = repo3.Git("checkout", "main")
+	require.NoError(t, err)
+	_, err = repo3.Git("branch", "-D", "three")
+	require.NoError(t, err)
+	require.NoError(t, meta.DeleteBranch(repo3, "three"))
+	_, err = meta.PushBranches(repo3, "origin", "av-test")
+	require.NoError(t, err)
+	remoteRefs, err = repo3.Git("ls-remote", "--refs", "origin", "refs/av/users/av-test/*")
+	require.NoError(t, err)
+	assert.NotContains(t, remoteRefs, "refs/av/users/av-test/branch-metadata/three")
+	assert.Contains(t, remoteRefs, "refs/av/users/av-test/branch-metadata/one")
+}
@@ -0,0 +1,133 @@
+package meta
+
+import (
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrConcurrentModification is returned when committing a Tx if the metadata of
+// one of the branches was modified after it was read by the transaction.
+var ErrConcurrentModification = errors.New(
+	"branch metadata was modified by another process (is another av command running?)",
+)
+
+// Tx stages changes to the metadata of several branches so that they can be
+// written atomically. Either all of the changes are written or none of them
+// are (e.g., if the process is interrupted).
+//
+// The transaction remembers the value of the metadata of each branch when it
+// is first read (or written), and committing the transaction fails with
+// ErrConcurrentModification if the metadata was modified in the meantime.
+type Tx struct {
+	repo *git.Repo
+	// The object ID of each branch's metadata ref when it was first accessed
+	// by this transaction (or git.Missing if the metadata didn't exist).
+	old map[string]string
+	// The staged changes (a nil value means the metadata should be deleted).
+	changes map[string]*Branch
+	// The order in which the branches were changed.
+	order []string
+}
+
+// NewTx starts a new transaction. Nothing is written until Commit is called.
+func NewTx(repo *git.Repo) *Tx {
+	return &Tx{
+		repo:    repo,
+		old:     make(map[string]string),
+		changes: make(map[string]*Branch),
+	}
+}
+
+// ReadBranch loads the metadata of the given branch (including any changes
+// that were staged in this transaction). See the ReadBranch function for more
+// information.
+func (tx *Tx) ReadBranch(name string) (Branch, bool) {
+	if branch, ok := tx.changes[name]; ok {
+		if branch == nil {
+			return defaultBranchMeta(tx.repo, name), false
+		}
+		return *branch, true
+	}
+
+	refName := branchMetaRefName(name)
+	items, err := tx.repo.GetRefs(&git.GetRefs{Revisions: []string{refName}})
+	if err != nil || len(items) != 1 || items[0].Type != git.TypeBlob {
+		if _, seen := tx.old[name]; !seen {
+			tx.old[name] = git.Missing
+		}
+		return defaultBranchMeta(tx.repo, name), false
+	}
+	if _, seen := tx.old[name]; !seen {
+		tx.old[name] = items[0].Oid
+	}
+	branch, err := unmarshalBranch(tx.repo, name, string(items[0].Contents))
+	if err != nil {
+		logrus.WithError(err).Error("failed to read branch metadata")
+		return defaultBranchMeta(tx.repo, name), false
+	}
+	return branch, true
+}
+
+// WriteBranch stages the metadata of the branch to be written.
+func (tx *Tx) WriteBranch(branch Branch) {
+	tx.touch(branch.Name)
+	tx.changes[branch.Name] = &branch
+}
+
+// DeleteBranch stages the metadata of the branch to be deleted.
+func (tx *Tx) DeleteBranch(name string) {
+	tx.touch(name)
+	tx.changes[name] = nil
+}
+
+func (tx *Tx) touch(name string) {
+	if _, seen := tx.old[name]; !seen {
+		// The branch wasn't read through the transaction, so we use whatever
+		// the current value is as the expected old value.
+		oids, err := tx.repo.ObjectIDs([]string{branchMetaRefName(name)})
+		if err != nil || len(oids) != 1 {
+			oids = []string{git.Missing}
+		}
+		tx.old[name] = oids[0]
+	}
+	if _, changed := tx.changes[name]; !changed {
+		tx.order = append(tx.order, name)
+	}
+}
+
+// Commit writes all of the staged changes to the repository.
+func (tx *Tx) Commit() error {
+	updates := make([]git.UpdateRef, 0, len(tx.order))
+	for _, name := range tx.order {
+		update := git.UpdateRef{
+			Ref: branchMetaRefName(name),
+			New: git.Missing,
+			Old: tx.old[name],
+		}
+		if branch := tx.changes[name]; branch != nil {
+			objectId, err := storeBranch(tx.repo, *branch)
+			if err != nil {
+				return errors.WrapIff(err, "failed to write metadata for branch %q", name)
+			}
+			update.New = objectId
+		}
+		updates = append(updates, update)
+	}
+
+	if err := tx.repo.UpdateRefs(updates); err != nil {
+		if errors.Is(err, git.ErrRefConflict) {
+			return errors.WithStack(ErrConcurrentModification)
+		}
+		return err
+	}
+	logrus.WithField("branches", tx.order).Debug("committed branch metadata transaction")
+	for _, update := range updates {
+		tx.old[strings.TrimPrefix(update.Ref, branchMetaRefPrefix)] = update.New
+	}
+	tx.changes = make(map[string]*Branch)
+	tx.order = nil
+	return nil
+}
@@ -0,0 +1,67 @@
+package meta_test
+
+import (
+	"testing"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/git/gittest"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTx(t *testing.T) {
+	repo := gittest.NewTempRepo(t)
+	head, err := repo.RevParse(&git.RevParse{Rev: "HEAD"})
+	require.NoError(t, err)
+
+	tx := meta.NewTx(repo)
+	one, ok := tx.ReadBranch("one")
+	assert.False(t, ok)
+	one.Children = []string{"two"}
+	tx.WriteBranch(one)
+	tx.WriteBranch(meta.Branch{
+		Name:   "two",
+		Parent: meta.BranchState{Name: "one", Head: head},
+	})
+
+	// Nothing is written until the transaction is committed
+	_, ok = meta.ReadBranch(repo, "one")
+	assert.False(t, ok)
+	// ...but the staged changes are visible within the transaction
+	one, ok = tx.ReadBranch("one")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"two"}, one.Children)
+
+	require.NoError(t, tx.Commit())
+	branches, err := meta.ReadAllBranches(repo)
+	require.NoError(t, err)
+	assert.Len(t, branches, 2)
+
+	// Concurrent modifications cause the transaction to fail without writing
+	// anything
+	tx = meta.NewTx(repo)
+	two, _ := tx.ReadBranch("two")
+	tx.DeleteBranch("one")
+	two.Parent = meta.BranchState{Name: "main", Trunk: true}
+	tx.WriteBranch(two)
+
+	one.Children = nil
+	require.NoError(t, meta.WriteBranch(repo, one))
+	require.NoError(t, meta.WriteBranch(repo, meta.Branch{
+		Name:   "two",
+		Parent: meta.BranchState{Name: "one", Head: head},
+		PullRequest: &meta.PullRequest{
+			ID:     "PR_two",
+			Number: 2,
+		},
+	}))
+	err = tx.Commit()
+	assert.True(t, errors.Is(err, meta.ErrConcurrentModification), "expected concurrent modification error, got %v", err)
+	_, ok = meta.ReadBranch(repo, "one")
+	assert.True(t, ok, "branch one should not have been deleted")
+	two, _ = meta.ReadBranch(repo, "two")
+	assert.Equal(t, "one", two.Parent.Name)
+	assert.Equal(t, int64(2), two.PullRequest.GetNumber())
+}
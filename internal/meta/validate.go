@@ -0,0 +1,338 @@
+package meta
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aviator-co/av/internal/git"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+type ProblemKind string
+
+const (
+	// The branch is (transitively) its own parent.
+	ProblemCycle ProblemKind = "cycle"
+	// The branch's parent does not list the branch as one of its children.
+	ProblemChildNotListed ProblemKind = "child-not-listed"
+	// The branch lists a child whose parent is a different branch.
+	ProblemStaleChild ProblemKind = "stale-child"
+	// The branch's parent has no metadata.
+	ProblemUnknownParent ProblemKind = "unknown-parent"
+	// The metadata refers to a Git branch that no longer exists.
+	ProblemDeletedBranch ProblemKind = "deleted-branch"
+	// The Git branch was renamed without updating the metadata.
+	ProblemRenamedBranch ProblemKind = "renamed-branch"
+	// The recorded parent head is not part of the branch's history.
+	ProblemParentHead ProblemKind = "parent-head"
+	// The pull request associated with the branch is for a different branch.
+	ProblemPullRequestHead ProblemKind = "pull-request-head"
+	// The metadata of the branch can't be parsed.
+	ProblemCorruptMetadata ProblemKind = "corrupt-metadata"
+)
+
+// Problem describes an inconsistency in the branch metadata.
+type Problem struct {
+	Kind   ProblemKind
+	Branch string
+	// A human-readable explanation of the problem.
+	Message string
+	// Fix repairs the problem. It is nil if the problem can't be repaired
+	// automatically. Fixes re-read the metadata from the repository, so they
+	// can be applied one after another.
+	Fix func(repo *git.Repo) error
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s", p.Branch, p.Message)
+}
+
+// Validate checks the consistency of the metadata of all the given branches
+// and returns any problems that were found (ordered by branch name). Branch
+// metadata that can't be parsed (and is therefore missing from branches) is
+// reported first.
+func Validate(repo *git.Repo, branches map[string]Branch) []Problem {
+	names := maps.Keys(branches)
+	sort.Strings(names)
+
+	problems, err := corruptMetadataProblems(repo)
+	if err != nil {
+		logrus.WithError(err).Warn("failed to check for corrupt branch metadata")
+	}
+	inCycle := make(map[string]bool)
+	for _, name := range names {
+		if cycle := findCycle(branches, name); cycle != nil && !inCycle[name] {
+			for _, b := range cycle {
+				inCycle[b] = true
+			}
+			problems = append(problems, Problem{
+				Kind:   ProblemCycle,
+				Branch: name,
+				Message: fmt.Sprintf(
+					"the branch is its own ancestor (%s); "+
+						"re-parent one of the branches onto a different branch with `av stack sync --parent`",
+					strings.Join(append(cycle, cycle[0]), " -> "),
+				),
+			})
+		}
+	}
+
+	renames := make(map[string]string)
+	orphans, err := FindOrphanedBranches(repo, branches)
+	if err != nil {
+		logrus.WithError(err).Warn("failed to determine orphaned branches")
+	}
+	for _, orphan := range orphans {
+		renames[orphan.Branch.Name] = orphan.RenamedTo
+	}
+
+	heads, err := branchHeads(repo)
+	if err != nil {
+		logrus.WithError(err).Warn("failed to list branches")
+	}
+
+	for _, name := range names {
+		branch := branches[name]
+		head, exists := heads[name]
+
+		if !exists {
+			problems = append(problems, deletedBranchProblem(branches, heads, branch, renames[name]))
+		}
+
+		if !branch.Parent.Trunk && !inCycle[name] {
+			parent, ok := branches[branch.Parent.Name]
+			switch {
+			case !ok:
+				problems = append(problems, Problem{
+					Kind:   ProblemUnknownParent,
+					Branch: name,
+					Message: fmt.Sprintf(
+						"the parent branch %q has no stack metadata; "+
+							"re-parent the branch with `av stack sync --parent`",
+						branch.Parent.Name,
+					),
+				})
+			case !slices.Contains(parent.Children, name):
+				problems = append(problems, Problem{
+					Kind:   ProblemChildNotListed,
+					Branch: name,
+					Message: fmt.Sprintf(
+						"the parent branch %q does not list this branch as a child "+
+							"(it won't be included when syncing the stack)",
+						branch.Parent.Name,
+					),
+					Fix: addChildFix(branch.Parent.Name, name),
+				})
+			}
+		}
+
+		for _, childName := range branch.Children {
+			child, ok := branches[childName]
+			if ok && child.Parent.Name == name && !child.Parent.Trunk {
+				continue
+			}
+			msg := fmt.Sprintf("the child branch %q has no stack metadata", childName)
+			if ok {
+				msg = fmt.Sprintf("the child branch %q is stacked on top of %q", childName, child.Parent.Name)
+				if child.Parent.Trunk {
+					msg = fmt.Sprintf("the child branch %q is stacked directly on top of %q", childName, child.Parent.Name)
+				}
+			}
+			problems = append(problems, Problem{
+				Kind:    ProblemStaleChild,
+				Branch:  name,
+				Message: msg + " (the branch should not list it as a child)",
+				Fix:     removeChildFix(name, childName),
+			})
+		}
+
+		if exists && !branch.Parent.Trunk && branch.MergeCommit == "" && !inCycle[name] {
+			if branch.Parent.Head == "" {
+				problems = append(problems, Problem{
+					Kind:   ProblemParentHead,
+					Branch: name,
+					Message: fmt.Sprintf(
+						"the branch has no recorded parent head for %q "+
+							"(the branch may be rebased incorrectly); "+
+							"re-parent the branch with `av stack sync --parent`",
+						branch.Parent.Name,
+					),
+				})
+			} else if !isAncestor(repo, branch.Parent.Head, head) {
+				problems = append(problems, Problem{
+					Kind:   ProblemParentHead,
+					Branch: name,
+					Message: fmt.Sprintf(
+						"the recorded parent head %s of %q is not part of the branch's history "+
+							"(the branch was probably rebased outside of av); "+
+							"re-parent the branch with `av stack sync --parent`",
+						git.ShortSha(branch.Parent.Head), branch.Parent.Name,
+					),
+				})
+			}
+		}
+	}
+	return problems
+}
+
+// corruptMetadataProblems returns a problem for every branch metadata ref that
+// can't be parsed (and is therefore skipped by ReadAllBranches).
+func corruptMetadataProblems(repo *git.Repo) ([]Problem, error) {
+	refs, err := repo.ListRefs(&git.ListRefs{Patterns: []string{branchMetaRefPrefix + "**"}})
+	if err != nil || len(refs) == 0 {
+		return nil, err
+	}
+	refNames := make([]string, len(refs))
+	for i, ref := range refs {
+		refNames[i] = ref.Name
+	}
+	sort.Strings(refNames)
+	items, err := repo.GetRefs(&git.GetRefs{Revisions: refNames})
+	if err != nil {
+		return nil, err
+	}
+	var problems []Problem
+	for _, item := range items {
+		name := strings.TrimPrefix(item.Revision, branchMetaRefPrefix)
+		if _, err := unmarshalBranch(repo, name, string(item.Contents)); err == nil {
+			continue
+		}
+		refName := item.Revision
+		problems = append(problems, Problem{
+			Kind:   ProblemCorruptMetadata,
+			Branch: name,
+			Message: fmt.Sprintf(
+				"the metadata in %s can't be parsed (it is ignored by av); "+
+					"the metadata can be deleted (re-parent the branch with `av stack sync --parent` afterwards)",
+				refName,
+			),
+			Fix: func(repo *git.Repo) error {
+				return repo.UpdateRef(&git.UpdateRef{Ref: refName, New: git.Missing})
+			},
+		})
+	}
+	return problems, nil
+}
+
+// findCycle returns the branches that form a cycle if following the parents of
+// the given branch leads back to it.
+func findCycle(branches map[string]Branch, name string) []string {
+	path := []string{name}
+	current := name
+	for {
+		branch, ok := branches[current]
+		if !ok || branch.Parent.Trunk {
+			return nil
+		}
+		current = branch.Parent.Name
+		if current == name {
+			return path
+		}
+		if slices.Contains(path, current) {
+			// There is a cycle, but this branch is not part of it. It will be
+			// reported for the branches that are.
+			return nil
+		}
+		path = append(path, current)
+	}
+}
+
+func deletedBranchProblem(branches map[string]Branch, heads map[string]string, branch Branch, renamedTo string) Problem {
+	var dependents []string
+	for _, other := range branches {
+		if !other.Parent.Trunk && other.Parent.Name == branch.Name {
+			dependents = append(dependents, other.Name)
+		}
+	}
+	sort.Strings(dependents)
+
+	problem := Problem{
+		Kind:   ProblemDeletedBranch,
+		Branch: branch.Name,
+	}
+	switch {
+	case renamedTo != "":
+		problem.Kind = ProblemRenamedBranch
+		problem.Message = fmt.Sprintf(
+			"the Git branch was renamed to %q outside of av (the metadata can be moved to the new name)",
+			renamedTo,
+		)
+		problem.Fix = txFix(func(tx *Tx) error {
+			tx.RenameBranch(branch.Name, renamedTo)
+			return nil
+		})
+	case len(dependents) == 0:
+		problem.Message = "the Git branch no longer exists (the metadata can be deleted)"
+		problem.Fix = txFix(func(tx *Tx) error { return tx.RemoveBranch(branch.Name) })
+	case branch.MergeCommit != "":
+		// This is expected: the branch was merged and deleted, and its
+		// children haven't been synced yet.
+		problem.Message = fmt.Sprintf(
+			"the Git branch was deleted after it was merged; "+
+				"run `av stack sync` to rebase its children (%s) onto the trunk",
+			strings.Join(dependents, ", "),
+		)
+	default:
+		// The children are re-parented onto the merge base with their new
+		// parent, which requires all of the Git branches to exist.
+		canFix := true
+		if !branch.Parent.Trunk {
+			for _, name := range append([]string{branch.Parent.Name}, dependents...) {
+				if _, ok := heads[name]; !ok {
+					canFix = false
+				}
+			}
+		}
+		if !canFix {
+			problem.Message = fmt.Sprintf(
+				"the Git branch no longer exists but other branches are stacked on top of it (%s); "+
+					"re-parent them with `av stack sync --parent`",
+				strings.Join(dependents, ", "),
+			)
+			break
+		}
+		problem.Message = fmt.Sprintf(
+			"the Git branch no longer exists but other branches are stacked on top of it (%s); "+
+				"the metadata can be deleted and the children re-parented onto %q",
+			strings.Join(dependents, ", "), branch.Parent.Name,
+		)
+		problem.Fix = txFix(func(tx *Tx) error { return tx.RemoveBranch(branch.Name) })
+	}
+	return problem
+}
+
+func txFix(stage func(tx *Tx) error) func(repo *git.Repo) error {
+	return func(repo *git.Repo) error {
+		tx := NewTx(repo)
+		if err := stage(tx); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+}
+
+func addChildFix(parentName string, childName string) func(repo *git.Repo) error {
+	return func(repo *git.Repo) error {
+		parent, _ := ReadBranch(repo, parentName)
+		if slices.Contains(parent.Children, childName) {
+			return nil
+		}
+		parent.Children = append(parent.Children, childName)
+		return WriteBranch(repo, parent)
+	}
+}
+
+func removeChildFix(parentName string, childName string) func(repo *git.Repo) error {
+	return func(repo *git.Repo) error {
+		parent, ok := ReadBranch(repo, parentName)
+		idx := slices.Index(parent.Children, childName)
+		if !ok || idx == -1 {
+			return nil
+		}
+		parent.Children = slices.Delete(parent.Children, idx, idx+1)
+		return WriteBranch(repo, parent)
+	}
+}
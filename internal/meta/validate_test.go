@@ -0,0 +1,113 @@
+package meta_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/git/gittest"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	// main <- one <- two, but one doesn't know about two
+	repo, oneHead := newTwoBranchStack(t)
+	require.NoError(t, meta.WriteBranch(repo, meta.Branch{
+		Name:     "one",
+		Parent:   meta.BranchState{Name: "main", Trunk: true},
+		Children: []string{"deleted"},
+	}))
+	// metadata for a branch that was deleted with `git branch -D`
+	require.NoError(t, meta.WriteBranch(repo, meta.Branch{
+		Name:   "deleted",
+		Parent: meta.BranchState{Name: "one", Head: oneHead},
+	}))
+
+	branches, err := meta.ReadAllBranches(repo)
+	require.NoError(t, err)
+	problems := meta.Validate(repo, branches)
+	kinds := make(map[meta.ProblemKind]string)
+	for _, p := range problems {
+		kinds[p.Kind] = p.Branch
+		assert.NotNil(t, p.Fix, "problem should be fixable: %s", p)
+	}
+	assert.Equal(t, map[meta.ProblemKind]string{
+		meta.ProblemDeletedBranch:  "deleted",
+		meta.ProblemChildNotListed: "two",
+	}, kinds)
+
+	for _, p := range problems {
+		require.NoError(t, p.Fix(repo))
+	}
+	branches, err = meta.ReadAllBranches(repo)
+	require.NoError(t, err)
+	assert.Empty(t, meta.Validate(repo, branches))
+	assert.Equal(t, []string{"two"}, branches["one"].Children)
+	assert.NotContains(t, branches, "deleted")
+}
+
+func TestValidateCycle(t *testing.T) {
+	repo := gittest.NewTempRepo(t)
+	head, err := repo.RevParse(&git.RevParse{Rev: "HEAD"})
+	require.NoError(t, err)
+	for _, name := range []string{"a", "b"} {
+		_, err := repo.Git("branch", name)
+		require.NoError(t, err)
+	}
+	require.NoError(t, meta.WriteBranch(repo, meta.Branch{
+		Name:     "a",
+		Parent:   meta.BranchState{Name: "b", Head: head},
+		Children: []string{"b"},
+	}))
+	require.NoError(t, meta.WriteBranch(repo, meta.Branch{
+		Name:     "b",
+		Parent:   meta.BranchState{Name: "a", Head: head},
+		Children: []string{"a"},
+	}))
+
+	branches, err := meta.ReadAllBranches(repo)
+	require.NoError(t, err)
+	problems := meta.Validate(repo, branches)
+	require.Len(t, problems, 1)
+	assert.Equal(t, meta.ProblemCycle, problems[0].Kind)
+	assert.Nil(t, problems[0].Fix)
+
+	_, err = meta.PreviousBranches(branches, "a")
+	assert.Error(t, err)
+	_, err = meta.Trunk(repo, "a")
+	assert.Error(t, err)
+}
+
+func TestValidateCorruptMetadata(t *testing.T) {
+	repo := gittest.NewTempRepo(t)
+	_, err := repo.Git("branch", "corrupt")
+	require.NoError(t, err)
+	blob, err := repo.Run(&git.RunOpts{
+		Args:  []string{"hash-object", "-w", "--stdin"},
+		Stdin: strings.NewReader(`{"parent": `),
+	})
+	require.NoError(t, err)
+	refName := "refs/av/branch-metadata/corrupt"
+	_, err = repo.Git("update-ref", refName, strings.TrimSpace(string(blob.Stdout)))
+	require.NoError(t, err)
+
+	// Reading the metadata must not delete it (so that av doctor can report
+	// it).
+	branches, err := meta.ReadAllBranches(repo)
+	require.NoError(t, err)
+	assert.NotContains(t, branches, "corrupt")
+	_, err = repo.RevParse(&git.RevParse{Rev: refName})
+	require.NoError(t, err)
+
+	problems := meta.Validate(repo, branches)
+	require.Len(t, problems, 1)
+	assert.Equal(t, meta.ProblemCorruptMetadata, problems[0].Kind)
+	assert.Equal(t, "corrupt", problems[0].Branch)
+	require.NotNil(t, problems[0].Fix)
+	require.NoError(t, problems[0].Fix(repo))
+	_, err = repo.RevParse(&git.RevParse{Rev: refName})
+	assert.Error(t, err)
+	assert.Empty(t, meta.Validate(repo, branches))
+}
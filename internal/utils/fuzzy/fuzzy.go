@@ -0,0 +1,87 @@
+// Package fuzzy implements fuzzy matching of short patterns against names
+// (e.g., branch names), similar to the file finders of most editors.
+package fuzzy
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	scoreMatch       = 1
+	bonusConsecutive = 5
+	bonusWordStart   = 8
+	bonusSubstring   = 10
+)
+
+// Score returns whether all characters of the pattern appear in s in the same
+// order (ignoring case) and, if so, how well the pattern matches. Matches of
+// consecutive characters and matches at the start of words (e.g., after a
+// slash or dash) score higher, as do shorter strings.
+func Score(pattern string, s string) (int, bool) {
+	p := []rune(strings.ToLower(pattern))
+	runes := []rune(s)
+	lower := []rune(strings.ToLower(s))
+	if len(p) == 0 {
+		return 0, true
+	}
+	if len(lower) != len(runes) {
+		// Lower-casing changed the number of runes (which is rare enough
+		// to not bother with word boundaries).
+		runes = lower
+	}
+
+	score := 0
+	pi := 0
+	prev := -2
+	for i := 0; i < len(lower) && pi < len(p); i++ {
+		if lower[i] != p[pi] {
+			continue
+		}
+		score += scoreMatch
+		if i == prev+1 {
+			score += bonusConsecutive
+		}
+		if i == 0 || isSeparator(runes[i-1]) || (unicode.IsUpper(runes[i]) && unicode.IsLower(runes[i-1])) {
+			score += bonusWordStart
+		}
+		prev = i
+		pi++
+	}
+	if pi < len(p) {
+		return 0, false
+	}
+	if strings.Contains(string(lower), string(p)) {
+		score += bonusSubstring
+	}
+	// Prefer shorter strings if everything else is equal.
+	score -= (len(lower) - len(p)) / 4
+	return score, true
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// Match is a string that matches a pattern.
+type Match struct {
+	// The index of the string in the list of candidates.
+	Index int
+	Score int
+}
+
+// Filter returns the candidates that match the pattern, best match first.
+// Candidates with the same score keep their original order.
+func Filter(pattern string, candidates []string) []Match {
+	var matches []Match
+	for i, candidate := range candidates {
+		if score, ok := Score(pattern, candidate); ok {
+			matches = append(matches, Match{Index: i, Score: score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	return matches
+}
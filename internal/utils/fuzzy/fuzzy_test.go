@@ -0,0 +1,45 @@
+package fuzzy_test
+
+import (
+	"testing"
+
+	"github.com/aviator-co/av/internal/utils/fuzzy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScore(t *testing.T) {
+	_, ok := fuzzy.Score("fl", "feature/login")
+	assert.True(t, ok)
+	_, ok = fuzzy.Score("FEAT", "feature/login")
+	assert.True(t, ok, "matching should ignore case")
+	_, ok = fuzzy.Score("lf", "feature/login")
+	assert.False(t, ok, "characters must match in order")
+	_, ok = fuzzy.Score("", "anything")
+	assert.True(t, ok)
+}
+
+func TestFilter(t *testing.T) {
+	candidates := []string{
+		"main",
+		"jane/fix-login-page",
+		"jane/flaky-tests",
+		"jane/login",
+		"loginator",
+	}
+	var names []string
+	for _, match := range fuzzy.Filter("login", candidates) {
+		names = append(names, candidates[match.Index])
+	}
+	// Whole words beat prefixes of longer words, and shorter names beat longer
+	// ones.
+	assert.Equal(t, []string{"jane/login", "loginator", "jane/fix-login-page"}, names)
+
+	names = nil
+	for _, match := range fuzzy.Filter("jl", candidates) {
+		names = append(names, candidates[match.Index])
+	}
+	// Matches at word starts beat matches in the middle of words.
+	assert.Equal(t, []string{"jane/login", "jane/fix-login-page", "jane/flaky-tests"}, names)
+
+	assert.Empty(t, fuzzy.Filter("xyz", candidates))
+}
@@ -0,0 +1,272 @@
+// Package picker implements a minimal interactive picker for the terminal: the
+// user filters a list of items by typing (see package fuzzy) and chooses one
+// with the arrow keys and enter.
+package picker
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/aviator-co/av/internal/utils/fuzzy"
+	"golang.org/x/term"
+)
+
+// ErrCancelled is returned by Run if the user cancels the picker (with escape
+// or ctrl-c).
+var ErrCancelled = errors.New("cancelled")
+
+// Item is an entry in the picker.
+type Item struct {
+	// The value that the filter is matched against and that is returned when
+	// the item is chosen (e.g., a branch name).
+	Value string
+	// The indentation level of the item (e.g., its depth in a tree). Items are
+	// only indented when the list isn't filtered.
+	Depth int
+	// Additional information that is displayed after the value (e.g., the
+	// pull request number of a branch).
+	Detail string
+	// If true, the item is highlighted (e.g., because it's the current
+	// branch).
+	Highlight bool
+}
+
+// Options configure the picker.
+type Options struct {
+	// The prompt that is displayed above the items.
+	Prompt string
+	Items  []Item
+	// The initial filter (e.g., from a command line argument).
+	Filter string
+	// The value of the item that is selected initially.
+	Selected string
+}
+
+// Available returns true if the picker can be used (i.e., stdin and stderr are
+// terminals).
+func Available() bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stderr.Fd()))
+}
+
+// Run displays the picker on stderr and returns the value of the item that was
+// chosen by the user.
+func Run(opts Options) (string, error) {
+	if len(opts.Items) == 0 {
+		return "", errors.New("nothing to choose from")
+	}
+	if !Available() {
+		return "", errors.New("cannot prompt for a choice: not running in a terminal")
+	}
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return "", errors.WrapIf(err, "failed to put the terminal into raw mode")
+	}
+	defer func() { _ = term.Restore(fd, state) }()
+
+	m := newModel(opts)
+	// Some terminals (e.g., in CI or script) don't report their size.
+	if width, height, err := term.GetSize(int(os.Stderr.Fd())); err == nil && width > 0 && height > 2 {
+		m.width = width
+		// Leave room for the prompt and the command line.
+		m.height = height - 2
+	}
+	return m.run(os.Stdin, os.Stderr)
+}
+
+type model struct {
+	opts Options
+	// The filter that the user typed.
+	filter []rune
+	// The indexes of the items that match the filter (in display order).
+	matches []int
+	// The position of the selected item within matches.
+	cursor int
+	// The position of the first visible item within matches.
+	offset int
+	// The size of the terminal.
+	width, height int
+	// The number of lines that were printed by the last render.
+	lines int
+}
+
+func newModel(opts Options) *model {
+	m := &model{opts: opts, filter: []rune(opts.Filter), width: 80, height: 10}
+	m.update()
+	for i, index := range m.matches {
+		if opts.Items[index].Value == opts.Selected {
+			m.cursor = i
+		}
+	}
+	return m
+}
+
+// update recomputes the matches after the filter changed.
+func (m *model) update() {
+	m.matches = m.matches[:0]
+	m.cursor = 0
+	m.offset = 0
+	if len(m.filter) == 0 {
+		for i := range m.opts.Items {
+			m.matches = append(m.matches, i)
+		}
+		return
+	}
+	values := make([]string, len(m.opts.Items))
+	for i, item := range m.opts.Items {
+		values[i] = item.Value
+	}
+	for _, match := range fuzzy.Filter(string(m.filter), values) {
+		m.matches = append(m.matches, match.Index)
+	}
+}
+
+func (m *model) move(delta int) {
+	if len(m.matches) == 0 {
+		return
+	}
+	m.cursor = (m.cursor + delta + len(m.matches)) % len(m.matches)
+}
+
+func (m *model) run(in io.Reader, out io.Writer) (string, error) {
+	// Hide the cursor while the picker is displayed.
+	_, _ = fmt.Fprint(out, "\x1b[?25l")
+	defer func() {
+		m.clear(out)
+		_, _ = fmt.Fprint(out, "\x1b[?25h")
+	}()
+
+	buf := make([]byte, 64)
+	for {
+		m.render(out)
+		n, err := in.Read(buf)
+		if err != nil {
+			return "", errors.WrapIf(err, "failed to read from the terminal")
+		}
+		if n == 0 {
+			continue
+		}
+		key := buf[:n]
+		switch {
+		case len(key) == 1 && (key[0] == 3 || key[0] == 4 || key[0] == 27):
+			// ctrl-c, ctrl-d, or escape
+			return "", ErrCancelled
+		case len(key) == 1 && (key[0] == '\r' || key[0] == '\n'):
+			if len(m.matches) == 0 {
+				continue
+			}
+			return m.opts.Items[m.matches[m.cursor]].Value, nil
+		case string(key) == "\x1b[A" || string(key) == "\x1bOA" || (len(key) == 1 && key[0] == 16):
+			// up arrow or ctrl-p
+			m.move(-1)
+		case string(key) == "\x1b[B" || string(key) == "\x1bOB" || (len(key) == 1 && key[0] == 14):
+			// down arrow or ctrl-n
+			m.move(1)
+		case len(key) == 1 && (key[0] == 127 || key[0] == 8):
+			// backspace
+			if len(m.filter) > 0 {
+				m.filter = m.filter[:len(m.filter)-1]
+				m.update()
+			}
+		case len(key) == 1 && key[0] == 21:
+			// ctrl-u clears the filter (like in most shells)
+			m.filter = nil
+			m.update()
+		case key[0] >= ' ' && key[0] != 127:
+			// Printable characters (which may be pasted all at once).
+			for _, r := range string(key) {
+				if r >= ' ' && r != 127 {
+					m.filter = append(m.filter, r)
+				}
+			}
+			m.update()
+		}
+	}
+}
+
+// clear erases everything that was printed by the last render.
+func (m *model) clear(out io.Writer) {
+	if m.lines > 1 {
+		_, _ = fmt.Fprintf(out, "\x1b[%dA", m.lines-1)
+	}
+	_, _ = fmt.Fprint(out, "\r\x1b[J")
+	m.lines = 0
+}
+
+func (m *model) render(out io.Writer) {
+	height := m.height
+	if height < 1 {
+		height = 1
+	}
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	} else if m.cursor >= m.offset+height {
+		m.offset = m.cursor - height + 1
+	}
+
+	var sb strings.Builder
+	sb.WriteString(colors.Success("? "))
+	sb.WriteString(m.opts.Prompt)
+	sb.WriteString(" ")
+	sb.WriteString(colors.UserInput(string(m.filter)))
+	lines := 1
+	if len(m.matches) == 0 {
+		sb.WriteString("\r\n")
+		sb.WriteString(colors.Faint("  no matches"))
+		lines++
+	}
+	for i := m.offset; i < len(m.matches) && i < m.offset+height; i++ {
+		item := m.opts.Items[m.matches[i]]
+		sb.WriteString("\r\n")
+		lines++
+
+		indent := ""
+		if len(m.filter) == 0 {
+			indent = strings.Repeat("  ", item.Depth)
+		}
+		marker := "  "
+		if item.Highlight {
+			marker = "* "
+		}
+		// Truncate long lines since wrapped lines would break clear.
+		label := truncate(indent+marker+item.Value, m.width-3)
+		detail := truncate(item.Detail, m.width-3-len([]rune(label))-1)
+
+		if i == m.cursor {
+			sb.WriteString(colors.CliCmd("> "))
+		} else {
+			sb.WriteString("  ")
+		}
+		switch {
+		case i == m.cursor:
+			sb.WriteString(colors.CliCmd(label))
+		case item.Highlight:
+			sb.WriteString(colors.Success(label))
+		default:
+			sb.WriteString(label)
+		}
+		if detail != "" {
+			sb.WriteString(" ")
+			sb.WriteString(colors.Faint(detail))
+		}
+	}
+
+	m.clear(out)
+	_, _ = fmt.Fprint(out, sb.String())
+	m.lines = lines
+}
+
+func truncate(s string, width int) string {
+	runes := []rune(s)
+	if width <= 0 {
+		return ""
+	}
+	if len(runes) <= width {
+		return s
+	}
+	return string(runes[:width])
+}
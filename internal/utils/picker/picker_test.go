@@ -0,0 +1,89 @@
+package picker
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// keys is a reader that returns one key press per read (like a terminal in raw
+// mode does).
+type keys []string
+
+func (k *keys) Read(p []byte) (int, error) {
+	if len(*k) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, (*k)[0])
+	*k = (*k)[1:]
+	return n, nil
+}
+
+func runKeys(t *testing.T, opts Options, pressed ...string) (string, error) {
+	t.Helper()
+	in := keys(pressed)
+	var out bytes.Buffer
+	return newModel(opts).run(&in, &out)
+}
+
+func TestRun(t *testing.T) {
+	opts := Options{
+		Prompt: "Switch to branch:",
+		Items: []Item{
+			{Value: "main"},
+			{Value: "jane/login", Depth: 1},
+			{Value: "jane/fix-login-page", Depth: 2},
+			{Value: "jane/flaky-tests", Depth: 1},
+		},
+	}
+
+	value, err := runKeys(t, opts, "\r")
+	require.NoError(t, err)
+	assert.Equal(t, "main", value)
+
+	// Arrow keys (and ctrl-n/ctrl-p) move the selection and wrap around.
+	value, err = runKeys(t, opts, "\x1b[B", "\x1b[B", "\r")
+	require.NoError(t, err)
+	assert.Equal(t, "jane/fix-login-page", value)
+	value, err = runKeys(t, opts, "\x1b[A", "\r")
+	require.NoError(t, err)
+	assert.Equal(t, "jane/flaky-tests", value)
+	value, err = runKeys(t, opts, "\x0e", "\x0e", "\x10", "\r")
+	require.NoError(t, err)
+	assert.Equal(t, "jane/login", value)
+
+	// The initial selection is the selected item.
+	value, err = runKeys(t, Options{Items: opts.Items, Selected: "jane/flaky-tests"}, "\r")
+	require.NoError(t, err)
+	assert.Equal(t, "jane/flaky-tests", value)
+
+	// Typing filters the items (the best match comes first).
+	value, err = runKeys(t, opts, "f", "l", "a", "\r")
+	require.NoError(t, err)
+	assert.Equal(t, "jane/flaky-tests", value)
+	value, err = runKeys(t, opts, "jl", "\x1b[B", "\r")
+	require.NoError(t, err)
+	assert.Equal(t, "jane/fix-login-page", value)
+
+	// Backspace and ctrl-u edit the filter.
+	value, err = runKeys(t, opts, "flax", "\x7f", "\r")
+	require.NoError(t, err)
+	assert.Equal(t, "jane/flaky-tests", value)
+	value, err = runKeys(t, opts, "flaky", "\x15", "\r")
+	require.NoError(t, err)
+	assert.Equal(t, "main", value)
+
+	// Enter does nothing if nothing matches.
+	_, err = runKeys(t, opts, "xyz", "\r")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrCancelled)
+
+	// Escape, ctrl-c, and ctrl-d cancel.
+	for _, key := range []string{"\x1b", "\x03", "\x04"} {
+		_, err = runKeys(t, opts, "j", key)
+		assert.ErrorIs(t, err, ErrCancelled)
+	}
+}
@@ -0,0 +1,37 @@
+package stringutils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Slugify converts s into a string that only consists of lower-case letters,
+// digits, and dashes (e.g., "Fix the bug!" -> "fix-the-bug"), which is
+// suitable for branch names. If maxLength is positive, the slug is truncated
+// to at most maxLength characters (at a word boundary if possible).
+func Slugify(s string, maxLength int) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(r)
+		} else {
+			dash = true
+		}
+	}
+	slug := []rune(b.String())
+	if maxLength <= 0 || len(slug) <= maxLength {
+		return string(slug)
+	}
+	truncated := string(slug[:maxLength])
+	if slug[maxLength] != '-' {
+		if i := strings.LastIndexByte(truncated, '-'); i > 0 {
+			truncated = truncated[:i]
+		}
+	}
+	return strings.TrimRight(truncated, "-")
+}
@@ -0,0 +1,26 @@
+package stringutils_test
+
+import (
+	"testing"
+
+	"github.com/aviator-co/av/internal/utils/stringutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlugify(t *testing.T) {
+	for _, tt := range []struct {
+		input     string
+		maxLength int
+		expected  string
+	}{
+		{"Fix the bug!", 0, "fix-the-bug"},
+		{"  ENG-123: Add `av stack branch -m`  ", 0, "eng-123-add-av-stack-branch-m"},
+		{"Ünïcode & émoji 🎉 support", 0, "ünïcode-émoji-support"},
+		{"!!!", 0, ""},
+		{"Refactor the configuration loader", 20, "refactor-the"},
+		{"Refactor the loader", 12, "refactor-the"},
+		{"supercalifragilisticexpialidocious", 10, "supercalif"},
+	} {
+		assert.Equal(t, tt.expected, stringutils.Slugify(tt.input, tt.maxLength), "Slugify(%q, %d)", tt.input, tt.maxLength)
+	}
+}